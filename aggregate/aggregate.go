@@ -0,0 +1,168 @@
+package aggregate
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"multiple-k8s-informer/resource"
+	"multiple-k8s-informer/store"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// 排序方式
+const (
+	SortCount    = "count"
+	SortLastSeen = "lastSeen"
+)
+
+// ObjectRef Event 关联的对象
+type ObjectRef struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+}
+
+// Group 同一集群中同一对象、同一 reason 的 Event 聚合结果
+type Group struct {
+	Cluster        string    `json:"cluster"`
+	InvolvedObject ObjectRef `json:"involvedObject"`
+	Reason         string    `json:"reason"`
+	Type           string    `json:"type"`    // 最近一次的类型，Normal / Warning
+	Message        string    `json:"message"` // 最近一次的消息
+	Count          int64     `json:"count"`   // 发生次数，即各 Event 的 count 之和
+	Events         int       `json:"events"`  // 聚合的 Event 对象数量
+	FirstSeen      time.Time `json:"firstSeen"`
+	LastSeen       time.Time `json:"lastSeen"`
+}
+
+// Key <cluster>/<kind>/<namespace>/<name>/<reason>
+func (g *Group) Key() string {
+	return groupKey(g.Cluster, g.InvolvedObject, g.Reason)
+}
+
+// Query 汇总查询条件，为空的条件表示不限制
+type Query struct {
+	Clusters   []string
+	Namespaces []string // involvedObject 的 namespace
+	Kinds      []string
+	Names      []string
+	Reasons    []string
+	Types      []string  // Normal / Warning
+	Since      time.Time // 只统计 lastSeen 不早于该时间的 Event
+	Sort       string    // count(默认，从多到少) / lastSeen(从新到旧)
+	Limit      int       // 0 表示不限制
+}
+
+// Summarize 对 Store 中当前的 Event 按 involvedObject、reason、集群聚合
+func Summarize(cs store.ClusterStore, query Query) []Group {
+	groups := make(map[string]*Group)
+	for _, cluster := range cs.Clusters() {
+		if !resource.Match(query.Clusters, cluster) {
+			continue
+		}
+		for _, obj := range cs.ListByCluster(cluster, resource.Events) {
+			event, ok := resource.Unwrap(obj).(*v1.Event)
+			if !ok || !query.match(event) {
+				continue
+			}
+			ref := involvedObject(event)
+			key := groupKey(cluster, ref, event.Reason)
+			g, ok := groups[key]
+			if !ok {
+				g = &Group{Cluster: cluster, InvolvedObject: ref, Reason: event.Reason}
+				groups[key] = g
+			}
+			g.Events++
+			g.add(event, count(event))
+		}
+	}
+
+	result := make([]Group, 0, len(groups))
+	for _, g := range groups {
+		result = append(result, *g)
+	}
+	sortGroups(result, query.Sort)
+	if query.Limit > 0 && len(result) > query.Limit {
+		result = result[:query.Limit]
+	}
+	return result
+}
+
+func (q Query) match(event *v1.Event) bool {
+	ref := involvedObject(event)
+	if !resource.Match(q.Namespaces, ref.Namespace) || !resource.Match(q.Kinds, ref.Kind) || !resource.Match(q.Names, ref.Name) ||
+		!resource.Match(q.Reasons, event.Reason) || !resource.Match(q.Types, event.Type) {
+		return false
+	}
+	return q.Since.IsZero() || !lastSeen(event).Before(q.Since)
+}
+
+// add 计入 Event 新增的 n 次，并更新时间与最近一次的消息
+func (g *Group) add(event *v1.Event, n int64) {
+	first, last := firstSeen(event), lastSeen(event)
+	if g.Count == 0 || first.Before(g.FirstSeen) {
+		g.FirstSeen = first
+	}
+	if g.Count == 0 || !last.Before(g.LastSeen) {
+		g.LastSeen = last
+		g.Type = event.Type
+		g.Message = event.Message
+	}
+	g.Count += n
+}
+
+func sortGroups(groups []Group, by string) {
+	sort.Slice(groups, func(i, j int) bool {
+		a, b := groups[i], groups[j]
+		if by == SortLastSeen {
+			if !a.LastSeen.Equal(b.LastSeen) {
+				return a.LastSeen.After(b.LastSeen)
+			}
+		} else if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Key() < b.Key()
+	})
+}
+
+func groupKey(cluster string, ref ObjectRef, reason string) string {
+	return strings.Join([]string{cluster, ref.Kind, ref.Namespace, ref.Name, reason}, "/")
+}
+
+func involvedObject(event *v1.Event) ObjectRef {
+	return ObjectRef{Kind: event.InvolvedObject.Kind, Namespace: event.InvolvedObject.Namespace, Name: event.InvolvedObject.Name}
+}
+
+// count Event 的发生次数，新版 Event 使用 series.count
+func count(event *v1.Event) int64 {
+	n := int64(event.Count)
+	if event.Series != nil && int64(event.Series.Count) > n {
+		n = int64(event.Series.Count)
+	}
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+func firstSeen(event *v1.Event) time.Time {
+	switch {
+	case !event.FirstTimestamp.IsZero():
+		return event.FirstTimestamp.Time
+	case !event.EventTime.IsZero():
+		return event.EventTime.Time
+	}
+	return event.CreationTimestamp.Time
+}
+
+func lastSeen(event *v1.Event) time.Time {
+	switch {
+	case event.Series != nil && !event.Series.LastObservedTime.IsZero():
+		return event.Series.LastObservedTime.Time
+	case !event.LastTimestamp.IsZero():
+		return event.LastTimestamp.Time
+	}
+	return firstSeen(event)
+}
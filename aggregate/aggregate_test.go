@@ -0,0 +1,76 @@
+package aggregate
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"multiple-k8s-informer/resource"
+	"multiple-k8s-informer/store"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func eventStore(t *testing.T, byCluster map[string][]*v1.Event) store.ClusterStore {
+	t.Helper()
+	cs := store.ClusterIndexers{}
+	for cluster, events := range byCluster {
+		indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+		for _, e := range events {
+			if err := indexer.Add(e); err != nil {
+				t.Fatal(err)
+			}
+		}
+		cs.Add(cluster, resource.Events, indexer)
+	}
+	return cs
+}
+
+func TestSummarize(t *testing.T) {
+	pulled := backOff("pulled", 1, start.Add(3*time.Minute))
+	pulled.Reason, pulled.Type, pulled.Message = "Pulled", v1.EventTypeNormal, "pulled image"
+	latest := backOff("b", 4, start.Add(2*time.Minute))
+	latest.Message = "latest"
+	cs := eventStore(t, map[string][]*v1.Event{
+		"c1": {backOff("a", 2, start.Add(time.Minute)), latest, pulled},
+		"c2": {backOff("a", 1, start)},
+	})
+
+	tests := []struct {
+		name  string
+		query Query
+		want  []string // <cluster>/<reason>:<count>
+	}{
+		{"by count", Query{}, []string{"c1/BackOff:6", "c1/Pulled:1", "c2/BackOff:1"}},
+		{"by last seen", Query{Sort: SortLastSeen}, []string{"c1/Pulled:1", "c1/BackOff:6", "c2/BackOff:1"}},
+		{"cluster", Query{Clusters: []string{"c2"}}, []string{"c2/BackOff:1"}},
+		{"type", Query{Types: []string{v1.EventTypeWarning}}, []string{"c1/BackOff:6", "c2/BackOff:1"}},
+		{"reason and kind", Query{Reasons: []string{"Pulled"}, Kinds: []string{"Pod"}}, []string{"c1/Pulled:1"}},
+		{"since", Query{Since: start.Add(90 * time.Second)}, []string{"c1/BackOff:4", "c1/Pulled:1"}},
+		{"limit", Query{Limit: 1}, []string{"c1/BackOff:6"}},
+		{"no match", Query{Names: []string{"api"}}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			groups := Summarize(cs, tt.query)
+			var got []string
+			for _, g := range groups {
+				got = append(got, g.Cluster+"/"+g.Reason+":"+strconv.FormatInt(g.Count, 10))
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Fatalf("Summarize() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// 组的次数、Event 数量、时间与最近一次的消息
+	g := Summarize(cs, Query{Clusters: []string{"c1"}, Reasons: []string{"BackOff"}})[0]
+	if g.Events != 2 || !g.FirstSeen.Equal(start) || !g.LastSeen.Equal(start.Add(2*time.Minute)) || g.Message != "latest" {
+		t.Fatalf("group = %+v", g)
+	}
+	if g.InvolvedObject != (ObjectRef{Kind: "Pod", Namespace: "default", Name: "web"}) {
+		t.Fatalf("involvedObject = %+v", g.InvolvedObject)
+	}
+}
@@ -0,0 +1,282 @@
+package aggregate
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"multiple-k8s-informer/metrics"
+	"multiple-k8s-informer/queue"
+	"multiple-k8s-informer/resource"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// AnnotationEvents 聚合输出的 Event 上记录聚合的 Event 对象数量
+const AnnotationEvents = "multiple-k8s-informer/aggregated-events"
+
+// 默认配置
+const (
+	DefaultInterval  = time.Minute
+	DefaultRetention = time.Hour
+)
+
+// Config Event 聚合配置
+type Config struct {
+	Enabled   bool          `json:"enabled" yaml:"enabled"`
+	Interval  time.Duration `json:"interval" yaml:"interval"`   // 同一组在该时间内最多输出一次，默认 1m
+	Retention time.Duration `json:"retention" yaml:"retention"` // 组在该时间内没有再出现时过期并输出 delete，默认 1h
+}
+
+// Queue 聚合 core/v1 Event 的队列，其他资源直接放入队列
+//
+// informer 收到的 Event 按集群、involvedObject、reason 分组，不直接放入队列：
+// 新的组立即输出 add，之后的变化在 Interval 内合并为一次 update，组过期时输出 delete
+// 输出的对象为合成的 v1.Event，name 为 <kind>.<name>.<reason>，count、firstTimestamp、lastTimestamp 为组的聚合结果
+// 订阅者(SSE、gRPC、告警)仍收到原始的 Event
+//
+// q 为持久化队列时，合成的 Event 写入 wal，重启后重放给 handler；组的状态由重放的 Event 恢复，
+// 重新 list 到的 Event 计入已有的组并输出 update，不会重复输出 add
+type Queue struct {
+	queue.Decorator
+	config Config
+	now    func() time.Time
+
+	mu     sync.Mutex
+	groups map[string]*groupState
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+var _ queue.Queue = &Queue{}
+
+type groupState struct {
+	Group
+	members  map[string]int64 // Event 的 key -> 已计入的次数
+	latest   *v1.Event
+	revision int64
+	dirty    bool      // 有未输出的变化
+	emitAt   time.Time // 最近一次输出的时间
+	seenAt   time.Time // 最近一次收到 Event 的时间
+}
+
+// replayer 启动时重放过对象的队列，如 queue.PersistentQueue
+type replayer interface {
+	Replayed() []queue.QueueObject
+}
+
+// NewQueue 在 q 之上聚合 Event，后台定时输出合并的 update 与过期的 delete
+func NewQueue(q queue.Queue, config Config) *Queue {
+	if config.Interval <= 0 {
+		config.Interval = DefaultInterval
+	}
+	if config.Retention <= 0 {
+		config.Retention = DefaultRetention
+	}
+	a := &Queue{
+		Decorator: queue.Decorator{Queue: q},
+		config:    config,
+		now:       time.Now,
+		groups:    make(map[string]*groupState),
+		stopCh:    make(chan struct{}),
+	}
+	if r, ok := q.(replayer); ok {
+		a.restore(r.Replayed())
+	}
+
+	tick := config.Interval / 2
+	if tick > 10*time.Second {
+		tick = 10 * time.Second
+	}
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		ticker := time.NewTicker(tick)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-a.stopCh:
+				return
+			case <-ticker.C:
+				for _, obj := range a.flush(false) {
+					a.Queue.Push(obj)
+				}
+			}
+		}
+	}()
+	return a
+}
+
+// Push Event 计入所属的组，需要输出时放入队列
+func (a *Queue) Push(obj queue.QueueObject) {
+	event, ok := resource.Unwrap(obj.Obj).(*v1.Event)
+	if obj.ResourceType != resource.Events || !ok {
+		a.Queue.Push(obj)
+		return
+	}
+	if out, ok := a.observe(obj, event); ok {
+		a.Queue.Push(out)
+		return
+	}
+	metrics.ObserveDropped(obj.ClusterName, obj.ResourceType, "aggregated")
+}
+
+// Groups 当前所有的组，按次数从多到少排序
+func (a *Queue) Groups() []Group {
+	a.mu.Lock()
+	groups := make([]Group, 0, len(a.groups))
+	for _, g := range a.groups {
+		groups = append(groups, g.Group)
+	}
+	a.mu.Unlock()
+
+	sortGroups(groups, SortCount)
+	return groups
+}
+
+// Close 停止定时输出，将还未输出的合并 update 放入队列后关闭 q
+func (a *Queue) Close() {
+	close(a.stopCh)
+	a.wg.Wait()
+	for _, obj := range a.flush(true) {
+		a.Queue.Push(obj)
+	}
+	a.Queue.Close()
+}
+
+func (a *Queue) observe(obj queue.QueueObject, event *v1.Event) (queue.QueueObject, bool) {
+	ref := involvedObject(event)
+	key := groupKey(obj.ClusterName, ref, event.Reason)
+	now := a.now()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	g := a.groups[key]
+	if obj.Event == resource.EventDelete {
+		// Event 过期被删除，已计入的次数保留在组中
+		if g != nil {
+			delete(g.members, obj.Key)
+		}
+		return queue.QueueObject{}, false
+	}
+	if g == nil {
+		g = &groupState{
+			Group:   Group{Cluster: obj.ClusterName, InvolvedObject: ref, Reason: event.Reason},
+			members: make(map[string]int64),
+		}
+		a.groups[key] = g
+	}
+
+	n := count(event)
+	counted, seen := g.members[obj.Key]
+	if seen && n <= counted && !lastSeen(event).After(g.LastSeen) {
+		// 重新同步或没有新的发生
+		return queue.QueueObject{}, false
+	}
+	if !seen {
+		g.Events++
+	}
+	if delta := n - counted; delta > 0 {
+		g.add(event, delta)
+	} else {
+		g.add(event, 0)
+	}
+	g.members[obj.Key] = n
+	g.latest = event
+	g.revision++
+	g.seenAt = now
+
+	switch {
+	case g.emitAt.IsZero():
+		return a.emit(g, resource.EventAdd, now), true
+	case now.Sub(g.emitAt) >= a.config.Interval:
+		return a.emit(g, resource.EventUpdate, now), true
+	}
+	g.dirty = true
+	return queue.QueueObject{}, false
+}
+
+// restore 由重放的合成 Event 恢复已输出过的组
+// 次数从 0 开始，由重新 list 到的 Event 重新计入；组已输出过，之后只输出 update 或 delete
+func (a *Queue) restore(objs []queue.QueueObject) {
+	now := a.now()
+	for _, obj := range objs {
+		event, ok := resource.Unwrap(obj.Obj).(*v1.Event)
+		if obj.ResourceType != resource.Events || !ok {
+			continue
+		}
+		if _, ok := event.Annotations[AnnotationEvents]; !ok {
+			continue
+		}
+		key := groupKey(obj.ClusterName, involvedObject(event), event.Reason)
+		if obj.Event == resource.EventDelete {
+			delete(a.groups, key)
+			continue
+		}
+		revision, _ := strconv.ParseInt(event.ResourceVersion, 10, 64)
+		emitAt := obj.CreateAt // 合成时的时间
+		if emitAt.IsZero() {
+			emitAt = now
+		}
+		a.groups[key] = &groupState{
+			Group:    Group{Cluster: obj.ClusterName, InvolvedObject: involvedObject(event), Reason: event.Reason, Type: event.Type, Message: event.Message},
+			members:  make(map[string]int64),
+			latest:   event,
+			revision: revision,
+			emitAt:   emitAt,
+			seenAt:   now,
+		}
+	}
+}
+
+// flush 输出 Interval 已到的 update，以及过期组的 delete，final 为 true 时不等待 Interval
+func (a *Queue) flush(final bool) []queue.QueueObject {
+	now := a.now()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var out []queue.QueueObject
+	for key, g := range a.groups {
+		switch {
+		case now.Sub(g.seenAt) >= a.config.Retention:
+			delete(a.groups, key)
+			out = append(out, a.emit(g, resource.EventDelete, now))
+		case g.dirty && (final || now.Sub(g.emitAt) >= a.config.Interval):
+			out = append(out, a.emit(g, resource.EventUpdate, now))
+		}
+	}
+	return out
+}
+
+// emit 合成组的 Event，调用时需持有锁
+func (a *Queue) emit(g *groupState, event string, now time.Time) queue.QueueObject {
+	g.dirty = false
+	g.emitAt = now
+
+	name := strings.ToLower(g.InvolvedObject.Kind) + "." + g.InvolvedObject.Name + "." + g.Reason
+	e := g.latest.DeepCopy()
+	e.ObjectMeta = metav1.ObjectMeta{
+		Name:              name,
+		Namespace:         g.latest.Namespace,
+		ResourceVersion:   strconv.FormatInt(g.revision, 10),
+		CreationTimestamp: metav1.NewTime(g.FirstSeen),
+		Annotations:       map[string]string{AnnotationEvents: strconv.Itoa(g.Events)},
+	}
+	e.Type, e.Message = g.Type, g.Message
+	e.Count = int32(min(g.Count, math.MaxInt32))
+	e.FirstTimestamp = metav1.NewTime(g.FirstSeen)
+	e.LastTimestamp = metav1.NewTime(g.LastSeen)
+	e.Series = nil
+
+	key := name
+	if e.Namespace != "" {
+		key = e.Namespace + "/" + name
+	}
+	return queue.QueueObject{ClusterName: g.Cluster, ResourceType: resource.Events, Event: event, Key: key, Obj: e, CreateAt: now}
+}
@@ -0,0 +1,170 @@
+package aggregate
+
+import (
+	"testing"
+	"time"
+
+	"multiple-k8s-informer/queue"
+	"multiple-k8s-informer/resource"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var start = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func backOff(name string, count int32, last time.Time) *v1.Event {
+	return &v1.Event{
+		ObjectMeta:     metav1.ObjectMeta{Name: name, Namespace: "default"},
+		InvolvedObject: v1.ObjectReference{Kind: "Pod", Namespace: "default", Name: "web"},
+		Reason:         "BackOff",
+		Type:           v1.EventTypeWarning,
+		Count:          count,
+		FirstTimestamp: metav1.NewTime(start),
+		LastTimestamp:  metav1.NewTime(last),
+	}
+}
+
+func eventObject(event string, e *v1.Event) queue.QueueObject {
+	return queue.QueueObject{ClusterName: "c1", ResourceType: resource.Events, Event: event, Key: "default/" + e.Name, Obj: e}
+}
+
+func newTestQueue(t *testing.T, q queue.Queue, now *time.Time) *Queue {
+	t.Helper()
+	a := &Queue{Decorator: queue.Decorator{Queue: q}, config: Config{Interval: time.Minute, Retention: time.Hour}, now: func() time.Time { return *now }, groups: make(map[string]*groupState), stopCh: make(chan struct{})}
+	if r, ok := q.(replayer); ok {
+		a.restore(r.Replayed())
+	}
+	return a
+}
+
+func TestObserve(t *testing.T) {
+	type step struct {
+		after time.Duration // 距 start 的时间
+		event string
+		obj   *v1.Event
+		want  string // 输出的事件，空表示不输出
+		count int64
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{"new group then merged update", []step{
+			{0, resource.EventAdd, backOff("a", 1, start), resource.EventAdd, 1},
+			{10 * time.Second, resource.EventUpdate, backOff("a", 3, start.Add(10*time.Second)), "", 3},
+			{time.Minute, resource.EventUpdate, backOff("a", 4, start.Add(time.Minute)), resource.EventUpdate, 4},
+		}},
+		{"resync is ignored", []step{
+			{0, resource.EventAdd, backOff("a", 2, start), resource.EventAdd, 2},
+			{2 * time.Minute, resource.EventUpdate, backOff("a", 2, start), "", 2},
+		}},
+		{"events of the same group", []step{
+			{0, resource.EventAdd, backOff("a", 2, start), resource.EventAdd, 2},
+			{2 * time.Minute, resource.EventAdd, backOff("b", 1, start.Add(2*time.Minute)), resource.EventUpdate, 3},
+		}},
+		{"deleted event keeps its count", []step{
+			{0, resource.EventAdd, backOff("a", 2, start), resource.EventAdd, 2},
+			{time.Minute, resource.EventDelete, backOff("a", 2, start), "", 2},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := start
+			a := newTestQueue(t, queue.NewQueue(1), &now)
+			for i, s := range tt.steps {
+				now = start.Add(s.after)
+				out, ok := a.observe(eventObject(s.event, s.obj), s.obj)
+				if got := map[bool]string{true: out.Event}[ok]; got != s.want {
+					t.Fatalf("step %d: output %q, want %q", i, got, s.want)
+				}
+				if groups := a.Groups(); len(groups) != 1 || groups[0].Count != s.count {
+					t.Fatalf("step %d: groups = %+v, want count %d", i, groups, s.count)
+				}
+				if ok && out.Obj.(*v1.Event).Count != int32(s.count) {
+					t.Fatalf("step %d: output count = %d, want %d", i, out.Obj.(*v1.Event).Count, s.count)
+				}
+			}
+		})
+	}
+}
+
+// 重启后重新 list 到的 Event 输出 update，而不是重复的 add
+func TestRestoreFromPersistentQueue(t *testing.T) {
+	dir := t.TempDir()
+	now := start
+	pq, err := queue.NewPersistentQueue(queue.NewQueue(1), queue.PersistenceConfig{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := newTestQueue(t, pq, &now)
+	a.Push(eventObject(resource.EventAdd, backOff("a", 1, start)))
+	pq.Close()
+
+	now = start.Add(2 * time.Minute)
+	pq, err = queue.NewPersistentQueue(queue.NewQueue(1), queue.PersistenceConfig{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.Close()
+	a = newTestQueue(t, pq, &now)
+
+	// 重放的合成 Event
+	replayed, err := a.Pop()
+	if err != nil || replayed.Event != resource.EventAdd || replayed.Key != "default/pod.web.BackOff" {
+		t.Fatalf("replayed %s %s, %v", replayed.Event, replayed.Key, err)
+	}
+	a.Finish(replayed)
+
+	// 重新 list
+	e := backOff("a", 1, start)
+	out, ok := a.observe(eventObject(resource.EventAdd, e), e)
+	if !ok || out.Event != resource.EventUpdate {
+		t.Fatalf("relisted event output %v %q, want update", ok, out.Event)
+	}
+	if rv := out.Obj.(*v1.Event).ResourceVersion; rv != "2" {
+		t.Fatalf("resourceVersion = %s, want 2 after the replayed revision 1", rv)
+	}
+	if groups := a.Groups(); len(groups) != 1 || groups[0].Count != 1 {
+		t.Fatalf("groups = %+v, want count 1", groups)
+	}
+}
+
+// pushRecorder 记录放入队列的对象
+type pushRecorder struct {
+	queue.Queue
+	pushed []queue.QueueObject
+}
+
+func (r *pushRecorder) Push(obj queue.QueueObject) {
+	r.pushed = append(r.pushed, obj)
+	r.Queue.Push(obj)
+}
+
+// Close 时输出 Interval 内还未输出的合并 update，之后再关闭队列
+func TestCloseFlushesDirtyGroups(t *testing.T) {
+	now := start
+	r := &pushRecorder{Queue: queue.NewQueue(1)}
+	a := newTestQueue(t, r, &now)
+
+	a.Push(eventObject(resource.EventAdd, backOff("a", 1, start)))
+	now = start.Add(10 * time.Second)
+	a.Push(eventObject(resource.EventUpdate, backOff("a", 3, now)))
+	if len(r.pushed) != 1 {
+		t.Fatalf("pushed %d objects before Close, want only the add", len(r.pushed))
+	}
+
+	a.Close()
+	if len(r.pushed) != 2 {
+		t.Fatalf("pushed %d objects after Close, want the add and the merged update", len(r.pushed))
+	}
+	if out := r.pushed[1]; out.Event != resource.EventUpdate || out.Obj.(*v1.Event).Count != 3 {
+		t.Fatalf("final flush = %s with count %d, want update with count 3", out.Event, out.Obj.(*v1.Event).Count)
+	}
+	// 关闭后的队列不再接受对象，两个对象都在关闭前放入
+	for i := 0; i < 2; i++ {
+		if _, err := r.Pop(); err != nil {
+			t.Fatalf("Pop() %d = %v, want the objects pushed before the queue was closed", i, err)
+		}
+	}
+}
@@ -0,0 +1,402 @@
+package alert
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"multiple-k8s-informer/metrics"
+	"multiple-k8s-informer/queue"
+	"multiple-k8s-informer/resource"
+	"multiple-k8s-informer/stream"
+
+	"k8s.io/klog"
+)
+
+// 告警状态
+const (
+	StatusFiring   = "firing"
+	StatusResolved = "resolved"
+)
+
+// DefaultInterval 默认检查 for 与重复通知的间隔
+const DefaultInterval = 10 * time.Second
+
+// Config 告警配置
+type Config struct {
+	Enabled   bool             `json:"enabled" yaml:"enabled"`
+	Interval  time.Duration    `json:"interval" yaml:"interval"`   // 检查 for 与重复通知的间隔，默认 10s
+	Buffer    int              `json:"buffer" yaml:"buffer"`       // 订阅事件的缓冲区大小，默认 1024
+	RuleFiles []string         `json:"ruleFiles" yaml:"ruleFiles"` // 规则文件，格式同 rules
+	Rules     []Rule           `json:"rules" yaml:"rules"`
+	Notifiers []NotifierConfig `json:"notifiers" yaml:"notifiers"` // 为空时输出到日志
+}
+
+// Alert 告警，同一规则、同一对象的告警 Fingerprint 相同
+type Alert struct {
+	Fingerprint string            `json:"fingerprint"`
+	Rule        string            `json:"rule"`
+	Status      string            `json:"status"` // firing / resolved
+	Severity    string            `json:"severity"`
+	Cluster     string            `json:"cluster"`
+	Resource    string            `json:"resource"`
+	Namespace   string            `json:"namespace,omitempty"`
+	Name        string            `json:"name"`
+	Key         string            `json:"key"`
+	Event       string            `json:"event"` // 最近一次匹配的事件
+	Summary     string            `json:"summary"`
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+	ActiveAt    time.Time         `json:"activeAt"`         // 开始满足条件的时间
+	StartsAt    time.Time         `json:"startsAt"`         // 满足 for 开始告警的时间，未告警时为零值
+	EndsAt      *time.Time        `json:"endsAt,omitempty"` // 恢复的时间
+}
+
+// Source 事件来源，controller.MultiClusterInformer 实现了该接口
+type Source interface {
+	Subscribe(filter stream.Filter, buffer int) *stream.Subscriber
+	Unsubscribe(*stream.Subscriber)
+}
+
+// Engine 对事件流求值告警规则
+//
+// 对象满足规则后进入 pending，持续满足 For 后 firing 并通知，不再满足或被删除后 resolved 并通知
+// 只有对象的事件才会改变状态，For 到期与重复通知由 Tick 检查
+type Engine struct {
+	rules     []*rule
+	notifiers []Notifier
+	interval  time.Duration
+	buffer    int
+	now       func() time.Time
+
+	mu     sync.Mutex
+	states map[string]*state
+	sent   map[string]sentRecord // fingerprint -> 最近一次 firing 通知，恢复后仍保留到 Dedup 结束
+}
+
+type state struct {
+	rule     *rule
+	alert    Alert
+	notified bool // 本次告警是否已通知，未通知的告警恢复时也不通知
+}
+
+type sentRecord struct {
+	at    time.Time
+	dedup time.Duration
+}
+
+// New 根据配置创建 Engine，加载规则文件并创建 notifier
+func New(config Config) (*Engine, error) {
+	rules := append([]Rule{}, config.Rules...)
+	for _, path := range config.RuleFiles {
+		fileRules, err := LoadRules(path)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, fileRules...)
+	}
+
+	var notifiers []Notifier
+	for _, nc := range config.Notifiers {
+		n, err := NewNotifier(nc)
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, n)
+	}
+	if len(notifiers) == 0 {
+		notifiers = append(notifiers, NewLogNotifier())
+	}
+
+	e, err := NewEngine(rules, notifiers...)
+	if err != nil {
+		return nil, err
+	}
+	if config.Interval > 0 {
+		e.interval = config.Interval
+	}
+	if config.Buffer > 0 {
+		e.buffer = config.Buffer
+	}
+	return e, nil
+}
+
+// NewEngine 编译规则，规则名不能重复
+func NewEngine(rules []Rule, notifiers ...Notifier) (*Engine, error) {
+	e := &Engine{
+		notifiers: notifiers,
+		interval:  DefaultInterval,
+		buffer:    1024,
+		now:       time.Now,
+		states:    make(map[string]*state),
+		sent:      make(map[string]sentRecord),
+	}
+	names := make(map[string]bool, len(rules))
+	for _, r := range rules {
+		if names[r.Name] {
+			return nil, fmt.Errorf("duplicate alert rule %s", r.Name)
+		}
+		names[r.Name] = true
+		c, err := compile(r)
+		if err != nil {
+			return nil, err
+		}
+		e.rules = append(e.rules, c)
+	}
+	return e, nil
+}
+
+// Run 订阅事件并求值，消费过慢被断开时重新订阅，直到 ctx 结束
+func (e *Engine) Run(ctx context.Context, source Source) {
+	alerts := make(chan []Alert, 100)
+	defer close(alerts)
+	go func() {
+		for batch := range alerts {
+			e.Notify(ctx, batch)
+		}
+	}()
+	send := func(batch []Alert) {
+		if len(batch) == 0 {
+			return
+		}
+		select {
+		case alerts <- batch:
+		default:
+			klog.Warningf("alert notify queue is full, drop %d alerts", len(batch))
+		}
+	}
+
+	sub := source.Subscribe(stream.Filter{}, e.buffer)
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			source.Unsubscribe(sub)
+			return
+		case obj, ok := <-sub.C:
+			if !ok {
+				klog.Warning("alert subscriber is disconnected, subscribe again")
+				sub = source.Subscribe(stream.Filter{}, e.buffer)
+				continue
+			}
+			send(e.Process(obj))
+		case <-ticker.C:
+			send(e.Tick())
+		}
+	}
+}
+
+// Notify 发送给所有 notifier，错误只记录日志
+func (e *Engine) Notify(ctx context.Context, alerts []Alert) {
+	for _, a := range alerts {
+		metrics.ObserveAlert(a.Rule, a.Severity, a.Status)
+	}
+	for _, n := range e.notifiers {
+		if err := n.Notify(ctx, alerts); err != nil {
+			klog.Errorf("alert notifier %s error: %v", n.Name(), err)
+		}
+	}
+}
+
+// Process 对一个事件求值，返回需要通知的告警
+func (e *Engine) Process(obj queue.QueueObject) []Alert {
+	object, err := resource.ToUnstructured(obj.Obj)
+	if err != nil {
+		klog.Error("alert convert object error: ", err)
+		return nil
+	}
+	now := e.now()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var out []Alert
+	for _, r := range e.rules {
+		if !r.inScope(obj) {
+			continue
+		}
+		fp := fingerprint(r.Name, obj.ClusterName, obj.ResourceType, obj.Key)
+		st := e.states[fp]
+
+		matched, err := r.match(obj, object)
+		if err != nil {
+			klog.V(2).Infof("alert rule %s on %s %s error: %v", r.Name, obj.ClusterName, obj.Key, err)
+		}
+		if obj.Event == resource.EventDelete && !r.fireOnDelete() {
+			// 对象已删除，告警恢复
+			matched = false
+		}
+		if !matched {
+			if st != nil {
+				delete(e.states, fp)
+				if st.notified {
+					out = append(out, resolve(st.alert, now))
+				}
+			}
+			continue
+		}
+
+		if st == nil {
+			st = &state{rule: r, alert: Alert{Fingerprint: fp, Rule: r.Name, Severity: r.Severity, ActiveAt: now}}
+			e.states[fp] = st
+		}
+		st.update(obj, object)
+
+		if obj.Event == resource.EventDelete {
+			// 对象已删除，不会再有事件，不等待 For，立即告警一次
+			delete(e.states, fp)
+			if a, ok := e.fire(st, now, true); ok {
+				out = append(out, a)
+			}
+			continue
+		}
+		if a, ok := e.fire(st, now, false); ok {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+// Tick 检查 pending 的告警是否满足 For，firing 的告警是否需要重复通知
+func (e *Engine) Tick() []Alert {
+	now := e.now()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var out []Alert
+	for _, st := range e.states {
+		if a, ok := e.fire(st, now, false); ok {
+			out = append(out, a)
+		}
+	}
+	for fp, record := range e.sent {
+		if _, ok := e.states[fp]; !ok && now.Sub(record.at) >= record.dedup {
+			delete(e.sent, fp)
+		}
+	}
+	sortAlerts(out)
+	return out
+}
+
+// Alerts 当前 pending 与 firing 的告警，pending 的 Status 为空
+func (e *Engine) Alerts() []Alert {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	alerts := make([]Alert, 0, len(e.states))
+	for _, st := range e.states {
+		alerts = append(alerts, st.alert)
+	}
+	sortAlerts(alerts)
+	return alerts
+}
+
+// next 下一次需要 Tick 的时间，用于测试
+func (e *Engine) next() (time.Time, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var next time.Time
+	for fp, st := range e.states {
+		var due time.Time
+		switch {
+		case st.alert.StartsAt.IsZero():
+			due = st.alert.ActiveAt.Add(st.rule.For)
+		case st.rule.Dedup > 0:
+			record, ok := e.sent[fp]
+			if !ok {
+				record.at = st.alert.StartsAt
+			}
+			due = record.at.Add(st.rule.Dedup)
+		default:
+			continue
+		}
+		if next.IsZero() || due.Before(next) {
+			next = due
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// fire 满足 For 后告警，返回需要通知的告警；force 时不检查 For
+// 调用时需持有锁
+func (e *Engine) fire(st *state, now time.Time, force bool) (Alert, bool) {
+	r := st.rule
+	if !force && now.Sub(st.alert.ActiveAt) < r.For {
+		return Alert{}, false
+	}
+	if st.alert.StartsAt.IsZero() {
+		st.alert.StartsAt = now
+		st.alert.Status = StatusFiring
+	}
+
+	record, sent := e.sent[st.alert.Fingerprint]
+	switch {
+	case !sent:
+	case r.Dedup <= 0:
+		// 不去重，每次告警通知一次
+		if st.notified {
+			return Alert{}, false
+		}
+	case now.Sub(record.at) < r.Dedup:
+		return Alert{}, false
+	}
+	st.notified = true
+	e.sent[st.alert.Fingerprint] = sentRecord{at: now, dedup: r.Dedup}
+	return st.alert, true
+}
+
+// update 使用最新的对象更新告警内容
+func (st *state) update(obj queue.QueueObject, object map[string]interface{}) {
+	a := &st.alert
+	a.Cluster, a.Resource, a.Key, a.Event = obj.ClusterName, obj.ResourceType, obj.Key, obj.Event
+	a.Namespace, a.Name, _ = strings.Cut(obj.Key, "/")
+	if a.Name == "" {
+		a.Namespace, a.Name = "", a.Namespace
+	}
+
+	a.Labels = map[string]string{
+		"alertname": st.rule.Name,
+		"severity":  st.rule.Severity,
+		"cluster":   a.Cluster,
+		"resource":  a.Resource,
+		"name":      a.Name,
+	}
+	if a.Namespace != "" {
+		a.Labels["namespace"] = a.Namespace
+	}
+	for k, v := range st.rule.Labels {
+		a.Labels[k] = v
+	}
+	a.Summary, a.Annotations = st.rule.render(templateData{
+		Cluster:   a.Cluster,
+		Resource:  a.Resource,
+		Namespace: a.Namespace,
+		Name:      a.Name,
+		Key:       a.Key,
+		Event:     a.Event,
+		Object:    object,
+		Labels:    a.Labels,
+	})
+}
+
+func resolve(a Alert, now time.Time) Alert {
+	a.Status = StatusResolved
+	a.EndsAt = &now
+	return a
+}
+
+func fingerprint(rule, cluster, rType, key string) string {
+	return strings.Join([]string{rule, cluster, rType, key}, "/")
+}
+
+func sortAlerts(alerts []Alert) {
+	sort.Slice(alerts, func(i, j int) bool {
+		return alerts[i].Fingerprint < alerts[j].Fingerprint
+	})
+}
@@ -0,0 +1,107 @@
+package alert
+
+import (
+	"testing"
+	"time"
+
+	"multiple-k8s-informer/queue"
+	"multiple-k8s-informer/resource"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func crashingPod(reason string) *v1.Pod {
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", Labels: map[string]string{"app.kubernetes.io/name": "web"}}}
+	pod.Status.ContainerStatuses = []v1.ContainerStatus{{Name: "c"}}
+	if reason != "" {
+		pod.Status.ContainerStatuses[0].State.Waiting = &v1.ContainerStateWaiting{Reason: reason}
+	}
+	return pod
+}
+
+func TestEngine(t *testing.T) {
+	e, err := NewEngine([]Rule{{
+		Name:      "crashloop",
+		Resources: []string{resource.Pods},
+		Fields: map[string]string{
+			"status.containerStatuses.*.state.waiting.reason": "CrashLoopBackOff",
+			"metadata.labels[app.kubernetes.io/name]":         "web",
+		},
+		For:   time.Minute,
+		Dedup: 10 * time.Minute,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	e.now = func() time.Time { return now }
+	event := func(reason string) queue.QueueObject {
+		return queue.QueueObject{ClusterName: "c1", ResourceType: resource.Pods, Event: resource.EventUpdate, Key: "default/web", Obj: crashingPod(reason)}
+	}
+	expectNext := func(want time.Time) {
+		t.Helper()
+		next, ok := e.next()
+		if ok != !want.IsZero() || !next.Equal(want) {
+			t.Fatalf("next() = %v %v, want %v", next, ok, want)
+		}
+	}
+
+	if alerts := e.Process(event("CrashLoopBackOff")); len(alerts) != 0 {
+		t.Fatalf("pending alert notified: %v", alerts)
+	}
+	expectNext(start.Add(time.Minute))
+
+	now = start.Add(30 * time.Second)
+	if alerts := e.Tick(); len(alerts) != 0 {
+		t.Fatalf("alert fired before For: %v", alerts)
+	}
+
+	now = start.Add(time.Minute)
+	alerts := e.Tick()
+	if len(alerts) != 1 || alerts[0].Status != StatusFiring || alerts[0].Labels["namespace"] != "default" {
+		t.Fatalf("Tick() = %v, want one firing alert", alerts)
+	}
+	expectNext(now.Add(10 * time.Minute))
+
+	now = now.Add(time.Minute)
+	alerts = e.Process(event(""))
+	if len(alerts) != 1 || alerts[0].Status != StatusResolved {
+		t.Fatalf("Process() = %v, want one resolved alert", alerts)
+	}
+	expectNext(time.Time{})
+}
+
+func TestCompileFields(t *testing.T) {
+	tests := []struct {
+		path    string
+		value   string
+		reason  string
+		match   bool
+		wantErr bool
+	}{
+		{"status.containerStatuses.*.state.waiting.reason", "CrashLoopBackOff", "CrashLoopBackOff", true, false},
+		{"status.containerStatuses.0.state.waiting.reason", "CrashLoopBackOff", "CrashLoopBackOff", true, false},
+		{"status.containerStatuses.*.state.waiting.reason", "CrashLoopBackOff", "", false, false},
+		{"status.containerStatuses.state.waiting.reason", "CrashLoopBackOff", "CrashLoopBackOff", false, false},
+		{"metadata.labels[app.kubernetes.io/name]", "web", "", true, false},
+		{"metadata.labels[app", "web", "", false, true},
+		{"", "web", "", false, true},
+	}
+	for _, tt := range tests {
+		r, err := compile(Rule{Name: "r", Fields: map[string]string{tt.path: tt.value}})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("compile %q: error = %v, want error %v", tt.path, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		obj := queue.QueueObject{Event: resource.EventUpdate, Obj: crashingPod(tt.reason)}
+		object, _ := resource.ToUnstructured(obj.Obj)
+		if matched, _ := r.match(obj, object); matched != tt.match {
+			t.Errorf("%q = %q with reason %q: match = %v, want %v", tt.path, tt.value, tt.reason, matched, tt.match)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package alert
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"multiple-k8s-informer/queue"
+	"multiple-k8s-informer/resource"
+
+	"github.com/go-yaml/yaml"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/tools/cache"
+)
+
+// TestFile 规则测试文件，不需要连接集群，按时间顺序放入事件，检查发出的通知
+//
+//	ruleFiles: [rules.yaml]   # 相对于测试文件所在目录
+//	tests:
+//	  - name: crashloop
+//	    events:
+//	      - at: 0s
+//	        cluster: prod
+//	        resource: pods
+//	        event: update
+//	        object: {metadata: {name: web-0, namespace: default}, status: {...}}
+//	    evalTime: 10m
+//	    alerts:
+//	      - at: 2m
+//	        rule: PodCrashLooping
+//	        status: firing
+//	        key: default/web-0
+type TestFile struct {
+	RuleFiles []string   `json:"ruleFiles" yaml:"ruleFiles"`
+	Rules     []Rule     `json:"rules" yaml:"rules"`
+	Tests     []TestCase `json:"tests" yaml:"tests"`
+}
+
+// TestCase 一个测试用例，每个用例使用新的 Engine
+type TestCase struct {
+	Name     string          `json:"name" yaml:"name"`
+	Events   []TestEvent     `json:"events" yaml:"events"`
+	EvalTime time.Duration   `json:"evalTime" yaml:"evalTime"` // 检查到该时间为止，默认为最后一个事件的时间
+	Alerts   []ExpectedAlert `json:"alerts" yaml:"alerts"`     // 期望按顺序发出的全部通知
+}
+
+// TestEvent 在 At 时放入的事件
+type TestEvent struct {
+	At       time.Duration          `json:"at" yaml:"at"`
+	Cluster  string                 `json:"cluster" yaml:"cluster"`
+	Resource string                 `json:"resource" yaml:"resource"`
+	Event    string                 `json:"event" yaml:"event"` // 默认 update
+	Object   map[string]interface{} `json:"object" yaml:"object"`
+}
+
+// ExpectedAlert 期望的通知，为空的字段不检查
+type ExpectedAlert struct {
+	At       *time.Duration `json:"at" yaml:"at"`
+	Rule     string         `json:"rule" yaml:"rule"`
+	Status   string         `json:"status" yaml:"status"` // 默认 firing
+	Severity string         `json:"severity" yaml:"severity"`
+	Cluster  string         `json:"cluster" yaml:"cluster"`
+	Key      string         `json:"key" yaml:"key"`
+	Summary  string         `json:"summary" yaml:"summary"`
+}
+
+// TestAlert 测试中发出的通知，At 为相对于测试开始的时间
+type TestAlert struct {
+	At time.Duration
+	Alert
+}
+
+func (a TestAlert) String() string {
+	return fmt.Sprintf("at %s %s %s %s/%s %s: %s", a.At, a.Status, a.Rule, a.Cluster, a.Resource, a.Key, a.Summary)
+}
+
+// TestResult 测试结果
+type TestResult struct {
+	Name     string
+	Alerts   []TestAlert
+	Failures []string
+}
+
+func (r TestResult) Passed() bool {
+	return len(r.Failures) == 0
+}
+
+// LoadTestFile 加载测试文件与其中引用的规则文件
+func LoadTestFile(path string) (*TestFile, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file TestFile
+	if err := yaml.Unmarshal(b, &file); err != nil {
+		return nil, fmt.Errorf("parse test file %s: %w", path, err)
+	}
+	for _, ruleFile := range file.RuleFiles {
+		if !filepath.IsAbs(ruleFile) {
+			ruleFile = filepath.Join(filepath.Dir(path), ruleFile)
+		}
+		rules, err := LoadRules(ruleFile)
+		if err != nil {
+			return nil, err
+		}
+		file.Rules = append(file.Rules, rules...)
+	}
+	return &file, nil
+}
+
+// RunTestFile 运行测试文件中的所有用例
+func RunTestFile(path string) ([]TestResult, error) {
+	file, err := LoadTestFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return RunTests(file.Rules, file.Tests)
+}
+
+// RunTests 规则有错误时返回错误，否则返回每个用例的结果
+func RunTests(rules []Rule, tests []TestCase) ([]TestResult, error) {
+	if _, err := NewEngine(rules); err != nil {
+		return nil, err
+	}
+	results := make([]TestResult, 0, len(tests))
+	for _, test := range tests {
+		results = append(results, runTest(rules, test))
+	}
+	return results, nil
+}
+
+func runTest(rules []Rule, test TestCase) TestResult {
+	result := TestResult{Name: test.Name}
+	e, _ := NewEngine(rules)
+	start := time.Unix(0, 0).UTC()
+	clock := start
+	e.now = func() time.Time { return clock }
+
+	record := func(alerts []Alert) {
+		for _, a := range alerts {
+			result.Alerts = append(result.Alerts, TestAlert{At: clock.Sub(start), Alert: a})
+		}
+	}
+	// advance 依次执行 to 之前到期的 Tick
+	advance := func(to time.Duration) {
+		for i := 0; i < 10000; i++ {
+			next, ok := e.next()
+			if !ok || next.After(start.Add(to)) {
+				break
+			}
+			if next.After(clock) {
+				clock = next
+			}
+			record(e.Tick())
+		}
+		clock = start.Add(to)
+	}
+
+	events := append([]TestEvent{}, test.Events...)
+	sort.SliceStable(events, func(i, j int) bool { return events[i].At < events[j].At })
+	evalTime := test.EvalTime
+	for i, event := range events {
+		obj, err := testObject(event)
+		if err != nil {
+			result.Failures = append(result.Failures, fmt.Sprintf("event %d: %v", i, err))
+			return result
+		}
+		advance(event.At)
+		record(e.Process(obj))
+		if event.At > evalTime {
+			evalTime = event.At
+		}
+	}
+	advance(evalTime)
+	record(e.Tick())
+
+	result.Failures = compareAlerts(test.Alerts, result.Alerts)
+	return result
+}
+
+func testObject(event TestEvent) (queue.QueueObject, error) {
+	if event.Event == "" {
+		event.Event = resource.EventUpdate
+	}
+	u := &unstructured.Unstructured{Object: normalize(event.Object).(map[string]interface{})}
+	key, err := cache.MetaNamespaceKeyFunc(u)
+	if err != nil {
+		return queue.QueueObject{}, err
+	}
+	return queue.QueueObject{ClusterName: event.Cluster, ResourceType: event.Resource, Event: event.Event, Key: key, Obj: u}, nil
+}
+
+func compareAlerts(expected []ExpectedAlert, got []TestAlert) []string {
+	var failures []string
+	for i, want := range expected {
+		if i >= len(got) {
+			failures = append(failures, fmt.Sprintf("alert %d: want %s %s, got nothing", i, status(want), want.Rule))
+			continue
+		}
+		a := got[i]
+		check := func(field, want, got string) {
+			if want != "" && want != got {
+				failures = append(failures, fmt.Sprintf("alert %d: %s want %q, got %q", i, field, want, got))
+			}
+		}
+		check("rule", want.Rule, a.Rule)
+		check("status", status(want), a.Status)
+		check("severity", want.Severity, a.Severity)
+		check("cluster", want.Cluster, a.Cluster)
+		check("key", want.Key, a.Key)
+		check("summary", want.Summary, a.Summary)
+		if want.At != nil && *want.At != a.At {
+			failures = append(failures, fmt.Sprintf("alert %d: at want %s, got %s", i, *want.At, a.At))
+		}
+	}
+	for i := len(expected); i < len(got); i++ {
+		failures = append(failures, fmt.Sprintf("unexpected alert %d: %s", i, got[i]))
+	}
+	return failures
+}
+
+func status(want ExpectedAlert) string {
+	if want.Status == "" {
+		return StatusFiring
+	}
+	return want.Status
+}
+
+// normalize 将 yaml 解析出的 map[interface{}]interface{} 转换为 map[string]interface{}，整数转换为 int64
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, child := range v {
+			m[fmt.Sprint(k)] = normalize(child)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, child := range v {
+			m[k] = normalize(child)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(v))
+		for i, child := range v {
+			l[i] = normalize(child)
+		}
+		return l
+	case int:
+		return int64(v)
+	}
+	return value
+}
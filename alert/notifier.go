@@ -0,0 +1,211 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"multiple-k8s-informer/sink"
+
+	"k8s.io/klog"
+)
+
+// DefaultNotifyTimeout 默认请求超时时间
+const DefaultNotifyTimeout = 10 * time.Second
+
+// notifier 类型
+const (
+	NotifierLog          = "log"
+	NotifierWebhook      = "webhook"
+	NotifierAlertmanager = "alertmanager"
+)
+
+// Notifier 发送告警，firing 与 resolved 的告警都会发送
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, alerts []Alert) error
+}
+
+// NotifierConfig notifier 配置
+type NotifierConfig struct {
+	Name       string            `json:"name" yaml:"name"`
+	Type       string            `json:"type" yaml:"type"`             // log / webhook / alertmanager
+	URL        string            `json:"url" yaml:"url"`               // webhook 地址，或 alertmanager 地址如 http://alertmanager:9093
+	Secret     string            `json:"secret" yaml:"secret"`         // webhook 签名，同 webhook handler
+	Headers    map[string]string `json:"headers" yaml:"headers"`       // 如 Authorization
+	Timeout    time.Duration     `json:"timeout" yaml:"timeout"`       // 请求超时时间，默认 10s
+	Severities []string          `json:"severities" yaml:"severities"` // 只发送这些级别的告警，为空表示全部
+}
+
+// NewNotifier 根据配置创建 notifier
+func NewNotifier(config NotifierConfig) (Notifier, error) {
+	if config.Name == "" {
+		config.Name = config.Type
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultNotifyTimeout
+	}
+
+	var n Notifier
+	switch config.Type {
+	case NotifierLog:
+		n = &LogNotifier{name: config.Name}
+	case NotifierWebhook, NotifierAlertmanager:
+		if config.URL == "" {
+			return nil, fmt.Errorf("alert notifier %s url is empty", config.Name)
+		}
+		if config.Type == NotifierWebhook {
+			n = &WebhookNotifier{config: config, client: &http.Client{Timeout: config.Timeout}}
+		} else {
+			n = &AlertmanagerNotifier{config: config, client: &http.Client{Timeout: config.Timeout}}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported alert notifier type %q", config.Type)
+	}
+	if len(config.Severities) > 0 {
+		n = &severityNotifier{Notifier: n, severities: config.Severities}
+	}
+	return n, nil
+}
+
+// severityNotifier 只发送指定级别的告警
+type severityNotifier struct {
+	Notifier
+	severities []string
+}
+
+func (n *severityNotifier) Notify(ctx context.Context, alerts []Alert) error {
+	var filtered []Alert
+	for _, a := range alerts {
+		if slices.Contains(n.severities, a.Severity) {
+			filtered = append(filtered, a)
+		}
+	}
+	if len(filtered) == 0 {
+		return nil
+	}
+	return n.Notifier.Notify(ctx, filtered)
+}
+
+// LogNotifier 输出到日志
+type LogNotifier struct {
+	name string
+}
+
+func NewLogNotifier() *LogNotifier {
+	return &LogNotifier{name: NotifierLog}
+}
+
+func (n *LogNotifier) Name() string {
+	return n.name
+}
+
+func (n *LogNotifier) Notify(_ context.Context, alerts []Alert) error {
+	for _, a := range alerts {
+		msg := fmt.Sprintf("[alert] %s %s %s cluster=%s %s/%s: %s", a.Status, a.Severity, a.Rule, a.Cluster, a.Resource, a.Key, a.Summary)
+		if a.Status == StatusFiring && a.Severity == SeverityCritical {
+			klog.Warning(msg)
+		} else {
+			klog.Info(msg)
+		}
+	}
+	return nil
+}
+
+// WebhookNotifier 以 JSON POST {"alerts": [...]}，Secret 不为空时签名方式同 webhook handler
+type WebhookNotifier struct {
+	config NotifierConfig
+	client *http.Client
+}
+
+func (n *WebhookNotifier) Name() string {
+	return n.config.Name
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, alerts []Alert) error {
+	body, err := json.Marshal(map[string][]Alert{"alerts": alerts})
+	if err != nil {
+		return err
+	}
+	header := http.Header{}
+	if n.config.Secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		header.Set(sink.HeaderTimestamp, timestamp)
+		header.Set(sink.HeaderSignature, sink.Sign(n.config.Secret, timestamp, body))
+	}
+	return post(ctx, n.client, n.config.URL, n.config.Headers, header, body)
+}
+
+// AlertmanagerNotifier 发送到 Alertmanager 的 /api/v2/alerts
+// firing 的告警没有 endsAt，由 Alertmanager 的 resolve_timeout 决定恢复时间，需要 Dedup 小于 resolve_timeout 持续刷新
+type AlertmanagerNotifier struct {
+	config NotifierConfig
+	client *http.Client
+}
+
+// alertmanagerAlert Alertmanager API 的告警格式
+type alertmanagerAlert struct {
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       *time.Time        `json:"endsAt,omitempty"`
+	GeneratorURL string            `json:"generatorURL,omitempty"`
+}
+
+func (n *AlertmanagerNotifier) Name() string {
+	return n.config.Name
+}
+
+func (n *AlertmanagerNotifier) Notify(ctx context.Context, alerts []Alert) error {
+	payload := make([]alertmanagerAlert, 0, len(alerts))
+	for _, a := range alerts {
+		payload = append(payload, alertmanagerAlert{
+			Labels:      a.Labels,
+			Annotations: a.Annotations,
+			StartsAt:    a.StartsAt,
+			EndsAt:      a.EndsAt,
+		})
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	url := strings.TrimSuffix(n.config.URL, "/")
+	if !strings.HasSuffix(url, "/api/v2/alerts") {
+		url += "/api/v2/alerts"
+	}
+	return post(ctx, n.client, url, n.config.Headers, nil, body)
+}
+
+func post(ctx context.Context, client *http.Client, url string, headers map[string]string, header http.Header, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s returned %d: %s", url, resp.StatusCode, bytes.TrimSpace(msg))
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package alert
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"slices"
+	"text/template"
+	"time"
+
+	"multiple-k8s-informer/controller"
+	"multiple-k8s-informer/diff"
+	"multiple-k8s-informer/queue"
+	"multiple-k8s-informer/resource"
+	"multiple-k8s-informer/stream"
+
+	"github.com/go-yaml/yaml"
+)
+
+// 告警级别
+const (
+	SeverityCritical = "critical"
+	SeverityWarning  = "warning"
+	SeverityInfo     = "info"
+)
+
+// Rule 告警规则，匹配条件都满足时告警，为空的条件表示不限制
+type Rule struct {
+	Name        string            `json:"name" yaml:"name"`
+	Severity    string            `json:"severity" yaml:"severity"` // critical / warning / info，默认 warning
+	Clusters    []string          `json:"clusters" yaml:"clusters"`
+	Resources   []string          `json:"resources" yaml:"resources"`
+	Namespaces  []string          `json:"namespaces" yaml:"namespaces"`
+	Events      []string          `json:"events" yaml:"events"`           // add / update / delete，包含 delete 时删除事件立即告警一次，否则删除事件使告警恢复
+	Fields      map[string]string `json:"fields" yaml:"fields"`           // 字段 -> 值，语法同 diff.ignore，* 匹配任意数组元素或 key，数字匹配数组下标，如 status.containerStatuses.*.state.waiting.reason
+	Expr        string            `json:"expr" yaml:"expr"`               // CEL 表达式，变量同 filter，oldObject 为空 map
+	For         time.Duration     `json:"for" yaml:"for"`                 // 持续满足多久后告警，0 表示立即告警
+	Dedup       time.Duration     `json:"dedup" yaml:"dedup"`             // 告警期间每隔多久重复通知，恢复后该时间内再次告警不通知；0 表示每次告警只通知一次
+	Summary     string            `json:"summary" yaml:"summary"`         // 告警摘要，text/template，可用 .Cluster .Resource .Namespace .Name .Key .Event .Object .Labels
+	Labels      map[string]string `json:"labels" yaml:"labels"`           // 附加的 label
+	Annotations map[string]string `json:"annotations" yaml:"annotations"` // 附加的 annotation，同 Summary 为 text/template
+}
+
+// RuleFile 规则文件
+type RuleFile struct {
+	Rules []Rule `json:"rules" yaml:"rules"`
+}
+
+// LoadRules 从 YAML 文件加载规则
+func LoadRules(path string) ([]Rule, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file RuleFile
+	if err := yaml.Unmarshal(b, &file); err != nil {
+		return nil, fmt.Errorf("parse rule file %s: %w", path, err)
+	}
+	return file.Rules, nil
+}
+
+// rule 编译后的规则
+type rule struct {
+	Rule
+	scope       stream.Filter
+	events      []string
+	fields      []fieldMatcher
+	filter      *controller.Filter
+	summary     *template.Template
+	annotations map[string]*template.Template
+}
+
+type fieldMatcher struct {
+	path  []string
+	value string
+}
+
+func compile(r Rule) (*rule, error) {
+	if r.Name == "" {
+		return nil, errors.New("alert rule name is empty")
+	}
+	if r.Severity == "" {
+		r.Severity = SeverityWarning
+	}
+	c := &rule{
+		Rule:        r,
+		scope:       stream.Filter{Clusters: r.Clusters, Resources: r.Resources, Namespaces: r.Namespaces},
+		events:      r.Events,
+		annotations: make(map[string]*template.Template, len(r.Annotations)),
+	}
+	for path, value := range r.Fields {
+		segments, err := diff.ParsePath(path)
+		if err != nil {
+			return nil, fmt.Errorf("alert rule %s: %w", r.Name, err)
+		}
+		c.fields = append(c.fields, fieldMatcher{path: segments, value: value})
+	}
+	if r.Expr != "" {
+		filter, err := controller.NewFilter(r.Expr)
+		if err != nil {
+			return nil, fmt.Errorf("alert rule %s: %w", r.Name, err)
+		}
+		c.filter = filter
+	}
+
+	var err error
+	summary := r.Summary
+	if summary == "" {
+		summary = "{{.Resource}} {{.Key}} in cluster {{.Cluster}} matches rule " + r.Name
+	}
+	if c.summary, err = parseTemplate(r.Name, summary); err != nil {
+		return nil, err
+	}
+	for name, text := range r.Annotations {
+		if c.annotations[name], err = parseTemplate(r.Name, text); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func parseTemplate(name, text string) (*template.Template, error) {
+	t, err := template.New(name).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("alert rule %s: %w", name, err)
+	}
+	return t, nil
+}
+
+// inScope 对象是否属于规则的集群、资源与 namespace
+func (r *rule) inScope(obj queue.QueueObject) bool {
+	return r.scope.Match(obj)
+}
+
+// fireOnDelete 规则是否显式匹配 delete 事件
+func (r *rule) fireOnDelete() bool {
+	return slices.Contains(r.events, resource.EventDelete)
+}
+
+// match 事件与对象是否满足规则
+func (r *rule) match(obj queue.QueueObject, object map[string]interface{}) (bool, error) {
+	if len(r.events) > 0 && !slices.Contains(r.events, obj.Event) {
+		return false, nil
+	}
+	for _, field := range r.fields {
+		if !matchField(object, field.path, field.value) {
+			return false, nil
+		}
+	}
+	if r.filter != nil {
+		return r.filter.Match(obj.ClusterName, obj.ResourceType, obj.Event, nil, obj.Obj)
+	}
+	return true, nil
+}
+
+// templateData 模板中可用的数据
+type templateData struct {
+	Cluster   string
+	Resource  string
+	Namespace string
+	Name      string
+	Key       string
+	Event     string
+	Object    map[string]interface{}
+	Labels    map[string]string
+}
+
+func (r *rule) render(data templateData) (summary string, annotations map[string]string) {
+	summary = execute(r.summary, data)
+	annotations = make(map[string]string, len(r.annotations)+1)
+	for name, t := range r.annotations {
+		annotations[name] = execute(t, data)
+	}
+	annotations["summary"] = summary
+	return
+}
+
+func execute(t *template.Template, data templateData) string {
+	var b bytes.Buffer
+	if err := t.Execute(&b, data); err != nil {
+		return fmt.Sprintf("<template error: %v>", err)
+	}
+	return b.String()
+}
+
+// matchField path 对应的任意一个值匹配即可，字段为 null 时匹配空字符串
+func matchField(value interface{}, path []string, expected string) bool {
+	values, err := diff.Lookup(value, path)
+	if err != nil {
+		return false
+	}
+	for _, v := range values {
+		if v == nil && expected == "" || v != nil && fmt.Sprint(v) == expected {
+			return true
+		}
+	}
+	return false
+}
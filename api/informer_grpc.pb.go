@@ -0,0 +1,182 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.4.0
+// - protoc             (unknown)
+// source: informer.proto
+
+// 多集群 informer 的 gRPC 接口，数据来自 Controller 的 Store 与事件流
+
+package api
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.62.0 or later.
+const _ = grpc.SupportPackageIsVersion8
+
+const (
+	Informer_List_FullMethodName  = "/informer.v1.Informer/List"
+	Informer_Watch_FullMethodName = "/informer.v1.Informer/Watch"
+)
+
+// InformerClient is the client API for Informer service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type InformerClient interface {
+	// List 列出缓存中的资源对象
+	List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListResponse, error)
+	// Watch 先返回一份一致的快照(SNAPSHOT ... SYNCED)，之后持续返回增量事件
+	Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (Informer_WatchClient, error)
+}
+
+type informerClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewInformerClient(cc grpc.ClientConnInterface) InformerClient {
+	return &informerClient{cc}
+}
+
+func (c *informerClient) List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListResponse)
+	err := c.cc.Invoke(ctx, Informer_List_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *informerClient) Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (Informer_WatchClient, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Informer_ServiceDesc.Streams[0], Informer_Watch_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &informerWatchClient{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Informer_WatchClient interface {
+	Recv() (*WatchEvent, error)
+	grpc.ClientStream
+}
+
+type informerWatchClient struct {
+	grpc.ClientStream
+}
+
+func (x *informerWatchClient) Recv() (*WatchEvent, error) {
+	m := new(WatchEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// InformerServer is the server API for Informer service.
+// All implementations must embed UnimplementedInformerServer
+// for forward compatibility
+type InformerServer interface {
+	// List 列出缓存中的资源对象
+	List(context.Context, *ListRequest) (*ListResponse, error)
+	// Watch 先返回一份一致的快照(SNAPSHOT ... SYNCED)，之后持续返回增量事件
+	Watch(*WatchRequest, Informer_WatchServer) error
+	mustEmbedUnimplementedInformerServer()
+}
+
+// UnimplementedInformerServer must be embedded to have forward compatible implementations.
+type UnimplementedInformerServer struct {
+}
+
+func (UnimplementedInformerServer) List(context.Context, *ListRequest) (*ListResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method List not implemented")
+}
+func (UnimplementedInformerServer) Watch(*WatchRequest, Informer_WatchServer) error {
+	return status.Errorf(codes.Unimplemented, "method Watch not implemented")
+}
+func (UnimplementedInformerServer) mustEmbedUnimplementedInformerServer() {}
+
+// UnsafeInformerServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to InformerServer will
+// result in compilation errors.
+type UnsafeInformerServer interface {
+	mustEmbedUnimplementedInformerServer()
+}
+
+func RegisterInformerServer(s grpc.ServiceRegistrar, srv InformerServer) {
+	s.RegisterService(&Informer_ServiceDesc, srv)
+}
+
+func _Informer_List_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(InformerServer).List(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Informer_List_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(InformerServer).List(ctx, req.(*ListRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Informer_Watch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(InformerServer).Watch(m, &informerWatchServer{ServerStream: stream})
+}
+
+type Informer_WatchServer interface {
+	Send(*WatchEvent) error
+	grpc.ServerStream
+}
+
+type informerWatchServer struct {
+	grpc.ServerStream
+}
+
+func (x *informerWatchServer) Send(m *WatchEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// Informer_ServiceDesc is the grpc.ServiceDesc for Informer service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Informer_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "informer.v1.Informer",
+	HandlerType: (*InformerServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "List",
+			Handler:    _Informer_List_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Watch",
+			Handler:       _Informer_Watch_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "informer.proto",
+}
@@ -0,0 +1,296 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+
+	"multiple-k8s-informer/controller"
+	"multiple-k8s-informer/queue"
+	"multiple-k8s-informer/resource"
+	"multiple-k8s-informer/stream"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/klog"
+)
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative informer.proto
+
+// Config gRPC 服务配置
+type Config struct {
+	Enabled       bool   `json:"enabled" yaml:"enabled"`
+	Addr          string `json:"addr" yaml:"addr"`                   // 监听地址，默认 :9090
+	ExposeSecrets bool   `json:"exposeSecrets" yaml:"exposeSecrets"` // 是否允许查询 secrets
+	WatchBuffer   int    `json:"watchBuffer" yaml:"watchBuffer"`     // 每个 Watch 的缓冲区大小，满了断开，默认 256
+}
+
+// Service 实现 InformerServer，List 读取 ClusterStore，Watch 订阅事件流
+type Service struct {
+	UnimplementedInformerServer
+	config   Config
+	informer controller.MultiClusterInformer
+}
+
+var _ InformerServer = &Service{}
+
+func NewService(config Config, informer controller.MultiClusterInformer) *Service {
+	return &Service{config: config, informer: informer}
+}
+
+func (s *Service) List(ctx context.Context, req *ListRequest) (*ListResponse, error) {
+	selector, err := s.check(req.GetResource(), req.GetLabelSelector())
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &ListResponse{}
+	for _, cluster := range s.clusters(req.GetClusters()) {
+		items, err := s.snapshot(cluster, req.GetResource(), req.GetNamespace(), selector)
+		if err != nil {
+			return nil, err
+		}
+		resp.Items = append(resp.Items, items...)
+	}
+	return resp, nil
+}
+
+// Watch 先订阅事件流再读取快照，informer 在更新 indexer 之后才把对象放入队列，
+// 因此快照之后的变更一定会出现在订阅中；订阅中 resourceVersion 不比快照新的变更会被跳过
+func (s *Service) Watch(req *WatchRequest, srv Informer_WatchServer) error {
+	selector, err := s.check(req.GetResource(), req.GetLabelSelector())
+	if err != nil {
+		return err
+	}
+
+	filter := stream.Filter{Clusters: req.GetClusters(), Events: req.GetEvents()}
+	if req.GetResource() != resource.All {
+		filter.Resources = []string{req.GetResource()}
+	}
+	if !s.config.ExposeSecrets {
+		filter.Exclude = []string{resource.Secrets}
+	}
+	if req.GetNamespace() != "" {
+		filter.Namespaces = []string{req.GetNamespace()}
+	}
+	sub := s.informer.Subscribe(filter, s.config.WatchBuffer)
+	defer s.informer.Unsubscribe(sub)
+
+	// 客户端已知的对象：<cluster>/<resource>/<key> -> resourceVersion
+	known := make(map[string]string)
+	for _, cluster := range s.clusters(req.GetClusters()) {
+		items, err := s.snapshot(cluster, req.GetResource(), req.GetNamespace(), selector)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			known[item.Cluster+"/"+item.Resource+"/"+item.Key] = item.ResourceVersion
+			if err := srv.Send(&WatchEvent{Type: WatchEvent_SNAPSHOT, Object: item, Time: timestamppb.Now()}); err != nil {
+				return err
+			}
+		}
+	}
+	if err := srv.Send(&WatchEvent{Type: WatchEvent_SYNCED, Time: timestamppb.Now()}); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-srv.Context().Done():
+			return nil
+		case obj, ok := <-sub.C:
+			if !ok {
+				if sub.Dropped() {
+					return status.Error(codes.ResourceExhausted, "slow consumer, disconnected")
+				}
+				return nil
+			}
+			event := s.delta(obj, selector, known)
+			if event == nil {
+				continue
+			}
+			if err := srv.Send(event); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// delta 将队列对象转换为增量事件，返回 nil 表示不需要发送
+// 对象不再满足 labelSelector 时，对客户端来说等同于删除
+func (s *Service) delta(obj queue.QueueObject, selector labels.Selector, known map[string]string) *WatchEvent {
+	item, err := newObject(obj.ClusterName, obj.ResourceType, obj.Obj)
+	if err != nil {
+		klog.Error("grpc watch encode object error: ", err)
+		return nil
+	}
+	id := obj.ClusterName + "/" + item.Resource + "/" + item.Key
+	rv, exists := known[id]
+
+	eventType := WatchEvent_DELETE
+	if obj.Event != resource.EventDelete && matches(obj.Obj, selector) {
+		eventType = WatchEvent_UPDATE
+		if !exists {
+			eventType = WatchEvent_ADD
+		}
+	}
+
+	switch {
+	case eventType == WatchEvent_DELETE && !exists:
+		return nil
+	case exists && stale(item.ResourceVersion, rv, eventType == WatchEvent_DELETE):
+		// 快照之前缓冲的变更，或是 resync
+		return nil
+	case eventType == WatchEvent_DELETE:
+		delete(known, id)
+	default:
+		known[id] = item.ResourceVersion
+	}
+	return &WatchEvent{Type: eventType, Object: item, Time: timestamppb.New(obj.CreateAt)}
+}
+
+// stale 变更是否不比客户端已知的版本新
+// 删除事件带的是对象最后的状态，resourceVersion 与已知的相同时仍需发送
+// 同一集群中 resourceVersion 递增，无法解析为整数时只比较是否相同
+func stale(rv, knownRV string, deleted bool) bool {
+	if rv == knownRV {
+		return !deleted
+	}
+	n, err1 := strconv.ParseUint(rv, 10, 64)
+	known, err2 := strconv.ParseUint(knownRV, 10, 64)
+	return err1 == nil && err2 == nil && n < known
+}
+
+// check 检查资源类型与 labelSelector
+func (s *Service) check(rType, labelSelector string) (labels.Selector, error) {
+	if s.informer.ClusterStore() == nil {
+		return nil, status.Error(codes.Unimplemented, "store is not cluster aware")
+	}
+	if rType == "" {
+		return nil, status.Error(codes.InvalidArgument, "resource is required")
+	}
+	if rType == resource.Secrets && !s.config.ExposeSecrets {
+		return nil, status.Error(codes.PermissionDenied, "secrets are not exposed, see grpc.exposeSecrets")
+	}
+	selector, err := labels.Parse(labelSelector)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return selector, nil
+}
+
+// clusters 请求的集群，为空时返回所有集群
+func (s *Service) clusters(requested []string) []string {
+	if len(requested) == 0 {
+		return s.informer.ClusterStore().Clusters()
+	}
+	return requested
+}
+
+// snapshot 集群中满足条件的对象，按资源类型与 key 排序
+// rType 为 all 时逐个对象判断类型，未开启 exposeSecrets 时跳过 secret
+func (s *Service) snapshot(cluster, rType, namespace string, selector labels.Selector) ([]*Object, error) {
+	var items []*Object
+	for _, obj := range s.informer.ClusterStore().ListByCluster(cluster, rType) {
+		objType := rType
+		if rType == resource.All {
+			objType = resource.TypeOf(obj)
+		}
+		if objType == resource.Secrets && !s.config.ExposeSecrets || !matches(obj, selector) {
+			continue
+		}
+		item, err := newObject(cluster, objType, obj)
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		if namespace != "" && item.Namespace != namespace {
+			continue
+		}
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Resource != items[j].Resource {
+			return items[i].Resource < items[j].Resource
+		}
+		return items[i].Key < items[j].Key
+	})
+	return items, nil
+}
+
+func newObject(cluster, rType string, obj interface{}) (*Object, error) {
+	item := &Object{Cluster: cluster, Resource: rType}
+	raw := resource.Unwrap(obj)
+	if accessor, err := resource.Accessor(raw); err == nil {
+		item.Namespace = accessor.GetNamespace()
+		item.Name = accessor.GetName()
+		item.ResourceVersion = accessor.GetResourceVersion()
+	}
+	item.Key = item.Name
+	if item.Namespace != "" {
+		item.Key = item.Namespace + "/" + item.Name
+	}
+
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	item.Json = b
+	return item, nil
+}
+
+func matches(obj interface{}, selector labels.Selector) bool {
+	if selector.Empty() {
+		return true
+	}
+	accessor, err := resource.Accessor(resource.Unwrap(obj))
+	return err == nil && selector.Matches(labels.Set(accessor.GetLabels()))
+}
+
+// Server gRPC 服务
+// 测试时可以用 bufconn 的 listener 调用 Serve，不需要监听端口
+type Server struct {
+	*grpc.Server
+	config Config
+}
+
+func NewServer(config Config, informer controller.MultiClusterInformer, opts ...grpc.ServerOption) *Server {
+	if config.Addr == "" {
+		config.Addr = ":9090"
+	}
+	s := &Server{Server: grpc.NewServer(opts...), config: config}
+	RegisterInformerServer(s.Server, NewService(config, informer))
+	return s
+}
+
+// Run 监听 Addr 并启动服务，阻塞直到服务关闭
+func (s *Server) Run() {
+	lis, err := net.Listen("tcp", s.config.Addr)
+	if err != nil {
+		klog.Error("grpc server listen error: ", err)
+		return
+	}
+	klog.Info("run grpc server on ", s.config.Addr)
+	if err := s.Serve(lis); err != nil {
+		klog.Error("grpc server error: ", err)
+	}
+}
+
+// Stop 优雅关闭，Watch 为长连接，超时后强制关闭
+func (s *Server) Stop() {
+	done := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		s.Server.Stop()
+	}
+}
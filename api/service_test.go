@@ -0,0 +1,151 @@
+package api
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"multiple-k8s-informer/controller"
+	"multiple-k8s-informer/queue"
+	"multiple-k8s-informer/resource"
+	"multiple-k8s-informer/store"
+	"multiple-k8s-informer/stream"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func pod(name, rv string) *v1.Pod {
+	return &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", ResourceVersion: rv}}
+}
+
+// newTestClient 通过 bufconn 启动服务，返回客户端与 informer
+func newTestClient(t *testing.T, config Config) (InformerClient, *controller.Controller) {
+	t.Helper()
+	cs := store.ClusterIndexers{}
+	pods := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	_ = pods.Add(pod("web", "10"))
+	cs.Add("c1", resource.Pods, pods)
+	secrets := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	_ = secrets.Add(&v1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "token", Namespace: "default", ResourceVersion: "11"}})
+	cs.Add("c1", resource.Secrets, secrets)
+	informer := &controller.Controller{Queue: queue.NewQueue(1), Store: cs, Broadcaster: stream.NewBroadcaster()}
+
+	lis := bufconn.Listen(1 << 20)
+	s := NewServer(config, informer)
+	go func() { _ = s.Serve(lis) }()
+	t.Cleanup(s.Server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return NewInformerClient(conn), informer
+}
+
+func TestListSecrets(t *testing.T) {
+	ctx := context.Background()
+	client, _ := newTestClient(t, Config{})
+
+	resp, err := client.List(ctx, &ListRequest{Resource: resource.All})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Items) != 1 || resp.Items[0].Resource != resource.Pods {
+		t.Fatalf("list all = %v, want only the pod", resp.Items)
+	}
+
+	_, err = client.List(ctx, &ListRequest{Resource: resource.Secrets})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("list secrets error = %v, want PermissionDenied", err)
+	}
+
+	client, _ = newTestClient(t, Config{ExposeSecrets: true})
+	resp, err = client.List(ctx, &ListRequest{Resource: resource.All})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Items) != 2 {
+		t.Fatalf("list all with exposeSecrets = %d items, want 2", len(resp.Items))
+	}
+}
+
+func TestWatch(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client, informer := newTestClient(t, Config{})
+
+	w, err := client.Watch(ctx, &WatchRequest{Resource: resource.All})
+	if err != nil {
+		t.Fatal(err)
+	}
+	recv := func() *WatchEvent {
+		t.Helper()
+		event, err := w.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return event
+	}
+
+	if event := recv(); event.Type != WatchEvent_SNAPSHOT || event.Object.Key != "default/web" {
+		t.Fatalf("snapshot = %v, want the pod only", event)
+	}
+	if event := recv(); event.Type != WatchEvent_SYNCED {
+		t.Fatalf("got %v, want SYNCED", event)
+	}
+
+	publish := func(rType, event string, obj interface{}) {
+		informer.Broadcaster.Publish(queue.QueueObject{ClusterName: "c1", ResourceType: rType, Event: event, Key: "default/web", Obj: obj})
+	}
+	// 比快照旧或相同的变更被跳过，secret 不推送
+	publish(resource.Pods, resource.EventUpdate, pod("web", "9"))
+	publish(resource.Pods, resource.EventUpdate, pod("web", "10"))
+	publish(resource.Secrets, resource.EventUpdate, &v1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "token", Namespace: "default", ResourceVersion: "12"}})
+	publish(resource.Pods, resource.EventUpdate, pod("web", "12"))
+	publish(resource.Pods, resource.EventDelete, pod("web", "12"))
+
+	tests := []struct {
+		eventType WatchEvent_Type
+		rv        string
+	}{
+		{WatchEvent_UPDATE, "12"},
+		{WatchEvent_DELETE, "12"},
+	}
+	for _, tt := range tests {
+		event := recv()
+		if event.Type != tt.eventType || event.Object.Resource != resource.Pods || event.Object.ResourceVersion != tt.rv {
+			t.Fatalf("got %v %s/%s rv=%s, want %v pods rv=%s", event.Type, event.Object.Resource, event.Object.Key, event.Object.ResourceVersion, tt.eventType, tt.rv)
+		}
+	}
+}
+
+func TestStale(t *testing.T) {
+	tests := []struct {
+		rv, known string
+		deleted   bool
+		want      bool
+	}{
+		{"9", "10", false, true},
+		{"10", "10", false, true},
+		{"11", "10", false, false},
+		{"10", "10", true, false},
+		{"9", "10", true, true},
+		{"b", "a", false, false},
+	}
+	for _, tt := range tests {
+		if got := stale(tt.rv, tt.known, tt.deleted); got != tt.want {
+			t.Errorf("stale(%q, %q, %v) = %v, want %v", tt.rv, tt.known, tt.deleted, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+// alerttest 在本地测试告警规则，不需要连接集群
+//
+//	go run ./cmd/alerttest alert/example/rules_test.yaml
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"multiple-k8s-informer/alert"
+)
+
+func main() {
+	verbose := flag.Bool("v", false, "print the alerts of passed tests")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: alerttest [-v] <test file>...")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	failed := false
+	for _, path := range flag.Args() {
+		results, err := alert.RunTestFile(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			failed = true
+			continue
+		}
+		for _, result := range results {
+			if result.Passed() {
+				fmt.Printf("PASS %s: %s\n", path, result.Name)
+				if *verbose {
+					printAlerts(result.Alerts)
+				}
+				continue
+			}
+			failed = true
+			fmt.Printf("FAIL %s: %s\n", path, result.Name)
+			for _, failure := range result.Failures {
+				fmt.Printf("    %s\n", failure)
+			}
+			fmt.Println("  got:")
+			printAlerts(result.Alerts)
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func printAlerts(alerts []alert.TestAlert) {
+	for _, a := range alerts {
+		fmt.Printf("    %s\n", a)
+	}
+}
@@ -5,7 +5,15 @@ import (
 	"io/ioutil"
 	"log"
 
+	"multiple-k8s-informer/aggregate"
+	"multiple-k8s-informer/alert"
+	"multiple-k8s-informer/api"
 	"multiple-k8s-informer/controller"
+	"multiple-k8s-informer/diff"
+	"multiple-k8s-informer/drift"
+	"multiple-k8s-informer/queue"
+	"multiple-k8s-informer/server"
+	"multiple-k8s-informer/sink"
 
 	"github.com/go-yaml/yaml"
 )
@@ -15,8 +23,26 @@ import (
 var SysConfig *Config
 
 type Config struct {
-	MaxReQueueTime int                  `json:"maxRequeueTime" yaml:"maxRequeueTime"`
-	Clusters       []controller.Cluster `json:"clusters" yaml:"clusters"`
+	MaxReQueueTime int                     `json:"maxRequeueTime" yaml:"maxRequeueTime"`
+	DeadLetterSize int                     `json:"deadLetterSize" yaml:"deadLetterSize"` // 死信队列容量
+	RateLimiter    queue.RateLimiterConfig `json:"rateLimiter" yaml:"rateLimiter"`       // 重新入列的限速器
+	Coalesce       bool                    `json:"coalesce" yaml:"coalesce"`             // 合并模式，同一对象未处理的事件只保留最后一次
+	FairQueue      queue.FairConfig        `json:"fairQueue" yaml:"fairQueue"`           // 按集群公平出队
+	PriorityQueue  queue.PriorityConfig    `json:"priorityQueue" yaml:"priorityQueue"`   // 按优先级出队，与 fairQueue 二选一
+	Persistence    queue.PersistenceConfig `json:"persistence" yaml:"persistence"`       // 队列持久化，重启后重放未完成的对象
+	Diff           diff.Config             `json:"diff" yaml:"diff"`                     // update 事件计算 diff，丢弃没有差异的 update 事件
+	Predicates     controller.Predicates   `json:"predicates" yaml:"predicates"`         // 资源类型 -> update 过滤条件，不满足的 update 事件不放入队列
+	Aggregate      aggregate.Config        `json:"aggregate" yaml:"aggregate"`           // 按 involvedObject、reason 聚合 core/v1 Event 后再放入队列
+	Server         server.Config           `json:"server" yaml:"server"`                 // 内置 http 服务
+	GRPC           api.Config              `json:"grpc" yaml:"grpc"`                     // gRPC 服务：List / Watch
+	Webhook        sink.WebhookConfig      `json:"webhook" yaml:"webhook"`               // 内置 webhook handler
+	Kafka          sink.KafkaConfig        `json:"kafka" yaml:"kafka"`                   // 内置 kafka handler
+	NATS           sink.NATSConfig         `json:"nats" yaml:"nats"`                     // 内置 nats / JetStream handler
+	Audit          sink.FileConfig         `json:"audit" yaml:"audit"`                   // 内置审计文件 handler
+	SQL            sink.SQLConfig          `json:"sql" yaml:"sql"`                       // 内置数据库 handler
+	Alert          alert.Config            `json:"alert" yaml:"alert"`                   // 告警规则，对事件流求值
+	Drift          drift.Config            `json:"drift" yaml:"drift"`                   // 跨集群同名对象的漂移检测
+	Clusters       []controller.Cluster    `json:"clusters" yaml:"clusters"`
 }
 
 func NewConfig() *Config {
@@ -40,7 +66,12 @@ func LoadConfig(path string) (*Config, error) {
 		if err != nil {
 			return nil, err
 		}
-
+		// 启动前检查 filter 表达式，编译结果在创建 informer 时复用
+		for i := range config.Clusters {
+			if err := config.Clusters[i].CompileFilters(); err != nil {
+				return nil, err
+			}
+		}
 		fmt.Println(config)
 		return config, err
 	} else {
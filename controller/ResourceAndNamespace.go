@@ -2,6 +2,7 @@ package controller
 
 import (
 	"context"
+	"multiple-k8s-informer/metrics"
 	"multiple-k8s-informer/queue"
 	"multiple-k8s-informer/resource"
 
@@ -9,6 +10,8 @@ import (
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/klog"
@@ -18,46 +21,96 @@ import (
 type ResourceAndNamespace struct {
 	RType     string `json:"rType" yaml:"rType"`
 	Namespace string `json:"namespace" yaml:"namespace"`
+	Filter    string `json:"filter" yaml:"filter"` // CEL 表达式，结果为 true 的事件才放入队列，为空时不过滤
+
+	filter *Filter
+}
+
+// newListWatch 创建 ListWatch，并记录 list/watch 的次数与错误
+func newListWatch(restClient cache.Getter, rType, namespace, clusterName string, states *clusterStates) *cache.ListWatch {
+	lw := cache.NewListWatchFromClient(restClient, rType, namespace, fields.Everything())
+	list, watchFunc := lw.ListFunc, lw.WatchFunc
+
+	lw.ListFunc = func(options metav1.ListOptions) (runtime.Object, error) {
+		obj, err := list(options)
+		metrics.ObserveList(clusterName, rType, err)
+		states.observeListWatch(clusterName, err)
+		return obj, err
+	}
+	lw.WatchFunc = func(options metav1.ListOptions) (watch.Interface, error) {
+		w, err := watchFunc(options)
+		metrics.ObserveWatch(clusterName, rType, err)
+		states.observeListWatch(clusterName, err)
+		return w, err
+	}
+	return lw
+}
+
+// handleFunc 带 Filter 的 InitHandleFunc，事件放入 c.Queue 并记录到 c 的集群状态，update 事件按 c.UpdatePredicates 过滤、按 c.Differ 计算 diff
+func (r *ResourceAndNamespace) handleFunc(resourceName, clusterName string, c *Controller) cache.ResourceEventHandlerFuncs {
+	var filter eventFilter
+	if r.filter != nil {
+		filter = func(event string, oldObj, obj interface{}) (bool, error) {
+			return r.accept(clusterName, resourceName, event, oldObj, obj)
+		}
+	}
+	return initHandleFunc(resourceName, clusterName, c.Queue, filter, &c.states, c.Differ, c.UpdatePredicates)
 }
 
-// 创建 "k8s.io/api/core/v1"的核心包
+// 创建 "k8s.io/api/core/v1"的核心包，事件放入 worker，不记录集群状态
 func (r *ResourceAndNamespace) CreateCoreV1IndexInformer(client *kubernetes.Clientset, worker queue.Queue, clusterName string) (indexer cache.Indexer, informer cache.Controller) {
+	return r.CreateCoreV1IndexInformerWithController(client, &Controller{Queue: worker}, clusterName)
+}
+
+// CreateCoreV1IndexInformerWithController 事件放入 c.Queue，并记录到 c 的集群状态
+func (r *ResourceAndNamespace) CreateCoreV1IndexInformerWithController(client *kubernetes.Clientset, c *Controller, clusterName string) (indexer cache.Indexer, informer cache.Controller) {
 
 	restClient := client.CoreV1().RESTClient()
-	lw := cache.NewListWatchFromClient(restClient, r.RType, r.Namespace, fields.Everything())
+	lw := newListWatch(restClient, r.RType, r.Namespace, clusterName, &c.states)
 
 	switch r.RType {
 	case resource.Services:
-		indexer, informer = cache.NewIndexerInformer(lw, &v1.Service{}, 0, InitHandleFunc(resource.Services, clusterName, worker), cache.Indexers{})
+		indexer, informer = cache.NewIndexerInformer(lw, &v1.Service{}, 0, r.handleFunc(resource.Services, clusterName, c), cache.Indexers{})
 	case resource.Pods:
-		indexer, informer = cache.NewIndexerInformer(lw, &v1.Pod{}, 0, InitHandleFunc(resource.Pods, clusterName, worker), cache.Indexers{})
+		indexer, informer = cache.NewIndexerInformer(lw, &v1.Pod{}, 0, r.handleFunc(resource.Pods, clusterName, c), cache.Indexers{})
 	case resource.ConfigMaps:
-		indexer, informer = cache.NewIndexerInformer(lw, &v1.ConfigMap{}, 0, InitHandleFunc(resource.Services, clusterName, worker), cache.Indexers{})
+		indexer, informer = cache.NewIndexerInformer(lw, &v1.ConfigMap{}, 0, r.handleFunc(resource.ConfigMaps, clusterName, c), cache.Indexers{})
 	case resource.Secrets:
-		indexer, informer = cache.NewIndexerInformer(lw, &v1.Secret{}, 0, InitHandleFunc(resource.Services, clusterName, worker), cache.Indexers{})
+		indexer, informer = cache.NewIndexerInformer(lw, &v1.Secret{}, 0, r.handleFunc(resource.Secrets, clusterName, c), cache.Indexers{})
 	case resource.Events:
-		indexer, informer = cache.NewIndexerInformer(lw, &v1.Event{}, 0, InitHandleFunc(resource.Services, clusterName, worker), cache.Indexers{})
+		indexer, informer = cache.NewIndexerInformer(lw, &v1.Event{}, 0, r.handleFunc(resource.Events, clusterName, c), cache.Indexers{})
 	}
 	return
 }
 
-// appsv1 "k8s.io/api/apps/v1" 构造informer需要的资源
+// appsv1 "k8s.io/api/apps/v1" 构造informer需要的资源，事件放入 worker，不记录集群状态
 func (r *ResourceAndNamespace) CreateAppsV1IndexInformer(client *kubernetes.Clientset, worker queue.Queue, clusterName string) (indexer cache.Indexer, informer cache.Controller) {
+	return r.CreateAppsV1IndexInformerWithController(client, &Controller{Queue: worker}, clusterName)
+}
+
+// CreateAppsV1IndexInformerWithController 事件放入 c.Queue，并记录到 c 的集群状态
+func (r *ResourceAndNamespace) CreateAppsV1IndexInformerWithController(client *kubernetes.Clientset, c *Controller, clusterName string) (indexer cache.Indexer, informer cache.Controller) {
 	restClient := client.AppsV1().RESTClient()
-	lw := cache.NewListWatchFromClient(restClient, r.RType, r.Namespace, fields.Everything())
+	lw := newListWatch(restClient, r.RType, r.Namespace, clusterName, &c.states)
 
 	switch r.RType {
 	case resource.Deployments:
-		indexer, informer = cache.NewIndexerInformer(lw, &appsv1.Deployment{}, 0, InitHandleFunc(resource.Services, clusterName, worker), cache.Indexers{})
+		indexer, informer = cache.NewIndexerInformer(lw, &appsv1.Deployment{}, 0, r.handleFunc(resource.Deployments, clusterName, c), cache.Indexers{})
 	case resource.Statefulsets:
-		indexer, informer = cache.NewIndexerInformer(lw, &appsv1.StatefulSet{}, 0, InitHandleFunc(resource.Services, clusterName, worker), cache.Indexers{})
+		indexer, informer = cache.NewIndexerInformer(lw, &appsv1.StatefulSet{}, 0, r.handleFunc(resource.Statefulsets, clusterName, c), cache.Indexers{})
 	case resource.Daemonsets:
-		indexer, informer = cache.NewIndexerInformer(lw, &appsv1.DaemonSet{}, 0, InitHandleFunc(resource.Services, clusterName, worker), cache.Indexers{})
+		indexer, informer = cache.NewIndexerInformer(lw, &appsv1.DaemonSet{}, 0, r.handleFunc(resource.Daemonsets, clusterName, c), cache.Indexers{})
 	}
 	return
 }
 
+// CreateAllCoreV1IndexInformer 每个 namespace 一个 informer，事件放入 worker，不记录集群状态
 func (r *ResourceAndNamespace) CreateAllCoreV1IndexInformer(client *kubernetes.Clientset, worker queue.Queue, clusterName string) (indexerList []cache.Indexer, informerList []cache.Controller) {
+	return r.CreateAllCoreV1IndexInformerWithController(client, &Controller{Queue: worker}, clusterName)
+}
+
+// CreateAllCoreV1IndexInformerWithController 事件放入 c.Queue，并记录到 c 的集群状态
+func (r *ResourceAndNamespace) CreateAllCoreV1IndexInformerWithController(client *kubernetes.Clientset, c *Controller, clusterName string) (indexerList []cache.Indexer, informerList []cache.Controller) {
 	ctx := context.TODO()
 
 	nsList, err := client.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
@@ -68,26 +121,26 @@ func (r *ResourceAndNamespace) CreateAllCoreV1IndexInformer(client *kubernetes.C
 
 	for _, values := range nsList.Items {
 		restClient := client.CoreV1().RESTClient()
-		lw := cache.NewListWatchFromClient(restClient, r.RType, values.GetName(), fields.Everything())
+		lw := newListWatch(restClient, r.RType, values.GetName(), clusterName, &c.states)
 		switch r.RType {
 		case resource.Services:
-			indexer, informer := cache.NewIndexerInformer(lw, &v1.Service{}, 0, InitHandleFunc(resource.Services, clusterName, worker), cache.Indexers{})
+			indexer, informer := cache.NewIndexerInformer(lw, &v1.Service{}, 0, r.handleFunc(resource.Services, clusterName, c), cache.Indexers{})
 			indexerList = append(indexerList, indexer)
 			informerList = append(informerList, informer)
 		case resource.Pods:
-			indexer, informer := cache.NewIndexerInformer(lw, &v1.Pod{}, 0, InitHandleFunc(resource.Pods, clusterName, worker), cache.Indexers{})
+			indexer, informer := cache.NewIndexerInformer(lw, &v1.Pod{}, 0, r.handleFunc(resource.Pods, clusterName, c), cache.Indexers{})
 			indexerList = append(indexerList, indexer)
 			informerList = append(informerList, informer)
 		case resource.ConfigMaps:
-			indexer, informer := cache.NewIndexerInformer(lw, &v1.ConfigMap{}, 0, InitHandleFunc(resource.ConfigMaps, clusterName, worker), cache.Indexers{})
+			indexer, informer := cache.NewIndexerInformer(lw, &v1.ConfigMap{}, 0, r.handleFunc(resource.ConfigMaps, clusterName, c), cache.Indexers{})
 			indexerList = append(indexerList, indexer)
 			informerList = append(informerList, informer)
 		case resource.Secrets:
-			indexer, informer := cache.NewIndexerInformer(lw, &v1.Secret{}, 0, InitHandleFunc(resource.Secrets, clusterName, worker), cache.Indexers{})
+			indexer, informer := cache.NewIndexerInformer(lw, &v1.Secret{}, 0, r.handleFunc(resource.Secrets, clusterName, c), cache.Indexers{})
 			indexerList = append(indexerList, indexer)
 			informerList = append(informerList, informer)
 		case resource.Events:
-			indexer, informer := cache.NewIndexerInformer(lw, &v1.Event{}, 0, InitHandleFunc(resource.Events, clusterName, worker), cache.Indexers{})
+			indexer, informer := cache.NewIndexerInformer(lw, &v1.Event{}, 0, r.handleFunc(resource.Events, clusterName, c), cache.Indexers{})
 			indexerList = append(indexerList, indexer)
 			informerList = append(informerList, informer)
 		}
@@ -95,7 +148,13 @@ func (r *ResourceAndNamespace) CreateAllCoreV1IndexInformer(client *kubernetes.C
 	return
 }
 
+// CreateAllAppsV1IndexInformer 每个 namespace 一个 informer，事件放入 worker，不记录集群状态
 func (r *ResourceAndNamespace) CreateAllAppsV1IndexInformer(client *kubernetes.Clientset, worker queue.Queue, clusterName string) (indexerList []cache.Indexer, informerList []cache.Controller) {
+	return r.CreateAllAppsV1IndexInformerWithController(client, &Controller{Queue: worker}, clusterName)
+}
+
+// CreateAllAppsV1IndexInformerWithController 事件放入 c.Queue，并记录到 c 的集群状态
+func (r *ResourceAndNamespace) CreateAllAppsV1IndexInformerWithController(client *kubernetes.Clientset, c *Controller, clusterName string) (indexerList []cache.Indexer, informerList []cache.Controller) {
 	ctx := context.TODO()
 
 	nsList, err := client.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
@@ -106,18 +165,18 @@ func (r *ResourceAndNamespace) CreateAllAppsV1IndexInformer(client *kubernetes.C
 
 	for _, values := range nsList.Items {
 		restClient := client.AppsV1().RESTClient()
-		lw := cache.NewListWatchFromClient(restClient, r.RType, values.GetName(), fields.Everything())
+		lw := newListWatch(restClient, r.RType, values.GetName(), clusterName, &c.states)
 		switch r.RType {
 		case resource.Deployments:
-			indexer, informer := cache.NewIndexerInformer(lw, &appsv1.Deployment{}, 0, InitHandleFunc(resource.Services, clusterName, worker), cache.Indexers{})
+			indexer, informer := cache.NewIndexerInformer(lw, &appsv1.Deployment{}, 0, r.handleFunc(resource.Deployments, clusterName, c), cache.Indexers{})
 			indexerList = append(indexerList, indexer)
 			informerList = append(informerList, informer)
 		case resource.Statefulsets:
-			indexer, informer := cache.NewIndexerInformer(lw, &appsv1.StatefulSet{}, 0, InitHandleFunc(resource.Services, clusterName, worker), cache.Indexers{})
+			indexer, informer := cache.NewIndexerInformer(lw, &appsv1.StatefulSet{}, 0, r.handleFunc(resource.Statefulsets, clusterName, c), cache.Indexers{})
 			indexerList = append(indexerList, indexer)
 			informerList = append(informerList, informer)
 		case resource.Daemonsets:
-			indexer, informer := cache.NewIndexerInformer(lw, &appsv1.DaemonSet{}, 0, InitHandleFunc(resource.Services, clusterName, worker), cache.Indexers{})
+			indexer, informer := cache.NewIndexerInformer(lw, &appsv1.DaemonSet{}, 0, r.handleFunc(resource.Daemonsets, clusterName, c), cache.Indexers{})
 			indexerList = append(indexerList, indexer)
 			informerList = append(informerList, informer)
 		}
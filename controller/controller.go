@@ -1,10 +1,15 @@
 package controller
 
 import (
+	"context"
 	"errors"
+	"multiple-k8s-informer/diff"
+	"multiple-k8s-informer/metrics"
 	"multiple-k8s-informer/queue"
 	"multiple-k8s-informer/resource"
 	"multiple-k8s-informer/store"
+	"multiple-k8s-informer/stream"
+	"sync/atomic"
 	"time"
 
 	"k8s.io/client-go/kubernetes"
@@ -31,8 +36,30 @@ type MultiClusterInformer interface {
 	AddEventHandler(handler HandleFunc)
 	// HandleObject 调用handler处理资源对象
 	HandleObject(object queue.QueueObject) error
-	// Queue 队列接口对象
+	// AddBatchEventHandler 加入批量处理的回调handler
+	AddBatchEventHandler(handler BatchHandleFunc)
+	// HandleBatch 调用批量handler处理资源对象，未设置时逐个调用 HandleFunc
+	HandleBatch(objects []queue.QueueObject) error
+	// Ready 所有 informer 是否已同步
+	Ready() error
+	// Healthy 队列是否停滞、集群 list/watch 是否持续失败
+	Healthy(queueStallTimeout, watchFailureTimeout time.Duration) error
+	// AddHealthCheck 加入 Healthy 的额外检查，如持久化队列的 wal 是否可写
+	AddHealthCheck(check func() error)
+	// ClusterStatuses 每个集群的连接状态、最近事件时间与缓存对象数量
+	ClusterStatuses() []ClusterStatus
+	// ClusterStore 按集群区分的本地缓存，Store 不区分集群时返回 nil
+	ClusterStore() store.ClusterStore
+	// Subscribe 订阅 informer 放入队列的对象，消费过慢时会被断开
+	Subscribe(filter stream.Filter, buffer int) *stream.Subscriber
+	// Unsubscribe 取消订阅
+	Unsubscribe(*stream.Subscriber)
+	// Queue 队列接口对象，可选能力由 Controller 转发，队列不支持时返回 queue.ErrNotSupported
 	queue.Queue
+	queue.ErrorReQueuer
+	queue.BatchQueue
+	queue.DeadLetterQueue
+	queue.Sized
 	// Store 本地缓存接口对象
 	store.Store
 }
@@ -74,23 +101,108 @@ type Controller struct {
 	clients []*kubernetes.Clientset
 	queue.Queue
 	store.Store
-	StopCh     chan struct{}
-	Informers  InformerList
-	HandleFunc HandleFunc
+	StopCh          chan struct{}
+	Informers       InformerList
+	HandleFunc      HandleFunc
+	BatchHandleFunc BatchHandleFunc
+	Broadcaster     *stream.Broadcaster // 使用 stream.NewPublishingQueue 包装 Queue 后才有事件
+	Differ          *diff.Differ        // 不为 nil 时计算 update 事件的 diff，并丢弃没有差异的 update 事件，需要在创建 informer 之前设置
+
+	// UpdatePredicates 资源类型 -> update 过滤条件，不满足的 update 事件不放入队列，需要在创建 informer 之前设置
+	UpdatePredicates map[string]UpdatePredicate
+
+	lastPopAt    atomic.Value // time.Time
+	healthChecks []func() error
+	states       clusterStates
 }
 
 func (c *Controller) Run() {
 	klog.Info("run controller...")
+	c.lastPopAt.Store(time.Now())
 	defer c.Queue.Close()
 	c.Informers.Run(c.StopCh)
 	<-c.StopCh
 
 }
 
+// Pop 出队，并记录出队时间用于检查队列是否停滞
+func (c *Controller) Pop() (queue.QueueObject, error) {
+	obj, err := c.Queue.Pop()
+	if err == nil {
+		c.lastPopAt.Store(time.Now())
+	}
+	return obj, err
+}
+
+// PopBatch 批量出队，并记录出队时间
+func (c *Controller) PopBatch(ctx context.Context, maxItems int, maxWait time.Duration) ([]queue.QueueObject, error) {
+	objs, err := c.optional().PopBatch(ctx, maxItems, maxWait)
+	if len(objs) > 0 {
+		c.lastPopAt.Store(time.Now())
+	}
+	return objs, err
+}
+
+// optional 转发 c.Queue 的可选能力
+func (c *Controller) optional() queue.Decorator {
+	return queue.Decorator{Queue: c.Queue}
+}
+
+func (c *Controller) ReQueueWithError(obj queue.QueueObject, handleErr error) error {
+	return c.optional().ReQueueWithError(obj, handleErr)
+}
+
+func (c *Controller) FinishBatch(objs []queue.QueueObject) {
+	c.optional().FinishBatch(objs)
+}
+
+func (c *Controller) ReQueueBatch(objs []queue.QueueObject, handleErr error) error {
+	return c.optional().ReQueueBatch(objs, handleErr)
+}
+
+func (c *Controller) SetDeadLetter(deadLetter queue.DeadLetter) {
+	c.optional().SetDeadLetter(deadLetter)
+}
+
+func (c *Controller) DeadLetters() queue.DeadLetter {
+	return c.optional().DeadLetters()
+}
+
+func (c *Controller) Replay(id string) error {
+	return c.optional().Replay(id)
+}
+
+func (c *Controller) Len() int {
+	return queue.Len(c.Queue)
+}
+
+func (c *Controller) ClusterStore() store.ClusterStore {
+	if cs, ok := c.Store.(store.ClusterStore); ok {
+		return cs
+	}
+	return nil
+}
+
+// Subscribe 没有 Broadcaster 时返回的订阅者不会收到事件
+func (c *Controller) Subscribe(filter stream.Filter, buffer int) *stream.Subscriber {
+	if c.Broadcaster == nil {
+		return stream.NewBroadcaster().Subscribe(filter, buffer)
+	}
+	return c.Broadcaster.Subscribe(filter, buffer)
+}
+
+func (c *Controller) Unsubscribe(s *stream.Subscriber) {
+	if c.Broadcaster != nil {
+		c.Broadcaster.Unsubscribe(s)
+	}
+}
+
 // HandleObject 自定义回调方法
 func (c *Controller) HandleObject(obj queue.QueueObject) error {
 	if c.HandleFunc != nil {
+		start := time.Now()
 		err := c.HandleFunc(obj)
+		metrics.ObserveHandle(obj.ClusterName, obj.ResourceType, obj.Event, time.Since(start), err)
 		return err
 	}
 	return nil
@@ -107,26 +219,101 @@ func (c *Controller) AddEventHandler(handler HandleFunc) {
 	c.HandleFunc = handler
 }
 
+// BatchHandleFunc 批量处理，部分失败时返回 queue.BatchError，只有失败的对象会重新入列
+type BatchHandleFunc func(objects []queue.QueueObject) error
+
+func (c *Controller) AddBatchEventHandler(handler BatchHandleFunc) {
+	c.BatchHandleFunc = handler
+}
+
+// HandleBatch 自定义批量回调方法
+func (c *Controller) HandleBatch(objects []queue.QueueObject) error {
+	if c.BatchHandleFunc != nil {
+		return c.BatchHandleFunc(objects)
+	}
+
+	batchErr := &queue.BatchError{Errors: make([]error, len(objects))}
+	failed := false
+	for i, obj := range objects {
+		if err := c.HandleObject(obj); err != nil {
+			batchErr.Errors[i] = err
+			failed = true
+		}
+	}
+	if failed {
+		return batchErr
+	}
+	return nil
+}
+
+// InitHandleFunc 事件放入 worker，不记录集群状态
 func InitHandleFunc(resourceName, clusterName string, worker queue.Queue) cache.ResourceEventHandlerFuncs {
+	return initHandleFunc(resourceName, clusterName, worker, nil, nil, nil, nil)
+}
+
+// eventFilter 返回 false 或出错的事件不放入队列，oldObj 只在 update 事件中不为 nil
+type eventFilter func(event string, oldObj, obj interface{}) (bool, error)
+
+// states 为 nil 时不记录集群状态，differ 为 nil 时不计算 diff，predicates 中没有的资源类型不过滤 update 事件
+func initHandleFunc(resourceName, clusterName string, worker queue.Queue, filter eventFilter, states *clusterStates, differ *diff.Differ, predicates map[string]UpdatePredicate) cache.ResourceEventHandlerFuncs {
+	accept := func(queueObj queue.QueueObject, oldObj interface{}) bool {
+		if filter == nil {
+			return true
+		}
+		matched, err := filter(queueObj.Event, oldObj, queueObj.Obj)
+		if err != nil {
+			klog.Errorf("%s %s %s: %v", clusterName, resourceName, queueObj.Key, err)
+			metrics.ObserveDropped(clusterName, resourceName, "filter_error")
+			return false
+		}
+		if !matched {
+			metrics.ObserveDropped(clusterName, resourceName, "filter")
+		}
+		return matched
+	}
 	handler := cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
 			key, err := cache.MetaNamespaceKeyFunc(obj)
 			if err == nil {
-				queueObj := queue.QueueObject{ClusterName: clusterName, ResourceType: resourceName, Event: resource.EventAdd, Obj: key, CreateAt: time.Now()}
+				queueObj := queue.QueueObject{ClusterName: clusterName, ResourceType: resourceName, Event: resource.EventAdd, Key: key, Obj: obj, CreateAt: time.Now()}
+				metrics.ObserveEvent(clusterName, resourceName, queueObj.Event)
+				states.observeEvent(clusterName)
+				if !accept(queueObj, nil) {
+					return
+				}
 				worker.Push(queueObj)
 			}
 		},
 		UpdateFunc: func(oldObj, newObj interface{}) {
 			key, err := cache.MetaNamespaceKeyFunc(newObj)
 			if err == nil {
-				queueObj := queue.QueueObject{ClusterName: clusterName, ResourceType: resourceName, Event: resource.EventUpdate, Obj: key, CreateAt: time.Now()}
+				queueObj := queue.QueueObject{ClusterName: clusterName, ResourceType: resourceName, Event: resource.EventUpdate, Key: key, Obj: newObj, CreateAt: time.Now()}
+				metrics.ObserveEvent(clusterName, resourceName, queueObj.Event)
+				states.observeEvent(clusterName)
+				if !acceptUpdate(predicates, resourceName, oldObj, newObj) {
+					metrics.ObserveDropped(clusterName, resourceName, "predicate")
+					return
+				}
+				if !accept(queueObj, oldObj) {
+					return
+				}
+				if !diffUpdate(differ, &queueObj, oldObj) {
+					metrics.ObserveDropped(clusterName, resourceName, "empty-diff")
+					return
+				}
 				worker.Push(queueObj)
 			}
 		},
 		DeleteFunc: func(obj interface{}) {
-			key, err := cache.MetaNamespaceKeyFunc(obj)
+			// 删除事件可能收到 cache.DeletedFinalStateUnknown
+			key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
 			if err == nil {
-				queueObj := queue.QueueObject{ClusterName: clusterName, ResourceType: resourceName, Event: resource.EventDelete, Obj: key, CreateAt: time.Now()}
+				queueObj := queue.QueueObject{ClusterName: clusterName, ResourceType: resourceName, Event: resource.EventDelete, Key: key, Obj: obj, CreateAt: time.Now()}
+				metrics.ObserveEvent(clusterName, resourceName, queueObj.Event)
+				states.observeEvent(clusterName)
+				if !accept(queueObj, nil) {
+					return
+				}
 				worker.Push(queueObj)
 			}
 		},
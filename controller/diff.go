@@ -0,0 +1,26 @@
+package controller
+
+import (
+	"multiple-k8s-informer/diff"
+	"multiple-k8s-informer/queue"
+
+	"k8s.io/klog"
+)
+
+// diffUpdate 将 oldObj 到 obj.Obj 的 merge patch 填入 obj.Diff，返回 false 表示没有差异
+// differ 为 nil 或计算失败时不丢弃事件
+func diffUpdate(differ *diff.Differ, obj *queue.QueueObject, oldObj interface{}) bool {
+	if differ == nil {
+		return true
+	}
+	result, err := differ.Diff(oldObj, obj.Obj)
+	if err != nil {
+		klog.Error("diff update event error: ", err)
+		return true
+	}
+	if result.Empty() {
+		return false
+	}
+	obj.Diff = string(result.Patch)
+	return true
+}
@@ -0,0 +1,35 @@
+package controller
+
+import (
+	"testing"
+
+	"multiple-k8s-informer/diff"
+	"multiple-k8s-informer/queue"
+	"multiple-k8s-informer/resource"
+)
+
+// 每个 Controller 按自己的 Differ 处理 update 事件
+func TestDifferPerController(t *testing.T) {
+	r := &ResourceAndNamespace{RType: resource.Pods, Namespace: "default"}
+	old, changed := testPod(map[string]string{"app": "web"}), testPod(map[string]string{"app": "api"})
+
+	withDiff := &Controller{Queue: queue.NewQueue(1), Differ: diff.New(nil)}
+	defer withDiff.Queue.Close()
+	handler := r.handleFunc(resource.Pods, "c1", withDiff)
+	handler.OnUpdate(old, testPod(map[string]string{"app": "web"}))
+	if n := withDiff.Len(); n != 0 {
+		t.Fatalf("update without changes pushed %d objects, want 0", n)
+	}
+	handler.OnUpdate(old, changed)
+	obj, _ := withDiff.Pop()
+	if obj.Diff != `{"metadata":{"labels":{"app":"api"}}}` {
+		t.Fatalf("diff = %s", obj.Diff)
+	}
+
+	withoutDiff := &Controller{Queue: queue.NewQueue(1)}
+	defer withoutDiff.Queue.Close()
+	r.handleFunc(resource.Pods, "c1", withoutDiff).OnUpdate(old, testPod(map[string]string{"app": "web"}))
+	if obj, _ := withoutDiff.Pop(); obj.Diff != "" {
+		t.Fatalf("controller without Differ computed diff %s", obj.Diff)
+	}
+}
@@ -0,0 +1,130 @@
+package controller
+
+import (
+	"fmt"
+
+	"multiple-k8s-informer/resource"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+)
+
+// Filter 编译后的 CEL 过滤表达式，结果为 true 的事件才放入队列
+//
+// 可用的变量:
+//
+//	object    事件中的对象，delete 事件为删除前的对象
+//	oldObject update 事件中的旧对象，add/delete 事件为空 map
+//	cluster   集群名称
+//	event     add / update / delete
+//	resource  资源类型，如 pods、deployments
+//
+// 如 object.status.phase == "Failed"、oldObject.spec.replicas != object.spec.replicas
+// 访问不存在的字段会出错，可以用 has(object.status.phase) 判断，出错的事件不放入队列，记录错误日志与 filter_error 丢弃指标
+type Filter struct {
+	expr    string
+	program cel.Program
+}
+
+var filterEnv *cel.Env
+
+func init() {
+	var err error
+	filterEnv, err = cel.NewEnv(
+		cel.Variable("object", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("oldObject", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("cluster", cel.StringType),
+		cel.Variable("event", cel.StringType),
+		cel.Variable("resource", cel.StringType),
+	)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// NewFilter 编译表达式，语法错误、类型错误或结果不是 bool 时返回错误
+func NewFilter(expr string) (*Filter, error) {
+	ast, issues := filterEnv.Compile(expr)
+	if issues != nil && issues.Err() != nil {
+		return nil, fmt.Errorf("compile filter %q: %w", expr, issues.Err())
+	}
+	// 字段的类型为 dyn，只能在运行时检查
+	if t := ast.OutputType(); !t.IsExactType(types.BoolType) && !t.IsExactType(types.DynType) {
+		return nil, fmt.Errorf("filter %q must return bool, got %s", expr, t)
+	}
+	program, err := filterEnv.Program(ast)
+	if err != nil {
+		return nil, fmt.Errorf("compile filter %q: %w", expr, err)
+	}
+	return &Filter{expr: expr, program: program}, nil
+}
+
+// String 原始表达式
+func (f *Filter) String() string {
+	return f.expr
+}
+
+// Match 对事件求值，oldObj 为 nil 时 oldObject 为空 map
+func (f *Filter) Match(clusterName, rType, event string, oldObj, obj interface{}) (bool, error) {
+	object, err := resource.ToUnstructured(obj)
+	if err != nil {
+		return false, err
+	}
+	oldObject := map[string]interface{}{}
+	if oldObj != nil {
+		if oldObject, err = resource.ToUnstructured(oldObj); err != nil {
+			return false, err
+		}
+	}
+
+	out, _, err := f.program.Eval(map[string]interface{}{
+		"object":    object,
+		"oldObject": oldObject,
+		"cluster":   clusterName,
+		"event":     event,
+		"resource":  rType,
+	})
+	if err != nil {
+		return false, err
+	}
+	matched, ok := out.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("filter %q returned %s, not bool", f.expr, out.Type())
+	}
+	return matched, nil
+}
+
+// CompileFilter 编译 Filter 字段，已编译或为空时不做处理，创建 informer 前调用
+func (r *ResourceAndNamespace) CompileFilter() error {
+	if r.Filter == "" || r.filter != nil {
+		return nil
+	}
+	filter, err := NewFilter(r.Filter)
+	if err != nil {
+		return fmt.Errorf("%s/%s: %w", r.RType, r.Namespace, err)
+	}
+	r.filter = filter
+	return nil
+}
+
+// CompileFilters 编译集群中所有资源的 Filter，加载配置时调用，创建 informer 时复用编译结果
+func (c *Cluster) CompileFilters() error {
+	for i := range c.List {
+		if err := c.List[i].CompileFilter(); err != nil {
+			return fmt.Errorf("cluster %s: %w", c.ClusterName, err)
+		}
+	}
+	return nil
+}
+
+// accept 事件是否满足 Filter，未配置时全部放入队列
+func (r *ResourceAndNamespace) accept(clusterName, rType, event string, oldObj, obj interface{}) (bool, error) {
+	if r.filter == nil {
+		return true, nil
+	}
+	matched, err := r.filter.Match(clusterName, rType, event, oldObj, obj)
+	if err != nil {
+		return false, fmt.Errorf("filter %q: %w", r.filter, err)
+	}
+	return matched, nil
+}
@@ -0,0 +1,76 @@
+package controller
+
+import (
+	"strings"
+	"testing"
+
+	"multiple-k8s-informer/queue"
+	"multiple-k8s-informer/resource"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestFilterHandler(t *testing.T) {
+	failed := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"}, Status: v1.PodStatus{Phase: v1.PodFailed}}
+	tests := []struct {
+		name   string
+		expr   string
+		pushed bool
+	}{
+		{"matched", `object.status.phase == "Failed"`, true},
+		{"not matched", `object.status.phase == "Running"`, false},
+		// 不存在的字段求值出错，不放入队列
+		{"eval error", `object.status.reason == "Evicted"`, false},
+		{"has", `has(object.status.reason) && object.status.reason == "Evicted"`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &ResourceAndNamespace{RType: resource.Pods, Namespace: "default", Filter: tt.expr}
+			if err := r.CompileFilter(); err != nil {
+				t.Fatal(err)
+			}
+			c := &Controller{Queue: queue.NewQueue(1)}
+			defer c.Queue.Close()
+			r.handleFunc(resource.Pods, "c1", c).OnAdd(failed, false)
+			if pushed := c.Len() == 1; pushed != tt.pushed {
+				t.Fatalf("pushed = %v, want %v", pushed, tt.pushed)
+			}
+		})
+	}
+}
+
+func TestCompileFilterInvalid(t *testing.T) {
+	for _, expr := range []string{`object.status.phase ==`, `"Failed"`} {
+		r := &ResourceAndNamespace{RType: resource.Pods, Filter: expr}
+		if err := r.CompileFilter(); err == nil {
+			t.Errorf("CompileFilter(%q) = nil, want error", expr)
+		}
+	}
+}
+
+// 加载配置时编译，创建 informer 时复用编译结果
+func TestClusterCompileFilters(t *testing.T) {
+	cluster := Cluster{ClusterName: "c1", List: []ResourceAndNamespace{
+		{RType: resource.Pods, Namespace: "default", Filter: `object.status.phase == "Failed"`},
+		{RType: resource.Services, Namespace: "default"},
+	}}
+	if err := cluster.CompileFilters(); err != nil {
+		t.Fatal(err)
+	}
+	compiled := cluster.List[0].filter
+	if compiled == nil {
+		t.Fatal("filter is not compiled in place")
+	}
+	// 创建 informer 时 range 得到的是副本，仍然带着编译结果
+	r := cluster.List[0]
+	if err := r.CompileFilter(); err != nil || r.filter != compiled {
+		t.Fatalf("CompileFilter() = %v, recompiled %v", err, r.filter != compiled)
+	}
+
+	cluster.List = append(cluster.List, ResourceAndNamespace{RType: resource.Pods, Namespace: "kube-system", Filter: `"Failed"`})
+	err := cluster.CompileFilters()
+	if err == nil || !strings.Contains(err.Error(), "cluster c1: pods/kube-system") {
+		t.Fatalf("CompileFilters() = %v, want an error naming the cluster and resource", err)
+	}
+}
@@ -0,0 +1,102 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"multiple-k8s-informer/diff"
+	"multiple-k8s-informer/resource"
+
+	"k8s.io/klog"
+)
+
+// UpdatePredicate 判断 update 事件是否需要放入队列
+type UpdatePredicate func(oldObj, newObj interface{}) bool
+
+// PredicateConfig 资源类型的 update 过滤条件，满足任意一个才放入队列，都不配置表示不过滤
+type PredicateConfig struct {
+	Generation  bool     `json:"generation" yaml:"generation"`   // metadata.generation 变化，即 spec 变化
+	Labels      bool     `json:"labels" yaml:"labels"`           // metadata.labels 变化
+	Annotations bool     `json:"annotations" yaml:"annotations"` // metadata.annotations 变化
+	Paths       []string `json:"paths" yaml:"paths"`             // 指定字段变化，语法同 diff.ignore，如 spec.replicas、metadata.labels[app.kubernetes.io/name]、spec.containers.*.image
+}
+
+// Predicate 将配置转换为 UpdatePredicate，没有配置任何条件时返回 nil，字段路径不合法时返回错误
+func (c PredicateConfig) Predicate() (UpdatePredicate, error) {
+	if !c.Generation && !c.Labels && !c.Annotations && len(c.Paths) == 0 {
+		return nil, nil
+	}
+	paths := make([][]string, 0, len(c.Paths))
+	for _, path := range c.Paths {
+		segments, err := diff.ParsePath(path)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, segments)
+	}
+
+	return func(oldObj, newObj interface{}) bool {
+		oldMeta, err1 := resource.Accessor(oldObj)
+		newMeta, err2 := resource.Accessor(newObj)
+		if err1 != nil || err2 != nil {
+			return true
+		}
+		if c.Generation && oldMeta.GetGeneration() != newMeta.GetGeneration() {
+			return true
+		}
+		if c.Labels && !reflect.DeepEqual(oldMeta.GetLabels(), newMeta.GetLabels()) {
+			return true
+		}
+		if c.Annotations && !reflect.DeepEqual(oldMeta.GetAnnotations(), newMeta.GetAnnotations()) {
+			return true
+		}
+		if len(paths) == 0 {
+			return false
+		}
+
+		oldContent, err1 := resource.ToUnstructured(oldObj)
+		newContent, err2 := resource.ToUnstructured(newObj)
+		if err1 != nil || err2 != nil {
+			klog.Error("update predicate convert object error: ", err1, err2)
+			return true
+		}
+		for i, path := range paths {
+			oldValues, err1 := diff.Lookup(oldContent, path)
+			newValues, err2 := diff.Lookup(newContent, path)
+			if err1 != nil || err2 != nil {
+				// 无法比较时不丢弃事件
+				klog.Errorf("update predicate path %s: %v", c.Paths[i], errors.Join(err1, err2))
+				return true
+			}
+			if !reflect.DeepEqual(oldValues, newValues) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// Predicates 资源类型 -> update 过滤条件
+type Predicates map[string]PredicateConfig
+
+// UpdatePredicates 将各资源类型的配置转换为 UpdatePredicate，没有配置条件的资源类型不过滤，字段路径不合法时返回错误
+func (configs Predicates) UpdatePredicates() (map[string]UpdatePredicate, error) {
+	predicates := make(map[string]UpdatePredicate, len(configs))
+	for rType, config := range configs {
+		p, err := config.Predicate()
+		if err != nil {
+			return nil, fmt.Errorf("predicates.%s: %w", rType, err)
+		}
+		if p != nil {
+			predicates[rType] = p
+		}
+	}
+	return predicates, nil
+}
+
+// acceptUpdate update 事件是否满足资源类型的过滤条件
+func acceptUpdate(predicates map[string]UpdatePredicate, rType string, oldObj, newObj interface{}) bool {
+	predicate, ok := predicates[rType]
+	return !ok || predicate(oldObj, newObj)
+}
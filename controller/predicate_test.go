@@ -0,0 +1,87 @@
+package controller
+
+import (
+	"testing"
+
+	"multiple-k8s-informer/queue"
+	"multiple-k8s-informer/resource"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func testPod(labels map[string]string, images ...string) *v1.Pod {
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", Labels: labels}}
+	for _, image := range images {
+		pod.Spec.Containers = append(pod.Spec.Containers, v1.Container{Name: "c", Image: image})
+	}
+	return pod
+}
+
+func TestPredicatePaths(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		old, new *v1.Pod
+		want     bool
+	}{
+		{"dotted label changed", "metadata.labels[app.kubernetes.io/version]",
+			testPod(map[string]string{"app.kubernetes.io/version": "1"}), testPod(map[string]string{"app.kubernetes.io/version": "2"}), true},
+		{"other label changed", "metadata.labels[app.kubernetes.io/version]",
+			testPod(map[string]string{"app.kubernetes.io/version": "1", "a": "1"}), testPod(map[string]string{"app.kubernetes.io/version": "1", "a": "2"}), false},
+		{"array wildcard changed", "spec.containers.*.image", testPod(nil, "nginx:1"), testPod(nil, "nginx:2"), true},
+		{"array wildcard unchanged", "spec.containers.*.image", testPod(nil, "nginx:1"), testPod(nil, "nginx:1"), false},
+		{"array index changed", "spec.containers.1.image", testPod(nil, "a", "b:1"), testPod(nil, "a", "b:2"), true},
+		{"array element added", "spec.containers.*.image", testPod(nil, "a"), testPod(nil, "a", "b"), true},
+		// 用 key 访问数组无法比较，不丢弃事件
+		{"key on array", "spec.containers.image", testPod(nil, "a"), testPod(nil, "a"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			predicate, err := PredicateConfig{Paths: []string{tt.path}}.Predicate()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := predicate(tt.old, tt.new); got != tt.want {
+				t.Errorf("predicate = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdatePredicatesInvalid(t *testing.T) {
+	for _, path := range []string{"", "spec..replicas", "metadata.labels[app", "metadata.labels[a]b"} {
+		if _, err := (Predicates{"pods": {Paths: []string{path}}}).UpdatePredicates(); err == nil {
+			t.Errorf("path %q: want error", path)
+		}
+	}
+}
+
+// 每个 Controller 按自己的 UpdatePredicates 过滤 update 事件
+func TestUpdatePredicatesPerController(t *testing.T) {
+	predicates, err := Predicates{resource.Pods: {Labels: true}}.UpdatePredicates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &ResourceAndNamespace{RType: resource.Pods, Namespace: "default"}
+	old, imageChanged := testPod(map[string]string{"app": "web"}, "nginx:1"), testPod(map[string]string{"app": "web"}, "nginx:2")
+
+	filtered := &Controller{Queue: queue.NewQueue(1), UpdatePredicates: predicates}
+	defer filtered.Queue.Close()
+	handler := r.handleFunc(resource.Pods, "c1", filtered)
+	handler.OnUpdate(old, imageChanged)
+	if n := filtered.Len(); n != 0 {
+		t.Fatalf("update without label changes pushed %d objects, want 0", n)
+	}
+	handler.OnUpdate(old, testPod(map[string]string{"app": "api"}, "nginx:1"))
+	if n := filtered.Len(); n != 1 {
+		t.Fatalf("update with label changes pushed %d objects, want 1", n)
+	}
+
+	unfiltered := &Controller{Queue: queue.NewQueue(1)}
+	defer unfiltered.Queue.Close()
+	r.handleFunc(resource.Pods, "c1", unfiltered).OnUpdate(old, imageChanged)
+	if n := unfiltered.Len(); n != 1 {
+		t.Fatalf("controller without predicates pushed %d objects, want 1", n)
+	}
+}
@@ -0,0 +1,200 @@
+package controller
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/tools/cache"
+)
+
+// ClusterStatus 单个集群的连接与缓存状态
+type ClusterStatus struct {
+	ClusterName   string         `json:"clusterName"`
+	Connected     bool           `json:"connected"`               // 最近一次 list/watch 是否成功
+	LastSuccessAt time.Time      `json:"lastSuccessAt,omitempty"` // 最近一次 list/watch 成功的时间
+	FailingSince  time.Time      `json:"failingSince,omitempty"`  // 连续失败的开始时间
+	LastError     string         `json:"lastError,omitempty"`
+	LastEventAt   time.Time      `json:"lastEventAt,omitempty"` // 最近一次收到事件的时间
+	Synced        bool           `json:"synced"`                // 所有 informer 是否已同步
+	Objects       map[string]int `json:"objects"`               // 资源类型 -> 缓存中的对象数量
+}
+
+// clusterState 记录集群状态，list/watch 与事件回调中更新
+type clusterState struct {
+	mu            sync.RWMutex
+	lastSuccessAt time.Time
+	failingSince  time.Time
+	lastError     string
+	lastEventAt   time.Time
+	indexers      map[string][]cache.Indexer
+	informers     []cache.Controller
+}
+
+// clusterStates 集群名 -> 状态，每个 Controller 一份，零值可用；nil 时不记录
+type clusterStates struct {
+	mu     sync.RWMutex
+	states map[string]*clusterState
+}
+
+func (cs *clusterStates) stateOf(clusterName string) *clusterState {
+	cs.mu.RLock()
+	s, ok := cs.states[clusterName]
+	cs.mu.RUnlock()
+	if ok {
+		return s
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if s, ok = cs.states[clusterName]; !ok {
+		if cs.states == nil {
+			cs.states = make(map[string]*clusterState)
+		}
+		s = &clusterState{indexers: make(map[string][]cache.Indexer)}
+		cs.states[clusterName] = s
+	}
+	return s
+}
+
+// names 按集群名排序
+func (cs *clusterStates) names() []string {
+	cs.mu.RLock()
+	names := make([]string, 0, len(cs.states))
+	for name := range cs.states {
+		names = append(names, name)
+	}
+	cs.mu.RUnlock()
+	sort.Strings(names)
+	return names
+}
+
+// observeListWatch 记录 list/watch 结果
+func (cs *clusterStates) observeListWatch(clusterName string, err error) {
+	if cs == nil {
+		return
+	}
+	s := cs.stateOf(clusterName)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err == nil {
+		s.lastSuccessAt = time.Now()
+		s.failingSince = time.Time{}
+		s.lastError = ""
+		return
+	}
+	if s.failingSince.IsZero() {
+		s.failingSince = time.Now()
+	}
+	s.lastError = err.Error()
+}
+
+func (cs *clusterStates) observeEvent(clusterName string) {
+	if cs == nil {
+		return
+	}
+	s := cs.stateOf(clusterName)
+	s.mu.Lock()
+	s.lastEventAt = time.Now()
+	s.mu.Unlock()
+}
+
+// Track 记录集群的 indexer 与 informer，用于 /readyz 与 /debug/clusters
+func (c *Controller) Track(clusterName, rType string, indexer cache.Indexer, informer cache.Controller) {
+	s := c.states.stateOf(clusterName)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if indexer != nil {
+		s.indexers[rType] = append(s.indexers[rType], indexer)
+	}
+	if informer != nil {
+		s.informers = append(s.informers, informer)
+	}
+}
+
+// ClusterStatuses 所有集群的状态，按集群名排序
+func (c *Controller) ClusterStatuses() []ClusterStatus {
+	names := c.states.names()
+	statuses := make([]ClusterStatus, 0, len(names))
+	for _, name := range names {
+		s := c.states.stateOf(name)
+		s.mu.RLock()
+		status := ClusterStatus{
+			ClusterName:   name,
+			Connected:     !s.lastSuccessAt.IsZero() && s.failingSince.IsZero(),
+			LastSuccessAt: s.lastSuccessAt,
+			FailingSince:  s.failingSince,
+			LastError:     s.lastError,
+			LastEventAt:   s.lastEventAt,
+			Synced:        true,
+			Objects:       make(map[string]int),
+		}
+		for _, informer := range s.informers {
+			if !informer.HasSynced() {
+				status.Synced = false
+			}
+		}
+		for rType, indexers := range s.indexers {
+			for _, indexer := range indexers {
+				status.Objects[rType] += len(indexer.ListKeys())
+			}
+		}
+		s.mu.RUnlock()
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// Ready 所有 informer 都已同步
+func (c *Controller) Ready() error {
+	notSynced := 0
+	for _, informer := range c.Informers {
+		if informer != nil && !informer.HasSynced() {
+			notSynced++
+		}
+	}
+	if notSynced > 0 {
+		return fmt.Errorf("%d of %d informers have not synced", notSynced, len(c.Informers))
+	}
+	return nil
+}
+
+// Healthy 队列有对象但超过 queueStallTimeout 没有出队，或集群 list/watch 连续失败超过 watchFailureTimeout 时返回错误
+// 超时时间为 0 表示不检查
+func (c *Controller) Healthy(queueStallTimeout, watchFailureTimeout time.Duration) error {
+	if queueStallTimeout > 0 && c.Len() > 0 && !c.lastPop().IsZero() {
+		if since := time.Since(c.lastPop()); since > queueStallTimeout {
+			return fmt.Errorf("queue has %d objects but nothing was popped for %s", c.Len(), since.Round(time.Second))
+		}
+	}
+
+	if watchFailureTimeout > 0 {
+		for _, status := range c.ClusterStatuses() {
+			if !status.FailingSince.IsZero() && time.Since(status.FailingSince) > watchFailureTimeout {
+				return fmt.Errorf("cluster %s list/watch has been failing since %s: %s",
+					status.ClusterName, status.FailingSince.Format(time.RFC3339), status.LastError)
+			}
+		}
+	}
+
+	for _, check := range c.healthChecks {
+		if err := check(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddHealthCheck 需要在 Run 之前调用
+func (c *Controller) AddHealthCheck(check func() error) {
+	c.healthChecks = append(c.healthChecks, check)
+}
+
+// lastPop 最近一次出队的时间，还没有出队时为启动时间，未启动时为零值
+func (c *Controller) lastPop() time.Time {
+	t, _ := c.lastPopAt.Load().(time.Time)
+	return t
+}
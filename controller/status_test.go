@@ -0,0 +1,36 @@
+package controller
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/tools/cache"
+)
+
+// 每个 Controller 只看到自己的集群
+func TestClusterStatusesPerController(t *testing.T) {
+	a, b := &Controller{}, &Controller{}
+	a.Track("c1", "pods", cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{}), nil)
+	b.Track("c2", "pods", nil, nil)
+	a.states.observeListWatch("c1", errors.New("connection refused"))
+	b.states.observeListWatch("c2", nil)
+	b.states.observeEvent("c2")
+
+	statuses := a.ClusterStatuses()
+	if len(statuses) != 1 || statuses[0].ClusterName != "c1" || statuses[0].Connected || statuses[0].LastError == "" {
+		t.Fatalf("a.ClusterStatuses() = %+v, want only the failing c1", statuses)
+	}
+	statuses = b.ClusterStatuses()
+	if len(statuses) != 1 || statuses[0].ClusterName != "c2" || !statuses[0].Connected || statuses[0].LastEventAt.IsZero() {
+		t.Fatalf("b.ClusterStatuses() = %+v, want only the connected c2", statuses)
+	}
+
+	a.states.stateOf("c1").failingSince = time.Now().Add(-time.Hour)
+	if err := a.Healthy(0, time.Minute); err == nil {
+		t.Fatal("a.Healthy() = nil with c1 failing for an hour")
+	}
+	if err := b.Healthy(0, time.Minute); err != nil {
+		t.Fatalf("b.Healthy() = %v", err)
+	}
+}
@@ -0,0 +1,338 @@
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/client-go/tools/cache"
+)
+
+// DefaultIgnore 默认忽略的字段，每次更新都会变化，与对象的实际变更无关
+var DefaultIgnore = []string{
+	"metadata.resourceVersion",
+	"metadata.managedFields",
+	"status.conditions.*.lastHeartbeatTime",
+	"status.conditions.*.lastProbeTime",
+	"spec.renewTime", // coordination.k8s.io Lease
+}
+
+// Config diff 配置
+type Config struct {
+	Enabled bool     `json:"enabled" yaml:"enabled"`
+	Ignore  []string `json:"ignore" yaml:"ignore"` // 忽略的字段，以 . 分隔，* 匹配任意 key 或数组元素，带 . 的 key 写在 [] 中，为空时使用 DefaultIgnore
+}
+
+// Result 旧对象与新对象的差异
+type Result struct {
+	Patch []byte   // RFC 7386 JSON merge patch，没有差异时为 {}
+	Paths []string // 变化的字段，如 spec.replicas、metadata.labels，数组整体算一个字段
+}
+
+// Empty 是否没有差异
+func (r Result) Empty() bool {
+	return len(r.Paths) == 0
+}
+
+// Differ 计算对象差异，忽略配置的字段
+type Differ struct {
+	ignore [][]string
+}
+
+// New ignore 为空时使用 DefaultIgnore
+func New(ignore []string) *Differ {
+	if len(ignore) == 0 {
+		ignore = DefaultIgnore
+	}
+	d := &Differ{}
+	for _, path := range ignore {
+		if path = strings.TrimSpace(path); path != "" {
+			d.ignore = append(d.ignore, SplitPath(path))
+		}
+	}
+	return d
+}
+
+// SplitPath 以 . 分隔字段，[] 中的内容作为一个 key，用于包含 . 的 label 与 annotation
+// 如 metadata.annotations[deployment.kubernetes.io/revision]
+func SplitPath(path string) []string {
+	var segments []string
+	var b strings.Builder
+	flush := func() {
+		if b.Len() > 0 {
+			segments = append(segments, b.String())
+			b.Reset()
+		}
+	}
+	for i := 0; i < len(path); i++ {
+		switch c := path[i]; c {
+		case '.':
+			flush()
+		case '[':
+			flush()
+			end := strings.IndexByte(path[i:], ']')
+			if end < 0 {
+				b.WriteString(path[i+1:])
+				i = len(path)
+				continue
+			}
+			segments = append(segments, path[i+1:i+end])
+			i += end
+		default:
+			b.WriteByte(c)
+		}
+	}
+	flush()
+	return segments
+}
+
+// ParsePath 同 SplitPath，用于校验配置，路径为空、有空的字段或 [ 没有闭合时返回错误
+func ParsePath(path string) ([]string, error) {
+	var segments []string
+	rest := strings.TrimSpace(path)
+	for {
+		var segment string
+		if strings.HasPrefix(rest, "[") {
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("path %q: [ is not closed", path)
+			}
+			segment, rest = rest[1:end], rest[end+1:]
+			if rest != "" && rest[0] != '.' && rest[0] != '[' {
+				return nil, fmt.Errorf("path %q: unexpected %q after ]", path, rest[0])
+			}
+		} else {
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			segment, rest = rest[:end], rest[end:]
+		}
+		if segment == "" {
+			return nil, fmt.Errorf("path %q has an empty field", path)
+		}
+		segments = append(segments, segment)
+		if rest == "" {
+			return segments, nil
+		}
+		if rest[0] == '.' {
+			rest = rest[1:]
+		}
+	}
+}
+
+// Lookup 返回 path 对应的所有值，* 匹配任意 key 或数组元素，数字匹配数组下标
+// 不存在的字段没有值；用 key 访问数组时返回错误，避免两边都取不到值被当成没有变化
+func Lookup(value interface{}, path []string) ([]interface{}, error) {
+	if len(path) == 0 {
+		return []interface{}{value}, nil
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if path[0] != "*" {
+			child, ok := v[path[0]]
+			if !ok {
+				return nil, nil
+			}
+			return Lookup(child, path[1:])
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var values []interface{}
+		for _, k := range keys {
+			found, err := Lookup(v[k], path[1:])
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, found...)
+		}
+		return values, nil
+	case []interface{}:
+		if path[0] != "*" {
+			i, err := strconv.Atoi(path[0])
+			if err != nil {
+				return nil, fmt.Errorf("%q is used as a key of an array, use * or an index", path[0])
+			}
+			if i < 0 || i >= len(v) {
+				return nil, nil
+			}
+			return Lookup(v[i], path[1:])
+		}
+		var values []interface{}
+		for _, child := range v {
+			found, err := Lookup(child, path[1:])
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, found...)
+		}
+		return values, nil
+	}
+	return nil, nil
+}
+
+// Diff 计算从 oldObj 到 newObj 的 merge patch
+func (d *Differ) Diff(oldObj, newObj interface{}) (Result, error) {
+	oldValue, err := toValue(oldObj)
+	if err != nil {
+		return Result{}, err
+	}
+	newValue, err := toValue(newObj)
+	if err != nil {
+		return Result{}, err
+	}
+	for _, path := range d.ignore {
+		remove(oldValue, path)
+		remove(newValue, path)
+	}
+
+	var paths []string
+	patch, changed := mergePatch(oldValue, newValue, "", &paths)
+	if !changed {
+		patch = map[string]interface{}{}
+	}
+	b, err := json.Marshal(patch)
+	if err != nil {
+		return Result{}, err
+	}
+	sort.Strings(paths)
+	return Result{Patch: b, Paths: paths}, nil
+}
+
+// MergePatches 合并两个先后发生的 merge patch，结果等价于依次应用 older 与 newer
+func MergePatches(older, newer string) string {
+	if older == "" {
+		return newer
+	}
+	if newer == "" {
+		return older
+	}
+	var o, n interface{}
+	if json.Unmarshal([]byte(older), &o) != nil || json.Unmarshal([]byte(newer), &n) != nil {
+		return newer
+	}
+	b, err := json.Marshal(mergeValues(o, n))
+	if err != nil {
+		return newer
+	}
+	return string(b)
+}
+
+// mergeValues older 不是对象(如 null 表示删除)时，newer 应用在空对象上，去掉其中的 null
+// 这种情况下 merge patch 无法表示整体替换，原对象中 newer 没有的字段会被保留
+func mergeValues(older, newer interface{}) interface{} {
+	n, ok := newer.(map[string]interface{})
+	if !ok {
+		return newer
+	}
+	o, ok := older.(map[string]interface{})
+	if !ok {
+		o = map[string]interface{}{}
+		for k, v := range n {
+			if v != nil {
+				o[k] = mergeValues(nil, v)
+			}
+		}
+		return o
+	}
+	for k, v := range n {
+		if ov, ok := o[k]; ok {
+			o[k] = mergeValues(ov, v)
+		} else {
+			o[k] = v
+		}
+	}
+	return o
+}
+
+// mergePatch 只有 map 会递归比较，其他类型(包括数组)不同时整体替换，删除的字段为 null
+// changed 为 false 表示没有差异
+func mergePatch(oldValue, newValue interface{}, prefix string, paths *[]string) (patch interface{}, changed bool) {
+	oldMap, ok1 := oldValue.(map[string]interface{})
+	newMap, ok2 := newValue.(map[string]interface{})
+	if !ok1 || !ok2 {
+		if reflect.DeepEqual(oldValue, newValue) {
+			return nil, false
+		}
+		*paths = append(*paths, prefix)
+		return newValue, true
+	}
+
+	patchMap := map[string]interface{}{}
+	for k, ov := range oldMap {
+		nv, ok := newMap[k]
+		if !ok {
+			patchMap[k] = nil
+			*paths = append(*paths, join(prefix, k))
+			continue
+		}
+		if p, changed := mergePatch(ov, nv, join(prefix, k), paths); changed {
+			patchMap[k] = p
+		}
+	}
+	for k, nv := range newMap {
+		if _, ok := oldMap[k]; !ok {
+			patchMap[k] = nv
+			*paths = append(*paths, join(prefix, k))
+		}
+	}
+	return patchMap, len(patchMap) > 0
+}
+
+// remove 删除 path 对应的字段
+func remove(value interface{}, path []string) {
+	if len(path) == 0 {
+		return
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if path[0] == "*" {
+			for k, child := range v {
+				if len(path) == 1 {
+					delete(v, k)
+					continue
+				}
+				remove(child, path[1:])
+			}
+			return
+		}
+		if len(path) == 1 {
+			delete(v, path[0])
+			return
+		}
+		remove(v[path[0]], path[1:])
+	case []interface{}:
+		if path[0] != "*" {
+			return
+		}
+		for _, child := range v {
+			remove(child, path[1:])
+		}
+	}
+}
+
+func toValue(obj interface{}) (interface{}, error) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	err = json.Unmarshal(b, &value)
+	return value, err
+}
+
+func join(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
@@ -0,0 +1,159 @@
+package diff
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestSplitPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"spec.replicas", []string{"spec", "replicas"}},
+		{"metadata.labels[app.kubernetes.io/name]", []string{"metadata", "labels", "app.kubernetes.io/name"}},
+		{"[a.b].c", []string{"a.b", "c"}},
+		{"status.conditions.*.lastProbeTime", []string{"status", "conditions", "*", "lastProbeTime"}},
+	}
+	for _, tt := range tests {
+		if got := SplitPath(tt.path); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SplitPath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+		if got, err := ParsePath(tt.path); err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParsePath(%q) = %q, %v, want %q", tt.path, got, err, tt.want)
+		}
+	}
+}
+
+func TestParsePathInvalid(t *testing.T) {
+	for _, path := range []string{"", " ", "a..b", "a.", "a[b", "a[]", "a[b]c"} {
+		if got, err := ParsePath(path); err == nil {
+			t.Errorf("ParsePath(%q) = %q, want error", path, got)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	var value interface{}
+	_ = json.Unmarshal([]byte(`{"spec":{"containers":[{"image":"a"},{"image":"b"}]},"metadata":{"labels":{"x.y":"1","z":"2"}}}`), &value)
+	tests := []struct {
+		path    string
+		want    []interface{}
+		wantErr bool
+	}{
+		{"metadata.labels[x.y]", []interface{}{"1"}, false},
+		{"metadata.labels.*", []interface{}{"1", "2"}, false},
+		{"metadata.missing", nil, false},
+		{"spec.containers.*.image", []interface{}{"a", "b"}, false},
+		{"spec.containers.1.image", []interface{}{"b"}, false},
+		{"spec.containers.5.image", nil, false},
+		{"spec.containers.image", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := Lookup(value, SplitPath(tt.path))
+		if (err != nil) != tt.wantErr || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Lookup(%q) = %v, %v, want %v", tt.path, got, err, tt.want)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		ignore   []string
+		old, new string
+		patch    string
+		paths    []string
+	}{
+		{"no change", nil, `{"a":1}`, `{"a":1}`, `{}`, nil},
+		{"ignored resourceVersion", nil,
+			`{"metadata":{"resourceVersion":"1"}}`, `{"metadata":{"resourceVersion":"2"}}`, `{}`, nil},
+		{"changed and removed", nil,
+			`{"spec":{"replicas":1,"paused":true}}`, `{"spec":{"replicas":2}}`,
+			`{"spec":{"paused":null,"replicas":2}}`, []string{"spec.paused", "spec.replicas"}},
+		{"array replaced", nil, `{"a":[1,2]}`, `{"a":[1,3]}`, `{"a":[1,3]}`, []string{"a"}},
+		{"ignored dotted label", []string{"metadata.labels[x.y]"},
+			`{"metadata":{"labels":{"x.y":"1","z":"1"}}}`, `{"metadata":{"labels":{"x.y":"2","z":"1"}}}`, `{}`, nil},
+		{"ignored field in array", []string{"items.*.time"},
+			`{"items":[{"time":1,"v":1}]}`, `{"items":[{"time":2,"v":1}]}`, `{}`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := New(tt.ignore).Diff(json.RawMessage(tt.old), json.RawMessage(tt.new))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(result.Patch) != tt.patch || !reflect.DeepEqual(result.Paths, tt.paths) {
+				t.Errorf("Diff = %s %q, want %s %q", result.Patch, result.Paths, tt.patch, tt.paths)
+			}
+		})
+	}
+}
+
+func TestMergePatches(t *testing.T) {
+	tests := []struct {
+		name         string
+		older, newer string
+		want         string
+	}{
+		{"empty older", ``, `{"a":1}`, `{"a":1}`},
+		{"empty newer", `{"a":1}`, ``, `{"a":1}`},
+		{"newer wins", `{"a":1,"b":1}`, `{"a":2}`, `{"a":2,"b":1}`},
+		{"nested merge keeps nulls", `{"m":{"a":1}}`, `{"m":{"b":null}}`, `{"m":{"a":1,"b":null}}`},
+		{"newer deletes", `{"m":{"a":1}}`, `{"m":null}`, `{"m":null}`},
+		{"new key keeps nulls", `{"a":1}`, `{"m":{"b":null}}`, `{"a":1,"m":{"b":null}}`},
+		// older 删除了 m，newer 在空对象上设置 m，其中的 null 没有意义
+		{"deleted then set", `{"m":null}`, `{"m":{"a":1,"b":null,"c":{"d":null}}}`, `{"m":{"a":1,"c":{}}}`},
+		{"scalar then object", `{"m":"x"}`, `{"m":{"a":1}}`, `{"m":{"a":1}}`},
+		{"invalid older", `{`, `{"a":1}`, `{"a":1}`},
+	}
+	for _, tt := range tests {
+		if got := MergePatches(tt.older, tt.newer); got != tt.want {
+			t.Errorf("%s: MergePatches(%s, %s) = %s, want %s", tt.name, tt.older, tt.newer, got, tt.want)
+		}
+	}
+}
+
+func TestMergePatchesApply(t *testing.T) {
+	// 依次应用两个 patch 与应用合并后的 patch 结果相同
+	original := `{"a":1,"m":{"x":1},"n":{"y":1}}`
+	older, newer := `{"a":2,"m":{"x":null},"n":null}`, `{"m":{"z":1},"n":{"y":2}}`
+	want := apply(t, apply(t, original, older), newer)
+	if got := apply(t, original, MergePatches(older, newer)); got != want {
+		t.Errorf("applying merged patch = %s, want %s", got, want)
+	}
+}
+
+// apply 按 RFC 7386 应用 merge patch
+func apply(t *testing.T, target, patch string) string {
+	t.Helper()
+	var tv, pv interface{}
+	if err := json.Unmarshal([]byte(target), &tv); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(patch), &pv); err != nil {
+		t.Fatal(err)
+	}
+	b, _ := json.Marshal(applyValue(tv, pv))
+	return string(b)
+}
+
+func applyValue(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	m, ok := target.(map[string]interface{})
+	if !ok {
+		m = map[string]interface{}{}
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(m, k)
+			continue
+		}
+		m[k] = applyValue(m[k], v)
+	}
+	return m
+}
@@ -0,0 +1,361 @@
+package drift
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"multiple-k8s-informer/diff"
+	"multiple-k8s-informer/metrics"
+	"multiple-k8s-informer/resource"
+	"multiple-k8s-informer/store"
+
+	"k8s.io/klog"
+)
+
+// DefaultInterval 默认比较间隔
+const DefaultInterval = time.Minute
+
+// DefaultIgnore 默认忽略的字段，每个集群中必然不同或由集群生成，与对象的配置无关
+var DefaultIgnore = []string{
+	"metadata.uid",
+	"metadata.resourceVersion",
+	"metadata.generation",
+	"metadata.creationTimestamp",
+	"metadata.managedFields",
+	"metadata.selfLink",
+	"metadata.ownerReferences.*.uid",
+	"metadata.annotations[deployment.kubernetes.io/revision]",
+	"metadata.annotations[kubectl.kubernetes.io/last-applied-configuration]",
+	"spec.clusterIP",  // Service
+	"spec.clusterIPs", // Service
+	"status",
+}
+
+// 漂移事件类型
+const (
+	EventDetected = "detected" // 新出现的漂移
+	EventChanged  = "changed"  // 差异发生了变化
+	EventResolved = "resolved" // 各集群已一致
+)
+
+// Config 跨集群漂移检测配置
+type Config struct {
+	Enabled  bool          `json:"enabled" yaml:"enabled"`
+	Interval time.Duration `json:"interval" yaml:"interval"` // 比较间隔，默认 1m
+	Ignore   []string      `json:"ignore" yaml:"ignore"`     // 在 DefaultIgnore 之外忽略的字段，语法同 diff.ignore
+	Targets  []Target      `json:"targets" yaml:"targets"`
+}
+
+// Target 需要比较的资源
+type Target struct {
+	Resource      string   `json:"resource" yaml:"resource"`           // 如 deployments、configmaps
+	Namespaces    []string `json:"namespaces" yaml:"namespaces"`       // 为空表示所有 namespace
+	Clusters      []string `json:"clusters" yaml:"clusters"`           // 参与比较的集群，为空表示所有监听了该资源的集群
+	Baseline      string   `json:"baseline" yaml:"baseline"`           // 基准集群，为空或不存在该对象时使用第一个存在该对象的集群(按名字排序)
+	Ignore        []string `json:"ignore" yaml:"ignore"`               // 该资源额外忽略的字段
+	IgnoreMissing bool     `json:"ignoreMissing" yaml:"ignoreMissing"` // 对象只存在于部分集群时不算漂移
+}
+
+// Difference 一个集群与基准集群的差异
+type Difference struct {
+	Cluster string          `json:"cluster"`
+	Missing bool            `json:"missing,omitempty"` // 集群中不存在该对象
+	Paths   []string        `json:"paths,omitempty"`   // 不同的字段
+	Patch   json.RawMessage `json:"patch,omitempty"`   // 从基准对象到该集群对象的 JSON merge patch，secrets 不输出
+}
+
+// Drift 同名对象在各集群之间的差异
+type Drift struct {
+	Resource    string       `json:"resource"`
+	Namespace   string       `json:"namespace,omitempty"`
+	Name        string       `json:"name"`
+	Baseline    string       `json:"baseline"`
+	Differences []Difference `json:"differences"`
+	DetectedAt  time.Time    `json:"detectedAt"` // 第一次发现漂移的时间
+}
+
+// Key <resource>/<namespace>/<name>
+func (d Drift) Key() string {
+	return d.Resource + "/" + d.Namespace + "/" + d.Name
+}
+
+// Event 漂移事件
+type Event struct {
+	Type  string    `json:"type"` // detected / changed / resolved
+	Time  time.Time `json:"time"`
+	Drift Drift     `json:"drift"` // resolved 时为最后一次的差异
+}
+
+// Handler 处理漂移事件
+type Handler func(Event)
+
+// Report 一次比较的结果
+type Report struct {
+	GeneratedAt time.Time      `json:"generatedAt"`
+	Compared    map[string]int `json:"compared"` // 资源类型 -> 比较的对象数量
+	Drifts      []Drift        `json:"drifts"`
+}
+
+// Detector 定时比较 Store 中各集群同一 namespace/name 的对象，输出漂移事件与报告
+type Detector struct {
+	cs       store.ClusterStore
+	targets  []target
+	interval time.Duration
+
+	mu       sync.RWMutex
+	report   Report
+	drifts   map[string]Drift
+	handlers []Handler
+}
+
+type target struct {
+	Target
+	differ *diff.Differ
+}
+
+// NewDetector 同一资源的多个 target 的 namespace 有重叠时返回错误，否则同一对象会被比较并计数多次
+func NewDetector(config Config, cs store.ClusterStore) (*Detector, error) {
+	for i, a := range config.Targets {
+		for j, b := range config.Targets[:i] {
+			if a.Resource == b.Resource && overlap(a.Namespaces, b.Namespaces) {
+				return nil, fmt.Errorf("drift.targets[%d] and drift.targets[%d] both compare %s in namespaces %v and %v", j, i, a.Resource, b.Namespaces, a.Namespaces)
+			}
+		}
+	}
+	if config.Interval <= 0 {
+		config.Interval = DefaultInterval
+	}
+	d := &Detector{
+		cs:       cs,
+		interval: config.Interval,
+		report:   Report{Compared: map[string]int{}, Drifts: []Drift{}},
+		drifts:   make(map[string]Drift),
+	}
+	for _, t := range config.Targets {
+		ignore := append(append(append([]string{}, DefaultIgnore...), config.Ignore...), t.Ignore...)
+		d.targets = append(d.targets, target{Target: t, differ: diff.New(ignore)})
+	}
+	return d, nil
+}
+
+// overlap 两组 namespace 是否有交集，为空表示所有 namespace
+func overlap(a, b []string) bool {
+	if len(a) == 0 || len(b) == 0 {
+		return true
+	}
+	for _, namespace := range a {
+		if slices.Contains(b, namespace) {
+			return true
+		}
+	}
+	return false
+}
+
+// AddEventHandler 加入漂移事件的回调
+func (d *Detector) AddEventHandler(handler Handler) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.handlers = append(d.handlers, handler)
+}
+
+// Run 每隔 Interval 比较一次，直到 ctx 结束，需要在 informer 同步完成后调用
+func (d *Detector) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		d.Detect()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Detect 比较一次，与上一次的结果对比后调用 handler，返回本次的报告
+func (d *Detector) Detect() Report {
+	now := time.Now()
+	report := Report{GeneratedAt: now, Compared: map[string]int{}, Drifts: []Drift{}}
+	for _, t := range d.targets {
+		drifts, compared := d.compare(t)
+		report.Compared[t.Resource] += compared
+		report.Drifts = append(report.Drifts, drifts...)
+	}
+	sort.Slice(report.Drifts, func(i, j int) bool {
+		return report.Drifts[i].Key() < report.Drifts[j].Key()
+	})
+
+	d.mu.Lock()
+	var events []Event
+	current := make(map[string]Drift, len(report.Drifts))
+	for i, drift := range report.Drifts {
+		previous, ok := d.drifts[drift.Key()]
+		switch {
+		case !ok:
+			drift.DetectedAt = now
+			events = append(events, Event{Type: EventDetected, Time: now, Drift: drift})
+		case !reflect.DeepEqual(previous.Differences, drift.Differences) || previous.Baseline != drift.Baseline:
+			drift.DetectedAt = previous.DetectedAt
+			events = append(events, Event{Type: EventChanged, Time: now, Drift: drift})
+		default:
+			drift.DetectedAt = previous.DetectedAt
+		}
+		report.Drifts[i] = drift
+		current[drift.Key()] = drift
+	}
+	var resolved []string
+	for key := range d.drifts {
+		if _, ok := current[key]; !ok {
+			resolved = append(resolved, key)
+		}
+	}
+	sort.Strings(resolved)
+	for _, key := range resolved {
+		events = append(events, Event{Type: EventResolved, Time: now, Drift: d.drifts[key]})
+	}
+	d.drifts = current
+	d.report = report
+	handlers := d.handlers
+	d.mu.Unlock()
+
+	counts := map[string]int{}
+	for _, t := range d.targets {
+		counts[t.Resource] = 0
+	}
+	for _, drift := range report.Drifts {
+		counts[drift.Resource]++
+	}
+	for rType, n := range counts {
+		metrics.SetDriftObjects(rType, n)
+	}
+	for _, event := range events {
+		metrics.ObserveDrift(event.Drift.Resource, event.Type)
+		for _, handler := range handlers {
+			handler(event)
+		}
+	}
+	return report
+}
+
+// Report 最近一次比较的结果
+func (d *Detector) Report() Report {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.report
+}
+
+// ServeHTTP 返回最近一次比较的结果，可用 ?resource=&namespace= 过滤
+func (d *Detector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	report := d.Report()
+	query := r.URL.Query()
+	if rType, namespace := query.Get("resource"), query.Get("namespace"); rType != "" || namespace != "" {
+		drifts := []Drift{}
+		for _, drift := range report.Drifts {
+			if (rType == "" || drift.Resource == rType) && (namespace == "" || drift.Namespace == namespace) {
+				drifts = append(drifts, drift)
+			}
+		}
+		report.Drifts = drifts
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		klog.Error("write drift report error: ", err)
+	}
+}
+
+// LogHandler 将漂移事件输出到日志
+func LogHandler(event Event) {
+	drift := event.Drift
+	clusters := make([]string, 0, len(drift.Differences))
+	for _, difference := range drift.Differences {
+		clusters = append(clusters, difference.Cluster)
+	}
+	klog.Infof("[drift] %s %s %s/%s baseline=%s clusters=%v", event.Type, drift.Resource, drift.Namespace, drift.Name, drift.Baseline, clusters)
+}
+
+// compare 比较一种资源，返回存在漂移的对象与比较的对象数量
+func (d *Detector) compare(t target) ([]Drift, int) {
+	var clusters []string
+	for _, cluster := range d.cs.Clusters() {
+		if resource.Match(t.Clusters, cluster) && slices.Contains(d.cs.Resources(cluster), t.Resource) {
+			clusters = append(clusters, cluster)
+		}
+	}
+	if len(clusters) < 2 {
+		return nil, 0
+	}
+	sort.Strings(clusters)
+
+	// namespace/name -> 集群 -> 对象
+	objects := make(map[string]map[string]interface{})
+	for _, cluster := range clusters {
+		for _, obj := range d.cs.ListByCluster(cluster, t.Resource) {
+			accessor, err := resource.Accessor(obj)
+			if err != nil || !resource.Match(t.Namespaces, accessor.GetNamespace()) {
+				continue
+			}
+			key := accessor.GetNamespace() + "/" + accessor.GetName()
+			if objects[key] == nil {
+				objects[key] = make(map[string]interface{}, len(clusters))
+			}
+			objects[key][cluster] = obj
+		}
+	}
+
+	var drifts []Drift
+	for key, byCluster := range objects {
+		baseline := t.Baseline
+		if _, ok := byCluster[baseline]; !ok {
+			for _, cluster := range clusters {
+				if _, ok := byCluster[cluster]; ok {
+					baseline = cluster
+					break
+				}
+			}
+		}
+
+		var differences []Difference
+		for _, cluster := range clusters {
+			if cluster == baseline {
+				continue
+			}
+			obj, ok := byCluster[cluster]
+			if !ok {
+				if !t.IgnoreMissing {
+					differences = append(differences, Difference{Cluster: cluster, Missing: true})
+				}
+				continue
+			}
+			result, err := t.differ.Diff(byCluster[baseline], obj)
+			if err != nil {
+				klog.Error("drift diff error: ", err)
+				continue
+			}
+			if result.Empty() {
+				continue
+			}
+			difference := Difference{Cluster: cluster, Paths: result.Paths, Patch: result.Patch}
+			if t.Resource == resource.Secrets {
+				// 不输出 secret 的内容
+				difference.Patch = nil
+			}
+			differences = append(differences, difference)
+		}
+		if len(differences) == 0 {
+			continue
+		}
+
+		namespace, name, _ := strings.Cut(key, "/")
+		drifts = append(drifts, Drift{Resource: t.Resource, Namespace: namespace, Name: name, Baseline: baseline, Differences: differences})
+	}
+	return drifts, len(objects)
+}
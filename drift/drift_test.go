@@ -0,0 +1,272 @@
+package drift
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"multiple-k8s-informer/resource"
+	"multiple-k8s-informer/store"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// fakeStore 集群 -> 资源类型 -> 对象，测试中可以直接修改
+type fakeStore struct {
+	store.Store
+	objects map[string]map[string][]interface{}
+}
+
+var _ store.ClusterStore = &fakeStore{}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{objects: map[string]map[string][]interface{}{}}
+}
+
+// set 替换集群中资源类型的所有对象
+func (s *fakeStore) set(cluster, rType string, objs ...interface{}) {
+	if s.objects[cluster] == nil {
+		s.objects[cluster] = map[string][]interface{}{}
+	}
+	s.objects[cluster][rType] = objs
+}
+
+func (s *fakeStore) Clusters() []string {
+	var clusters []string
+	for cluster := range s.objects {
+		clusters = append(clusters, cluster)
+	}
+	sort.Strings(clusters)
+	return clusters
+}
+
+func (s *fakeStore) Resources(cluster string) []string {
+	var resources []string
+	for rType := range s.objects[cluster] {
+		resources = append(resources, rType)
+	}
+	return resources
+}
+
+func (s *fakeStore) ListByCluster(cluster, rType string) []interface{} {
+	return s.objects[cluster][rType]
+}
+
+func (s *fakeStore) GetByClusterKey(cluster, rType, key string) (interface{}, bool) {
+	return nil, false
+}
+
+// deployment 各集群中 uid、resourceVersion、status 不同
+func deployment(cluster, name string, replicas int32) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, UID: types.UID(cluster + "-" + name), ResourceVersion: cluster},
+		Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+		Status:     appsv1.DeploymentStatus{ReadyReplicas: replicas, ObservedGeneration: int64(len(cluster))},
+	}
+}
+
+// summary 每个漂移为 <namespace>/<name>@<baseline>:<cluster>(<paths>|missing)
+func summary(report Report) string {
+	var drifts []string
+	for _, drift := range report.Drifts {
+		var clusters []string
+		for _, d := range drift.Differences {
+			detail := strings.Join(d.Paths, "+")
+			if d.Missing {
+				detail = "missing"
+			}
+			clusters = append(clusters, d.Cluster+"("+detail+")")
+		}
+		drifts = append(drifts, drift.Namespace+"/"+drift.Name+"@"+drift.Baseline+":"+strings.Join(clusters, ","))
+	}
+	return strings.Join(drifts, " ")
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		setup  func(s *fakeStore)
+		want   string
+	}{
+		{"identical except ignored fields", Config{Targets: []Target{{Resource: resource.Deployments}}}, func(s *fakeStore) {
+			s.set("c1", resource.Deployments, deployment("c1", "web", 2))
+			s.set("c2", resource.Deployments, deployment("c2", "web", 2))
+		}, ""},
+		{"changed field", Config{Targets: []Target{{Resource: resource.Deployments}}}, func(s *fakeStore) {
+			s.set("c1", resource.Deployments, deployment("c1", "web", 2))
+			s.set("c2", resource.Deployments, deployment("c2", "web", 3))
+		}, "default/web@c1:c2(spec.replicas)"},
+		{"global ignore", Config{Ignore: []string{"spec.replicas"}, Targets: []Target{{Resource: resource.Deployments}}}, func(s *fakeStore) {
+			s.set("c1", resource.Deployments, deployment("c1", "web", 2))
+			s.set("c2", resource.Deployments, deployment("c2", "web", 3))
+		}, ""},
+		{"target ignore", Config{Targets: []Target{{Resource: resource.Deployments, Ignore: []string{"spec.replicas"}}}}, func(s *fakeStore) {
+			s.set("c1", resource.Deployments, deployment("c1", "web", 2))
+			s.set("c2", resource.Deployments, deployment("c2", "web", 3))
+		}, ""},
+		{"missing", Config{Targets: []Target{{Resource: resource.Deployments}}}, func(s *fakeStore) {
+			s.set("c1", resource.Deployments, deployment("c1", "web", 2))
+			s.set("c2", resource.Deployments, deployment("c2", "web", 2))
+			s.set("c3", resource.Deployments)
+		}, "default/web@c1:c3(missing)"},
+		{"ignore missing", Config{Targets: []Target{{Resource: resource.Deployments, IgnoreMissing: true}}}, func(s *fakeStore) {
+			s.set("c1", resource.Deployments, deployment("c1", "web", 2))
+			s.set("c2", resource.Deployments)
+		}, ""},
+		{"cluster without the resource is not compared", Config{Targets: []Target{{Resource: resource.Deployments}}}, func(s *fakeStore) {
+			s.set("c1", resource.Deployments, deployment("c1", "web", 2))
+			s.set("c2", resource.Deployments, deployment("c2", "web", 2))
+			s.set("c3", resource.Pods)
+		}, ""},
+		{"baseline", Config{Targets: []Target{{Resource: resource.Deployments, Baseline: "c2"}}}, func(s *fakeStore) {
+			s.set("c1", resource.Deployments, deployment("c1", "web", 2))
+			s.set("c2", resource.Deployments, deployment("c2", "web", 3))
+		}, "default/web@c2:c1(spec.replicas)"},
+		// 基准集群中不存在该对象时，使用第一个存在该对象的集群
+		{"baseline fallback", Config{Targets: []Target{{Resource: resource.Deployments, Baseline: "c1"}}}, func(s *fakeStore) {
+			s.set("c1", resource.Deployments)
+			s.set("c2", resource.Deployments, deployment("c2", "web", 2))
+			s.set("c3", resource.Deployments, deployment("c3", "web", 3))
+		}, "default/web@c2:c1(missing),c3(spec.replicas)"},
+		{"namespaces and clusters", Config{Targets: []Target{{Resource: resource.Deployments, Namespaces: []string{"prod"}, Clusters: []string{"c1", "c2"}}}}, func(s *fakeStore) {
+			prod := deployment("c2", "api", 3)
+			prod.Namespace = "prod"
+			s.set("c1", resource.Deployments, deployment("c1", "web", 2))
+			s.set("c2", resource.Deployments, deployment("c2", "web", 3), prod)
+			s.set("c3", resource.Deployments, deployment("c3", "web", 4))
+		}, "prod/api@c2:c1(missing)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newFakeStore()
+			tt.setup(s)
+			d, err := NewDetector(tt.config, s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := summary(d.Detect()); got != tt.want {
+				t.Fatalf("drifts = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// 多次 Detect 之间依次输出 detected、changed、resolved，DetectedAt 保持第一次发现的时间
+func TestDetectEvents(t *testing.T) {
+	s := newFakeStore()
+	d, err := NewDetector(Config{Targets: []Target{{Resource: resource.Deployments}}}, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []Event
+	d.AddEventHandler(func(e Event) { events = append(events, e) })
+
+	steps := []struct {
+		c2     *appsv1.Deployment
+		events string
+		want   string
+	}{
+		{deployment("c2", "web", 2), "", ""},
+		{deployment("c2", "web", 3), EventDetected, "default/web@c1:c2(spec.replicas)"},
+		{deployment("c2", "web", 3), "", "default/web@c1:c2(spec.replicas)"},
+		{deployment("c2", "web", 4), EventChanged, "default/web@c1:c2(spec.replicas)"},
+		{deployment("c2", "web", 2), EventResolved, ""},
+	}
+	var detectedAt []string
+	for i, step := range steps {
+		s.set("c1", resource.Deployments, deployment("c1", "web", 2))
+		s.set("c2", resource.Deployments, step.c2)
+		events = nil
+		report := d.Detect()
+
+		var types []string
+		for _, e := range events {
+			types = append(types, e.Type)
+		}
+		if got := strings.Join(types, ","); got != step.events {
+			t.Fatalf("step %d: events = %q, want %q", i, got, step.events)
+		}
+		if got := summary(report); got != step.want {
+			t.Fatalf("step %d: drifts = %q, want %q", i, got, step.want)
+		}
+		if !reflect.DeepEqual(d.Report(), report) {
+			t.Fatalf("step %d: Report() is not the last report", i)
+		}
+		for _, drift := range report.Drifts {
+			detectedAt = append(detectedAt, drift.DetectedAt.String())
+		}
+	}
+	if len(detectedAt) != 3 || detectedAt[0] != detectedAt[1] || detectedAt[1] != detectedAt[2] {
+		t.Fatalf("detectedAt = %v, want the time of the first detection", detectedAt)
+	}
+}
+
+// secret 只输出不同的字段，不输出内容
+func TestDetectSecretPatch(t *testing.T) {
+	secret := func(value string) *v1.Secret {
+		return &v1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "token"}, Data: map[string][]byte{"token": []byte(value)}}
+	}
+	configMap := func(value string) *v1.ConfigMap {
+		return &v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "settings"}, Data: map[string]string{"level": value}}
+	}
+	s := newFakeStore()
+	s.set("c1", resource.Secrets, secret("a"))
+	s.set("c2", resource.Secrets, secret("b"))
+	s.set("c1", resource.ConfigMaps, configMap("info"))
+	s.set("c2", resource.ConfigMaps, configMap("debug"))
+	d, err := NewDetector(Config{Targets: []Target{{Resource: resource.Secrets}, {Resource: resource.ConfigMaps}}}, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report := d.Detect()
+	if len(report.Drifts) != 2 {
+		t.Fatalf("drifts = %q, want the configmap and the secret", summary(report))
+	}
+	for _, drift := range report.Drifts {
+		difference := drift.Differences[0]
+		if len(difference.Paths) == 0 {
+			t.Fatalf("%s has no paths", drift.Key())
+		}
+		if hasPatch := difference.Patch != nil; hasPatch != (drift.Resource != resource.Secrets) {
+			t.Fatalf("%s patch = %s", drift.Key(), difference.Patch)
+		}
+	}
+	if report.Compared[resource.Secrets] != 1 || report.Compared[resource.ConfigMaps] != 1 {
+		t.Fatalf("compared = %v", report.Compared)
+	}
+}
+
+// 同一资源的 target 的 namespace 重叠时，同一对象会被比较多次
+func TestNewDetectorOverlappingTargets(t *testing.T) {
+	tests := []struct {
+		name    string
+		targets []Target
+		wantErr bool
+	}{
+		{"different resources", []Target{{Resource: resource.Deployments}, {Resource: resource.ConfigMaps}}, false},
+		{"disjoint namespaces", []Target{
+			{Resource: resource.Deployments, Namespaces: []string{"prod"}},
+			{Resource: resource.Deployments, Namespaces: []string{"staging"}, Ignore: []string{"spec.replicas"}},
+		}, false},
+		{"duplicate", []Target{{Resource: resource.Deployments}, {Resource: resource.Deployments}}, true},
+		{"all namespaces", []Target{{Resource: resource.Deployments, Namespaces: []string{"prod"}}, {Resource: resource.Deployments}}, true},
+		{"shared namespace", []Target{
+			{Resource: resource.Deployments, Namespaces: []string{"prod", "default"}, Clusters: []string{"c1", "c2"}},
+			{Resource: resource.Deployments, Namespaces: []string{"default"}, Clusters: []string{"c3", "c4"}},
+		}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewDetector(Config{Targets: tt.targets}, newFakeStore())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewDetector() = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -1,16 +1,29 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"multiple-k8s-informer/aggregate"
+	"multiple-k8s-informer/alert"
+	"multiple-k8s-informer/api"
 	"multiple-k8s-informer/config"
 	"multiple-k8s-informer/controller"
+	"multiple-k8s-informer/diff"
+	"multiple-k8s-informer/drift"
+	"multiple-k8s-informer/metrics"
 	"multiple-k8s-informer/queue"
 	"multiple-k8s-informer/resource"
+	"multiple-k8s-informer/server"
+	"multiple-k8s-informer/sink"
 	"multiple-k8s-informer/store"
+	"multiple-k8s-informer/stream"
 	"time"
 
+	_ "github.com/lib/pq"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/klog"
+	_ "modernc.org/sqlite"
 )
 
 func NewMultiClusterInformerFromConfig(path string) (controller.MultiClusterInformer, error) {
@@ -19,18 +32,83 @@ func NewMultiClusterInformerFromConfig(path string) (controller.MultiClusterInfo
 		klog.Error("load config error: ", err)
 		return nil, err
 	}
+	config.SysConfig = sysConfig
 
-	return NewMultiClusterInformer(sysConfig.MaxReQueueTime, sysConfig.Clusters)
+	rateLimiter, err := sysConfig.RateLimiter.NewRateLimiter()
+	if err != nil {
+		klog.Error("rate limiter config error: ", err)
+		return nil, err
+	}
+
+	var wq *queue.Wq
+	switch {
+	case sysConfig.FairQueue.Enabled && sysConfig.PriorityQueue.Enabled:
+		return nil, errors.New("fairQueue and priorityQueue can not be enabled at the same time")
+	case sysConfig.FairQueue.Enabled:
+		wq = queue.NewFairQueue(sysConfig.MaxReQueueTime, rateLimiter, sysConfig.FairQueue)
+	case sysConfig.PriorityQueue.Enabled:
+		wq = queue.NewPriorityQueue(sysConfig.MaxReQueueTime, rateLimiter, sysConfig.PriorityQueue, nil)
+	default:
+		wq = queue.NewQueueWithRateLimiter(sysConfig.MaxReQueueTime, rateLimiter)
+	}
+	wq.SetDeadLetter(queue.NewRingDeadLetter(sysConfig.DeadLetterSize))
 
+	var q queue.Queue = wq
+	if sysConfig.Coalesce {
+		q = queue.NewCoalescingQueue(wq)
+	}
+	var pq *queue.PersistentQueue
+	if sysConfig.Persistence.Enabled {
+		if pq, err = queue.NewPersistentQueue(q, sysConfig.Persistence); err != nil {
+			klog.Error("persistent queue error: ", err)
+			return nil, err
+		}
+		q = pq
+	}
+	if sysConfig.Aggregate.Enabled {
+		// 聚合在持久化之外：wal 中是合成的 Event，重启时由重放的 Event 恢复组的状态
+		q = aggregate.NewQueue(q, sysConfig.Aggregate)
+	}
+
+	predicates, err := sysConfig.Predicates.UpdatePredicates()
+	if err != nil {
+		klog.Error("update predicate config error: ", err)
+		return nil, err
+	}
+	core := &controller.Controller{Queue: q, UpdatePredicates: predicates}
+	if sysConfig.Diff.Enabled {
+		core.Differ = diff.New(sysConfig.Diff.Ignore)
+	}
+
+	informer, err := newMultiClusterInformer(core, sysConfig.Clusters)
+	if err != nil {
+		return nil, err
+	}
+	if pq != nil {
+		// wal 不可写时 /healthz 返回错误
+		informer.AddHealthCheck(pq.Err)
+	}
+	return informer, nil
 }
 
 func NewMultiClusterInformer(maxReQueueTime int, clusters []controller.Cluster) (controller.MultiClusterInformer, error) {
-	core := &controller.Controller{
-		Queue:  queue.NewQueue(maxReQueueTime),
-		StopCh: make(chan struct{}, 1),
-	}
+	return NewMultiClusterInformerWithQueue(queue.NewQueue(maxReQueueTime), clusters)
+}
+
+// NewMultiClusterInformerWithQueue 使用自定义的队列创建多集群informer
+func NewMultiClusterInformerWithQueue(q queue.Queue, clusters []controller.Cluster) (controller.MultiClusterInformer, error) {
+	return newMultiClusterInformer(&controller.Controller{Queue: q}, clusters)
+}
 
-	store := make(store.MapIndexers)
+// newMultiClusterInformer 为 core 创建各集群的 informer，core 中已设置 Queue 以及 Differ 等事件处理选项
+func newMultiClusterInformer(core *controller.Controller, clusters []controller.Cluster) (controller.MultiClusterInformer, error) {
+	broadcaster := stream.NewBroadcaster()
+	core.Queue = stream.NewPublishingQueue(core.Queue, broadcaster)
+	core.StopCh = make(chan struct{}, 1)
+	core.Broadcaster = broadcaster
+	metrics.RegisterQueueDepth(queue.QueueName, core.Len)
+
+	clusterStore := make(store.ClusterIndexers)
 	informers := make(controller.InformerList, 0)
 
 	for _, cluster := range clusters {
@@ -40,6 +118,10 @@ func NewMultiClusterInformer(maxReQueueTime int, clusters []controller.Cluster)
 			return nil, err
 		}
 
+		// 通过 LoadConfig 加载的配置已经编译，这里不会重复编译
+		if err := cluster.CompileFilters(); err != nil {
+			return nil, err
+		}
 		for _, r := range cluster.List {
 			if r.Namespace == resource.All {
 				//当 namespace为 all的时候单独处理
@@ -48,28 +130,29 @@ func NewMultiClusterInformer(maxReQueueTime int, clusters []controller.Cluster)
 
 				switch r.RType {
 				case resource.Deployments:
-					indexerListRes, informerListRes = r.CreateAllAppsV1IndexInformer(client, core.Queue, cluster.ClusterName)
+					indexerListRes, informerListRes = r.CreateAllAppsV1IndexInformerWithController(client, core, cluster.ClusterName)
 				case resource.Statefulsets:
-					indexerListRes, informerListRes = r.CreateAllAppsV1IndexInformer(client, core.Queue, cluster.ClusterName)
+					indexerListRes, informerListRes = r.CreateAllAppsV1IndexInformerWithController(client, core, cluster.ClusterName)
 				case resource.Daemonsets:
-					indexerListRes, informerListRes = r.CreateAllAppsV1IndexInformer(client, core.Queue, cluster.ClusterName)
+					indexerListRes, informerListRes = r.CreateAllAppsV1IndexInformerWithController(client, core, cluster.ClusterName)
 
 				case resource.Pods:
-					indexerListRes, informerListRes = r.CreateAllCoreV1IndexInformer(client, core.Queue, cluster.ClusterName)
+					indexerListRes, informerListRes = r.CreateAllCoreV1IndexInformerWithController(client, core, cluster.ClusterName)
 				case resource.ConfigMaps:
-					indexerListRes, informerListRes = r.CreateAllCoreV1IndexInformer(client, core.Queue, cluster.ClusterName)
+					indexerListRes, informerListRes = r.CreateAllCoreV1IndexInformerWithController(client, core, cluster.ClusterName)
 				case resource.Secrets:
-					indexerListRes, informerListRes = r.CreateAllCoreV1IndexInformer(client, core.Queue, cluster.ClusterName)
+					indexerListRes, informerListRes = r.CreateAllCoreV1IndexInformerWithController(client, core, cluster.ClusterName)
 				case resource.Services:
-					indexerListRes, informerListRes = r.CreateAllCoreV1IndexInformer(client, core.Queue, cluster.ClusterName)
+					indexerListRes, informerListRes = r.CreateAllCoreV1IndexInformerWithController(client, core, cluster.ClusterName)
 				case resource.Events:
-					indexerListRes, informerListRes = r.CreateAllCoreV1IndexInformer(client, core.Queue, cluster.ClusterName)
+					indexerListRes, informerListRes = r.CreateAllCoreV1IndexInformerWithController(client, core, cluster.ClusterName)
 				}
 
 				for k, v := range indexerListRes {
 					if v != nil || informerListRes[k] != nil {
-						store[r.RType] = append(store[r.RType], v)
+						clusterStore.Add(cluster.ClusterName, r.RType, v)
 						informers = append(informers, informerListRes[k])
+						core.Track(cluster.ClusterName, r.RType, v, informerListRes[k])
 					}
 
 				}
@@ -79,33 +162,34 @@ func NewMultiClusterInformer(maxReQueueTime int, clusters []controller.Cluster)
 
 				switch r.RType {
 				case resource.Deployments:
-					indexer, informer = r.CreateAppsV1IndexInformer(client, core.Queue, cluster.ClusterName)
+					indexer, informer = r.CreateAppsV1IndexInformerWithController(client, core, cluster.ClusterName)
 				case resource.Statefulsets:
-					indexer, informer = r.CreateAppsV1IndexInformer(client, core.Queue, cluster.ClusterName)
+					indexer, informer = r.CreateAppsV1IndexInformerWithController(client, core, cluster.ClusterName)
 				case resource.Daemonsets:
-					indexer, informer = r.CreateAppsV1IndexInformer(client, core.Queue, cluster.ClusterName)
+					indexer, informer = r.CreateAppsV1IndexInformerWithController(client, core, cluster.ClusterName)
 				case resource.Pods:
-					indexer, informer = r.CreateCoreV1IndexInformer(client, core.Queue, cluster.ClusterName)
+					indexer, informer = r.CreateCoreV1IndexInformerWithController(client, core, cluster.ClusterName)
 				case resource.ConfigMaps:
-					indexer, informer = r.CreateCoreV1IndexInformer(client, core.Queue, cluster.ClusterName)
+					indexer, informer = r.CreateCoreV1IndexInformerWithController(client, core, cluster.ClusterName)
 				case resource.Secrets:
-					indexer, informer = r.CreateCoreV1IndexInformer(client, core.Queue, cluster.ClusterName)
+					indexer, informer = r.CreateCoreV1IndexInformerWithController(client, core, cluster.ClusterName)
 				case resource.Services:
-					indexer, informer = r.CreateCoreV1IndexInformer(client, core.Queue, cluster.ClusterName)
+					indexer, informer = r.CreateCoreV1IndexInformerWithController(client, core, cluster.ClusterName)
 				case resource.Events:
-					indexer, informer = r.CreateCoreV1IndexInformer(client, core.Queue, cluster.ClusterName)
+					indexer, informer = r.CreateCoreV1IndexInformerWithController(client, core, cluster.ClusterName)
 				}
 
 				// 放入 list中
-				store[r.RType] = append(store[r.RType], indexer)
+				clusterStore.Add(cluster.ClusterName, r.RType, indexer)
 				informers = append(informers, informer)
+				core.Track(cluster.ClusterName, r.RType, indexer, informer)
 			}
 
 		}
 	}
 
 	core.Informers = informers
-	core.Store = store
+	core.Store = clusterStore
 
 	return core, nil
 }
@@ -122,6 +206,10 @@ func process(obj queue.QueueObject) error {
 }
 
 func main() {
+	// 在创建队列之前注册，workqueue 的指标才会生效
+	if err := metrics.Register(metrics.Registry); err != nil {
+		klog.Fatal("register metrics error: ", err)
+	}
 	r, err := NewMultiClusterInformerFromConfig("./config.yaml")
 	if err != nil {
 		klog.Fatal("multi cluster informer err: ", err)
@@ -147,15 +235,148 @@ func main() {
 		return nil
 	})
 
+	// or use the built-in sinks: every enabled sink receives every object, errors are joined and retried
+	sinks := &sink.Fanout{}
+	// webhook: POST objects to the configured urls
+	if config.SysConfig.Webhook.Enabled {
+		webhook, err := sink.NewWebhook(config.SysConfig.Webhook)
+		if err != nil {
+			klog.Fatal("webhook config error: ", err)
+		}
+		sinks.Add("webhook", webhook, config.SysConfig.Webhook.Batch)
+	}
+
+	// kafka: produce objects to the configured topic, keyed by cluster/key
+	if config.SysConfig.Kafka.Enabled {
+		kafka, err := sink.NewKafka(config.SysConfig.Kafka)
+		if err != nil {
+			klog.Fatal("kafka config error: ", err)
+		}
+		defer kafka.Close()
+		sinks.Add("kafka", kafka, config.SysConfig.Kafka.Batch)
+	}
+
+	// nats: publish objects to k8s.<cluster>.<resource>.<event>
+	if config.SysConfig.NATS.Enabled {
+		nats, err := sink.NewNATS(config.SysConfig.NATS)
+		if err != nil {
+			klog.Fatal("nats config error: ", err)
+		}
+		defer nats.Close()
+		sinks.Add("nats", nats, config.SysConfig.NATS.Batch)
+	}
+
+	// audit: append objects to a rotating jsonl file
+	if config.SysConfig.Audit.Enabled {
+		audit, err := sink.NewFile(config.SysConfig.Audit)
+		if err != nil {
+			klog.Fatal("audit config error: ", err)
+		}
+		defer audit.Close()
+		sinks.Add("audit", audit, config.SysConfig.Audit.Batch)
+	}
+
+	// sql: materialize the cache into sqlite / postgres
+	if config.SysConfig.SQL.Enabled {
+		db, err := sink.NewSQL(config.SysConfig.SQL)
+		if err != nil {
+			klog.Fatal("sql config error: ", err)
+		}
+		defer db.Close()
+		sinks.Add("sql", db, config.SysConfig.SQL.Batch)
+
+		// full sync once all informers have synced
+		go func() {
+			for r.Ready() != nil {
+				time.Sleep(time.Second)
+			}
+			if err := db.Sync(context.Background(), r.ClusterStore()); err != nil {
+				klog.Error("sql sync error: ", err)
+			}
+		}()
+	}
+
+	if sinks.Len() > 0 {
+		r.AddEventHandler(sinks.Handle)
+		r.AddBatchEventHandler(sinks.HandleBatch)
+	}
+
+	// optional alerting rules evaluated on the event stream, see alert/example
+	if config.SysConfig.Alert.Enabled {
+		engine, err := alert.New(config.SysConfig.Alert)
+		if err != nil {
+			klog.Fatal("alert config error: ", err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go engine.Run(ctx, r)
+	}
+
+	// optional cross-cluster drift detection, the report is served on the http server at /drift
+	var detector *drift.Detector
+	if config.SysConfig.Drift.Enabled {
+		if r.ClusterStore() == nil {
+			klog.Fatal("drift detection needs a cluster aware store")
+		}
+		var err error
+		if detector, err = drift.NewDetector(config.SysConfig.Drift, r.ClusterStore()); err != nil {
+			klog.Fatal("drift config error: ", err)
+		}
+		detector.AddEventHandler(drift.LogHandler)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() {
+			for r.Ready() != nil {
+				time.Sleep(time.Second)
+			}
+			detector.Run(ctx)
+		}()
+	}
+
 	// 3. run informer
 	go r.Run()
 	defer r.Stop()
 
+	// optional http server: /metrics /healthz /readyz /debug/clusters /clusters /resources /events
+	if config.SysConfig.Server.Enabled {
+		s := server.NewServer(config.SysConfig.Server, r)
+		if detector != nil {
+			s.Handle("GET /drift", detector)
+		}
+		go s.Run()
+		defer s.Stop()
+	}
+
+	// optional grpc server: List / Watch
+	if config.SysConfig.GRPC.Enabled {
+		s := api.NewServer(config.SysConfig.GRPC, r)
+		go s.Run()
+		defer s.Stop()
+	}
+
 	// 4. Continuously remove resource objects from the queue
+	// method three：batch, when a sink sets batch.maxItems
+	if maxItems, maxWait, ok := sinks.Batch(); ok {
+		for {
+			objs, err := r.PopBatch(context.Background(), maxItems, maxWait)
+			if err != nil {
+				klog.Error("pop batch error: ", err)
+				return
+			}
+			if err = r.HandleBatch(objs); err != nil {
+				_ = r.ReQueueBatch(objs, err) // only the failed objects are requeued
+			} else {
+				r.FinishBatch(objs)
+			}
+		}
+	}
+
 	for {
 		obj, _ := r.Pop()
 		if err = r.HandleObject(obj); err != nil {
-			_ = r.ReQueue(obj) // reQueue
+			// reQueue, after maxRequeueTime it goes to the dead letter queue, see r.DeadLetters() / r.Replay(id)
+			// the handler can also return queue.RequeueAfter(30*time.Second) or queue.Permanent(err)
+			_ = r.ReQueueWithError(obj, err)
 		} else {
 			// t's done
 			r.Finish(obj)
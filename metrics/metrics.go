@@ -0,0 +1,308 @@
+package metrics
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"k8s.io/client-go/util/workqueue"
+)
+
+const namespace = "multiple_k8s_informer"
+
+// Registry 默认的注册表，Register 之后通过 Handler 暴露
+var Registry = prometheus.NewRegistry()
+
+var (
+	// informer 收到的事件
+	events = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "informer_events_total",
+		Help:      "Number of events received from informers.",
+	}, []string{"cluster", "resource", "event"})
+
+	lastEvent = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "informer_last_event_timestamp_seconds",
+		Help:      "Unix time of the last event received from informers.",
+	}, []string{"cluster", "resource"})
+
+	dropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "informer_events_dropped_total",
+		Help:      "Number of events dropped before being pushed to the queue.",
+	}, []string{"cluster", "resource", "reason"})
+
+	// list/watch 请求，watch 次数即 watch 重连次数
+	lists = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "informer_list_total",
+		Help:      "Number of list requests made by informers.",
+	}, []string{"cluster", "resource", "result"})
+
+	watches = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "informer_watch_total",
+		Help:      "Number of watch requests (restarts) made by informers.",
+	}, []string{"cluster", "resource", "result"})
+
+	// handler 处理
+	handleDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "handle_duration_seconds",
+		Help:      "How long the handler takes to process an object.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 4, 10),
+	}, []string{"cluster", "resource", "event"})
+
+	handleErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "handle_errors_total",
+		Help:      "Number of objects the handler failed to process.",
+	}, []string{"cluster", "resource", "event"})
+
+	// 队列
+	retries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "queue_requeue_total",
+		Help:      "Number of objects put back to the queue.",
+	}, []string{"cluster", "resource"})
+
+	deadLetters = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "queue_dead_letter_total",
+		Help:      "Number of objects moved to the dead letter queue.",
+	}, []string{"cluster", "resource"})
+
+	walErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "queue_wal_errors_total",
+		Help:      "Number of persistent queue wal failures, by op write / compact.",
+	}, []string{"op"})
+
+	// 告警
+	alerts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "alerts_total",
+		Help:      "Number of alert notifications sent.",
+	}, []string{"rule", "severity", "status"})
+
+	// 跨集群漂移
+	driftObjects = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "drift_objects",
+		Help:      "Number of objects that differ across clusters in the last comparison.",
+	}, []string{"resource"})
+
+	driftEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "drift_events_total",
+		Help:      "Number of drift events, by type detected / changed / resolved.",
+	}, []string{"resource", "type"})
+)
+
+// Register 将所有指标注册到 registry，并设置 client-go workqueue 的指标 provider
+// 需要在创建队列之前调用；provider 全局只生效一次，之后再调用只注册指标
+func Register(registry prometheus.Registerer) error {
+	cs := []prometheus.Collector{
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		events, lastEvent, dropped, lists, watches,
+		handleDuration, handleErrors,
+		retries, deadLetters, walErrors,
+		alerts,
+		driftObjects, driftEvents,
+		queueLength,
+	}
+	cs = append(cs, provider.collectors()...)
+	for _, c := range cs {
+		if err := registry.Register(c); err != nil {
+			return err
+		}
+	}
+	workqueue.SetProvider(provider)
+	return nil
+}
+
+// Handler /metrics
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// ObserveEvent informer 收到事件
+func ObserveEvent(cluster, resource, event string) {
+	events.WithLabelValues(cluster, resource, event).Inc()
+	lastEvent.WithLabelValues(cluster, resource).SetToCurrentTime()
+}
+
+// ObserveDropped 事件在入队前被丢弃
+func ObserveDropped(cluster, resource, reason string) {
+	dropped.WithLabelValues(cluster, resource, reason).Inc()
+}
+
+// ObserveList informer 发起 list
+func ObserveList(cluster, resource string, err error) {
+	lists.WithLabelValues(cluster, resource, result(err)).Inc()
+}
+
+// ObserveWatch informer 发起 watch
+func ObserveWatch(cluster, resource string, err error) {
+	watches.WithLabelValues(cluster, resource, result(err)).Inc()
+}
+
+// ObserveHandle handler 处理一个对象
+func ObserveHandle(cluster, resource, event string, duration time.Duration, err error) {
+	handleDuration.WithLabelValues(cluster, resource, event).Observe(duration.Seconds())
+	if err != nil {
+		handleErrors.WithLabelValues(cluster, resource, event).Inc()
+	}
+}
+
+// ObserveReQueue 对象重新入列
+func ObserveReQueue(cluster, resource string) {
+	retries.WithLabelValues(cluster, resource).Inc()
+}
+
+// ObserveDeadLetter 对象放入死信队列
+func ObserveDeadLetter(cluster, resource string) {
+	deadLetters.WithLabelValues(cluster, resource).Inc()
+}
+
+// ObserveWalError 持久化队列写入或压缩 wal 失败
+func ObserveWalError(op string) {
+	walErrors.WithLabelValues(op).Inc()
+}
+
+// ObserveAlert 发送告警通知
+func ObserveAlert(rule, severity, status string) {
+	alerts.WithLabelValues(rule, severity, status).Inc()
+}
+
+// SetDriftObjects 最近一次比较中存在漂移的对象数量
+func SetDriftObjects(resource string, n int) {
+	driftObjects.WithLabelValues(resource).Set(float64(n))
+}
+
+// ObserveDrift 漂移事件
+func ObserveDrift(resource, eventType string) {
+	driftEvents.WithLabelValues(resource, eventType).Inc()
+}
+
+// RegisterQueueDepth 注册队列长度，自定义出队顺序的队列没有 workqueue 的 depth 指标
+// 按 name 区分队列，同名的队列以最后一次注册为准
+func RegisterQueueDepth(name string, depth func() int) {
+	queueLength.mu.Lock()
+	queueLength.depths[name] = depth
+	queueLength.mu.Unlock()
+}
+
+// queueLength 实现 prometheus.Collector，采集时读取各个队列的长度
+var queueLength = &queueLengths{
+	desc:   prometheus.NewDesc(namespace+"_queue_length", "Number of objects waiting in the queue.", []string{"name"}, nil),
+	depths: make(map[string]func() int),
+}
+
+type queueLengths struct {
+	desc *prometheus.Desc
+
+	mu     sync.RWMutex
+	depths map[string]func() int
+}
+
+func (c *queueLengths) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *queueLengths) Collect(ch chan<- prometheus.Metric) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for name, depth := range c.depths {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(depth()), name)
+	}
+}
+
+func result(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "success"
+}
+
+// provider workqueue 自带的指标，只对有名字的 workqueue 生效
+var provider = &workqueueProvider{
+	depth: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace, Subsystem: "workqueue", Name: "depth",
+		Help: "Current depth of workqueue.",
+	}, []string{"name"}),
+	adds: prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "workqueue", Name: "adds_total",
+		Help: "Total number of adds handled by workqueue.",
+	}, []string{"name"}),
+	latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace, Subsystem: "workqueue", Name: "queue_duration_seconds",
+		Help:    "How long in seconds an item stays in workqueue before being requested.",
+		Buckets: prometheus.ExponentialBuckets(10e-9, 10, 10),
+	}, []string{"name"}),
+	workDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace, Subsystem: "workqueue", Name: "work_duration_seconds",
+		Help:    "How long in seconds processing an item from workqueue takes.",
+		Buckets: prometheus.ExponentialBuckets(10e-9, 10, 10),
+	}, []string{"name"}),
+	unfinished: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace, Subsystem: "workqueue", Name: "unfinished_work_seconds",
+		Help: "How many seconds of work has been done that is in progress and hasn't been observed by work_duration.",
+	}, []string{"name"}),
+	longestRunning: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace, Subsystem: "workqueue", Name: "longest_running_processor_seconds",
+		Help: "How many seconds has the longest running processor for workqueue been running.",
+	}, []string{"name"}),
+	retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "workqueue", Name: "retries_total",
+		Help: "Total number of retries handled by workqueue.",
+	}, []string{"name"}),
+}
+
+// workqueueProvider 实现 workqueue.MetricsProvider
+type workqueueProvider struct {
+	depth          *prometheus.GaugeVec
+	adds           *prometheus.CounterVec
+	latency        *prometheus.HistogramVec
+	workDuration   *prometheus.HistogramVec
+	unfinished     *prometheus.GaugeVec
+	longestRunning *prometheus.GaugeVec
+	retries        *prometheus.CounterVec
+}
+
+func (p *workqueueProvider) collectors() []prometheus.Collector {
+	return []prometheus.Collector{p.depth, p.adds, p.latency, p.workDuration, p.unfinished, p.longestRunning, p.retries}
+}
+
+func (p *workqueueProvider) NewDepthMetric(name string) workqueue.GaugeMetric {
+	return p.depth.WithLabelValues(name)
+}
+
+func (p *workqueueProvider) NewAddsMetric(name string) workqueue.CounterMetric {
+	return p.adds.WithLabelValues(name)
+}
+
+func (p *workqueueProvider) NewLatencyMetric(name string) workqueue.HistogramMetric {
+	return p.latency.WithLabelValues(name)
+}
+
+func (p *workqueueProvider) NewWorkDurationMetric(name string) workqueue.HistogramMetric {
+	return p.workDuration.WithLabelValues(name)
+}
+
+func (p *workqueueProvider) NewUnfinishedWorkSecondsMetric(name string) workqueue.SettableGaugeMetric {
+	return p.unfinished.WithLabelValues(name)
+}
+
+func (p *workqueueProvider) NewLongestRunningProcessorSecondsMetric(name string) workqueue.SettableGaugeMetric {
+	return p.longestRunning.WithLabelValues(name)
+}
+
+func (p *workqueueProvider) NewRetriesMetric(name string) workqueue.CounterMetric {
+	return p.retries.WithLabelValues(name)
+}
@@ -0,0 +1,111 @@
+package metrics
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// value 找到名字与标签都匹配的指标，counter/gauge 返回值，histogram 返回样本数
+func value(t *testing.T, registry *prometheus.Registry, name string, labels map[string]string) (float64, bool) {
+	t.Helper()
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			if !hasLabels(m, labels) {
+				continue
+			}
+			switch {
+			case m.Counter != nil:
+				return m.Counter.GetValue(), true
+			case m.Gauge != nil:
+				return m.Gauge.GetValue(), true
+			case m.Histogram != nil:
+				return float64(m.Histogram.GetSampleCount()), true
+			}
+		}
+	}
+	return 0, false
+}
+
+func hasLabels(m *dto.Metric, labels map[string]string) bool {
+	matched := 0
+	for _, pair := range m.GetLabel() {
+		if v, ok := labels[pair.GetName()]; ok && v == pair.GetValue() {
+			matched++
+		}
+	}
+	return matched == len(labels)
+}
+
+func TestRegister(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	if err := Register(registry); err != nil {
+		t.Fatal(err)
+	}
+	// 同一个注册表不能重复注册
+	if err := Register(registry); err == nil {
+		t.Fatal("second Register on the same registry returned nil")
+	}
+
+	ObserveEvent("c1", "pods", "add")
+	ObserveEvent("c1", "pods", "add")
+	ObserveDropped("c1", "pods", "filter_error")
+	ObserveList("c2", "pods", errors.New("connection refused"))
+	ObserveHandle("c1", "pods", "add", 0, errors.New("failed"))
+	ObserveWalError("write")
+
+	tests := []struct {
+		name   string
+		labels map[string]string
+		want   float64
+	}{
+		{"multiple_k8s_informer_informer_events_total", map[string]string{"cluster": "c1", "resource": "pods", "event": "add"}, 2},
+		{"multiple_k8s_informer_informer_events_dropped_total", map[string]string{"cluster": "c1", "resource": "pods", "reason": "filter_error"}, 1},
+		{"multiple_k8s_informer_informer_list_total", map[string]string{"cluster": "c2", "resource": "pods", "result": "error"}, 1},
+		{"multiple_k8s_informer_handle_duration_seconds", map[string]string{"cluster": "c1", "resource": "pods", "event": "add"}, 1},
+		{"multiple_k8s_informer_handle_errors_total", map[string]string{"cluster": "c1", "resource": "pods", "event": "add"}, 1},
+		{"multiple_k8s_informer_queue_wal_errors_total", map[string]string{"op": "write"}, 1},
+	}
+	for _, tt := range tests {
+		if got, ok := value(t, registry, tt.name, tt.labels); !ok || got != tt.want {
+			t.Errorf("%s%v = %v (found %v), want %v", tt.name, tt.labels, got, ok, tt.want)
+		}
+	}
+
+	// workqueue 的指标按队列名区分
+	q := workqueue.NewWithConfig(workqueue.QueueConfig{Name: "metrics_test"})
+	defer q.ShutDown()
+	q.Add("a")
+	q.Add("b")
+	if got, ok := value(t, registry, "multiple_k8s_informer_workqueue_adds_total", map[string]string{"name": "metrics_test"}); !ok || got != 2 {
+		t.Errorf("workqueue adds = %v (found %v), want 2", got, ok)
+	}
+}
+
+// 每个队列各自一条 queue_length，同名的队列以最后一次注册为准
+func TestRegisterQueueDepth(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(queueLength); err != nil {
+		t.Fatal(err)
+	}
+
+	RegisterQueueDepth("a", func() int { return 1 })
+	RegisterQueueDepth("b", func() int { return 2 })
+	RegisterQueueDepth("a", func() int { return 3 })
+
+	for name, want := range map[string]float64{"a": 3, "b": 2} {
+		if got, ok := value(t, registry, "multiple_k8s_informer_queue_length", map[string]string{"name": name}); !ok || got != want {
+			t.Errorf("queue_length{name=%q} = %v (found %v), want %v", name, got, ok, want)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// BatchError 批量处理部分失败，Errors 与对象一一对应，nil 表示该对象处理成功
+type BatchError struct {
+	Errors []error
+}
+
+func (e *BatchError) Error() string {
+	failed := 0
+	for _, err := range e.Errors {
+		if err != nil {
+			failed++
+		}
+	}
+	return fmt.Sprintf("%d of %d objects failed", failed, len(e.Errors))
+}
+
+type popResult struct {
+	obj QueueObject
+	err error
+}
+
+// batcher 批量出队，每个队列一个
+// 只有一个常驻的 goroutine 调用 Pop，超时或取消时已经拿到的对象留给下一次 PopBatch，
+// 不会放回队列打乱顺序，也不会影响限速器与重新入列次数
+type batcher struct {
+	once    sync.Once
+	results chan popResult
+	err     error // 队列关闭后 Pop 返回的错误，results 关闭前设置
+}
+
+func (b *batcher) start(q Queue) {
+	b.once.Do(func() {
+		b.results = make(chan popResult)
+		go func() {
+			for {
+				obj, err := q.Pop()
+				if err != nil {
+					b.err = err
+					close(b.results)
+					return
+				}
+				b.results <- popResult{obj: obj}
+			}
+		}()
+	})
+}
+
+// popBatch 批量出队
+// 阻塞直到拿到第一个对象，之后最多再等待 maxWait，凑够 maxItems 个对象立即返回
+func (b *batcher) popBatch(ctx context.Context, q Queue, maxItems int, maxWait time.Duration) ([]QueueObject, error) {
+	if maxItems <= 0 {
+		maxItems = 1
+	}
+	b.start(q)
+
+	var batch []QueueObject
+	select {
+	case r, ok := <-b.results:
+		if !ok {
+			return nil, b.err
+		}
+		batch = append(batch, r.obj)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	timer := time.NewTimer(maxWait)
+	defer timer.Stop()
+	for len(batch) < maxItems {
+		select {
+		case r, ok := <-b.results:
+			if !ok {
+				return batch, nil
+			}
+			batch = append(batch, r.obj)
+		case <-timer.C:
+			return batch, nil
+		case <-ctx.Done():
+			return batch, nil
+		}
+	}
+	return batch, nil
+}
+
+func finishBatch(q Queue, objs []QueueObject) {
+	for _, obj := range objs {
+		q.Finish(obj)
+	}
+}
+
+// reQueueBatch 批量重新入列
+// handleErr 为 BatchError 时，成功的对象 Finish，只有失败的对象重新入列；否则全部重新入列
+// 返回超过次数或不再重试、被放入死信队列的对象的错误
+func reQueueBatch(q Queue, objs []QueueObject, handleErr error) error {
+	var batchErr *BatchError
+	if !errors.As(handleErr, &batchErr) {
+		batchErr = &BatchError{Errors: make([]error, len(objs))}
+		for i := range objs {
+			batchErr.Errors[i] = handleErr
+		}
+	}
+
+	var errs []error
+	for i, obj := range objs {
+		var err error
+		if i < len(batchErr.Errors) {
+			err = batchErr.Errors[i]
+		}
+		if err == nil {
+			q.Finish(obj)
+			continue
+		}
+		if err = ReQueueWithError(q, obj, err); err != nil {
+			errs = append(errs, fmt.Errorf("%s/%s/%s: %w", obj.ClusterName, obj.ResourceType, obj.Key, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,95 @@
+package queue
+
+import (
+	"context"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func keys(objs []QueueObject) (keys []string) {
+	for _, obj := range objs {
+		keys = append(keys, obj.Key)
+	}
+	return
+}
+
+func TestPopBatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		push     []string
+		maxItems int
+		want     [][]string // 每次 PopBatch 的结果
+	}{
+		{"full batch", []string{"a", "b", "c"}, 2, [][]string{{"a", "b"}, {"c"}}},
+		{"timeout", []string{"a"}, 3, [][]string{{"a"}}},
+		{"zero max items", []string{"a", "b"}, 0, [][]string{{"a"}, {"b"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := NewQueue(3)
+			defer q.Close()
+			for _, key := range tt.push {
+				q.Push(QueueObject{Key: key})
+			}
+			for i, want := range tt.want {
+				got, err := q.PopBatch(context.Background(), tt.maxItems, 20*time.Millisecond)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got, want := strings.Join(keys(got), ","), strings.Join(want, ","); got != want {
+					t.Fatalf("batch %d = %s, want %s", i, got, want)
+				}
+				q.FinishBatch(got)
+			}
+		})
+	}
+}
+
+// 超时或取消后已经拿到的对象留给下一次 PopBatch，不会重新入列，也不会留下阻塞在 Pop 中的 goroutine
+func TestPopBatchNoSteal(t *testing.T) {
+	q := NewQueue(3)
+	defer q.Close()
+
+	before := runtime.NumGoroutine()
+	for i := 0; i < 10; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		if _, err := q.PopBatch(ctx, 10, time.Millisecond); err == nil {
+			t.Fatal("PopBatch on an empty queue returned without error")
+		}
+		cancel()
+	}
+	// 只有一个常驻的 goroutine
+	if n := runtime.NumGoroutine() - before; n > 1 {
+		t.Fatalf("%d goroutines left after cancelled batches", n)
+	}
+
+	q.Push(QueueObject{Key: "a"})
+	q.Push(QueueObject{Key: "b"})
+	got, err := q.PopBatch(context.Background(), 1, 0)
+	if err != nil || len(got) != 1 || got[0].Key != "a" {
+		t.Fatalf("first batch = %v, %v", keys(got), err)
+	}
+	q.FinishBatch(got)
+
+	// b 已经被常驻 goroutine 拿到，应原样出现在下一批中
+	got, err = q.PopBatch(context.Background(), 2, 10*time.Millisecond)
+	if err != nil || len(got) != 1 || got[0].Key != "b" || got[0].Attempts != 0 {
+		t.Fatalf("second batch = %v, %v", got, err)
+	}
+	q.FinishBatch(got)
+	if n := q.Len(); n != 0 {
+		t.Fatalf("queue length = %d, want 0", n)
+	}
+}
+
+func TestPopBatchClosed(t *testing.T) {
+	q := NewQueue(3)
+	q.Close()
+	for i := 0; i < 2; i++ {
+		if _, err := q.PopBatch(context.Background(), 2, time.Millisecond); err == nil {
+			t.Fatal("PopBatch on a closed queue returned without error")
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"multiple-k8s-informer/diff"
+	"multiple-k8s-informer/resource"
+)
+
+// Coalesced 合并模式下，同一个对象在被处理前收到的所有事件
+type Coalesced struct {
+	Events []string  // 被合并的事件类型，按第一次到达的顺序去重
+	Count  int       // 被合并的事件总数
+	Since  time.Time // 第一个被合并事件的创建时间
+}
+
+// CoalescingQueue 合并模式的队列
+// 以 <cluster>/<resource>/<namespace>/<name> 作为 workqueue 中的对象，同一对象未被处理前的多次事件
+// 只保留最后一次，适用于只关心对象最新状态的 level-triggered 处理逻辑
+// 合并后的事件：add+update 为 add，update+delete 为 delete，delete+add 为 update，add+delete 直接丢弃
+type CoalescingQueue struct {
+	*Wq
+
+	lock    sync.Mutex
+	pending map[string]QueueObject // 等待处理的最新对象
+
+	onDrop func(QueueObject) // 合并后丢弃对象时调用，持久化队列用来完成 wal 中的记录
+
+	batcher batcher
+}
+
+var _ Queue = &CoalescingQueue{}
+
+// NewCoalescingQueue 在 Wq 之上开启合并模式，传入的 Wq 不能再单独使用
+func NewCoalescingQueue(wq *Wq) *CoalescingQueue {
+	return &CoalescingQueue{
+		Wq:      wq,
+		pending: make(map[string]QueueObject),
+	}
+}
+
+// CoalesceKey 合并的依据 <cluster>/<resource>/<namespace>/<name>
+func CoalesceKey(obj QueueObject) string {
+	return obj.ClusterName + "/" + obj.ResourceType + "/" + obj.Key
+}
+
+// Push 若同一对象已在等待处理，则与新事件合并
+func (q *CoalescingQueue) Push(obj QueueObject) {
+	key := CoalesceKey(obj)
+
+	q.lock.Lock()
+	if older, ok := q.pending[key]; ok {
+		if !q.mergePending(key, older, obj) {
+			// workqueue 中的 key 出队时没有对象，会被跳过
+			return
+		}
+	} else {
+		obj.Coalesced = &Coalesced{Events: []string{obj.Event}, Count: 1, Since: obj.CreateAt}
+		q.pending[key] = obj
+		q.lock.Unlock()
+	}
+
+	q.Add(key)
+}
+
+// mergePending 合并等待处理的对象，对象被丢弃时返回 false，调用时需持有锁，返回前释放
+func (q *CoalescingQueue) mergePending(key string, older, newer QueueObject) bool {
+	merged, ok := merge(older, newer)
+	if ok {
+		q.pending[key] = merged
+		q.lock.Unlock()
+		return true
+	}
+
+	delete(q.pending, key)
+	q.lock.Unlock()
+	if q.onDrop != nil {
+		q.onDrop(merged)
+	}
+	return false
+}
+
+func (q *CoalescingQueue) Pop() (QueueObject, error) {
+	for {
+		item, shutdown := q.Get()
+		if shutdown {
+			return QueueObject{}, errors.New("Controller has been stoped. ")
+		}
+		key := item.(string)
+
+		q.lock.Lock()
+		obj, ok := q.pending[key]
+		delete(q.pending, key)
+		q.lock.Unlock()
+
+		if ok {
+			obj.Attempts = q.attempts(key)
+			return obj, nil
+		}
+		// 限速重新入列的key已被新事件处理过，或对象已被丢弃，跳过
+		q.forgetHistory(key)
+		q.Forget(key)
+		q.Done(key)
+	}
+}
+
+func (q *CoalescingQueue) ReQueue(obj QueueObject) error {
+	return q.ReQueueWithError(obj, nil)
+}
+
+func (q *CoalescingQueue) ReQueueWithError(obj QueueObject, handleErr error) error {
+	key := CoalesceKey(obj)
+	return q.retry(key, obj, handleErr, func() {
+		// 处理期间若有新事件，以新事件为准
+		q.lock.Lock()
+		if newer, ok := q.pending[key]; ok {
+			q.mergePending(key, obj, newer)
+			return
+		}
+		q.pending[key] = obj
+		q.lock.Unlock()
+	})
+}
+
+func (q *CoalescingQueue) restoreAttempts(obj QueueObject, attempts int) {
+	q.restoreHistory(CoalesceKey(obj), attempts)
+}
+
+func (q *CoalescingQueue) Finish(obj QueueObject) {
+	key := CoalesceKey(obj)
+
+	q.forgetHistory(key)
+	q.Forget(key)
+	q.Done(key)
+}
+
+func (q *CoalescingQueue) PopBatch(ctx context.Context, maxItems int, maxWait time.Duration) ([]QueueObject, error) {
+	return q.batcher.popBatch(ctx, q, maxItems, maxWait)
+}
+
+func (q *CoalescingQueue) FinishBatch(objs []QueueObject) {
+	finishBatch(q, objs)
+}
+
+func (q *CoalescingQueue) ReQueueBatch(objs []QueueObject, handleErr error) error {
+	return reQueueBatch(q, objs, handleErr)
+}
+
+// Replay 从死信队列中取出对象，重新放入队列
+func (q *CoalescingQueue) Replay(id string) error {
+	obj, err := q.takeDeadLetter(id)
+	if err != nil {
+		return err
+	}
+	q.Push(obj)
+	return nil
+}
+
+// merge 用 newer 覆盖 older，并累计被合并的事件，对象在被处理前创建又删除时返回 false
+func merge(older, newer QueueObject) (QueueObject, bool) {
+	coalesced := &Coalesced{Since: older.CreateAt}
+	for _, obj := range []QueueObject{older, newer} {
+		if obj.Coalesced == nil {
+			coalesced.Count++
+			coalesced.add(obj.Event)
+			continue
+		}
+		coalesced.Count += obj.Coalesced.Count
+		for _, event := range obj.Coalesced.Events {
+			coalesced.add(event)
+		}
+	}
+	if older.Coalesced != nil && !older.Coalesced.Since.IsZero() {
+		coalesced.Since = older.Coalesced.Since
+	}
+
+	event, ok := mergeEvent(older.Event, newer.Event)
+	if event == resource.EventUpdate && older.Event == resource.EventUpdate {
+		newer.Diff = diff.MergePatches(older.Diff, newer.Diff)
+	} else {
+		// 合并后不是 update，或旧对象已被删除，没有可用的 diff
+		newer.Diff = ""
+	}
+	newer.Event = event
+	newer.Coalesced = coalesced
+	return newer, ok
+}
+
+// mergeEvent 合并后的事件类型
+// 处理者还没见过 add 的对象，之后的 update 仍是 add，delete 则不需要处理；删除后重新创建的对象为 update
+func mergeEvent(older, newer string) (string, bool) {
+	switch {
+	case older == resource.EventAdd && newer == resource.EventDelete:
+		return newer, false
+	case older == resource.EventAdd:
+		return resource.EventAdd, true
+	case older == resource.EventDelete && newer != resource.EventDelete:
+		return resource.EventUpdate, true
+	}
+	return newer, true
+}
+
+func (c *Coalesced) add(event string) {
+	for _, e := range c.Events {
+		if e == event {
+			return
+		}
+	}
+	c.Events = append(c.Events, event)
+}
@@ -0,0 +1,148 @@
+package queue
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"multiple-k8s-informer/resource"
+)
+
+func coalescingEvent(event, key string, at time.Time) QueueObject {
+	return QueueObject{ClusterName: "c1", ResourceType: resource.Pods, Event: event, Key: key, CreateAt: at}
+}
+
+func TestCoalescingPush(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []string
+		want   string // 合并后的事件，空表示丢弃
+		count  int
+		merged string // 被合并的事件类型
+	}{
+		{"single", []string{"add"}, "add", 1, "add"},
+		{"add update", []string{"add", "update", "update"}, "add", 3, "add,update"},
+		{"add delete", []string{"add", "update", "delete"}, "", 0, ""},
+		{"update update", []string{"update", "update"}, "update", 2, "update"},
+		{"update delete", []string{"update", "delete"}, "delete", 2, "update,delete"},
+		{"delete add", []string{"delete", "add"}, "update", 2, "delete,add"},
+		{"delete add update", []string{"delete", "add", "update"}, "update", 3, "delete,add,update"},
+		{"add delete add", []string{"add", "delete", "add"}, "add", 1, "add"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := NewCoalescingQueue(NewQueue(3))
+			defer q.Close()
+
+			start := time.Now()
+			for i, event := range tt.events {
+				q.Push(coalescingEvent(event, "default/web", start.Add(time.Duration(i)*time.Second)))
+			}
+			q.Push(coalescingEvent(resource.EventAdd, "default/other", start))
+
+			obj, err := q.Pop()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if obj.Key == "default/other" {
+				if tt.want != "" {
+					t.Fatalf("default/web was dropped, want %s", tt.want)
+				}
+				return
+			}
+			if obj.Event != tt.want || obj.Coalesced.Count != tt.count {
+				t.Fatalf("got %s with count %d, want %s with count %d", obj.Event, obj.Coalesced.Count, tt.want, tt.count)
+			}
+			if got := strings.Join(obj.Coalesced.Events, ","); got != tt.merged {
+				t.Fatalf("coalesced events = %s, want %s", got, tt.merged)
+			}
+			if !obj.CreateAt.Equal(start.Add(time.Duration(len(tt.events)-1) * time.Second)) {
+				t.Fatal("coalesced object is not the latest one")
+			}
+			q.Finish(obj)
+			if obj, _ := q.Pop(); obj.Key != "default/other" {
+				t.Fatalf("got %s, want only one item for default/web", obj.Key)
+			}
+		})
+	}
+}
+
+// 重复的 key 只占一个位置，处理期间收到的事件在处理完成后出队
+func TestCoalescingRepeatedKeys(t *testing.T) {
+	q := NewCoalescingQueue(NewQueue(3))
+	defer q.Close()
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		q.Push(coalescingEvent(resource.EventUpdate, "default/web", start.Add(time.Duration(i))))
+	}
+	if n := q.Len(); n != 1 {
+		t.Fatalf("queue length = %d, want 1", n)
+	}
+
+	obj, _ := q.Pop()
+	q.Push(coalescingEvent(resource.EventUpdate, "default/web", start.Add(time.Second)))
+	q.Push(coalescingEvent(resource.EventDelete, "default/web", start.Add(2*time.Second)))
+	if n := q.Len(); n != 0 {
+		t.Fatalf("queue length = %d while the key is processing, want 0", n)
+	}
+	q.Finish(obj)
+
+	obj, _ = q.Pop()
+	if obj.Event != resource.EventDelete || obj.Coalesced.Count != 2 {
+		t.Fatalf("got %s with count %d, want delete with count 2", obj.Event, obj.Coalesced.Count)
+	}
+	q.Finish(obj)
+}
+
+// 失败重新入列时与处理期间收到的新事件合并，以新事件为准
+func TestCoalescingReQueue(t *testing.T) {
+	q := NewCoalescingQueue(NewQueue(3))
+	defer q.Close()
+
+	start := time.Now()
+	q.Push(coalescingEvent(resource.EventUpdate, "default/web", start))
+	obj, _ := q.Pop()
+	q.Push(coalescingEvent(resource.EventUpdate, "default/web", start.Add(time.Second)))
+	if err := q.ReQueueWithError(obj, errors.New("failed")); err != nil {
+		t.Fatal(err)
+	}
+
+	obj, _ = q.Pop()
+	if !obj.CreateAt.Equal(start.Add(time.Second)) || obj.Coalesced.Count != 2 || obj.Attempts != 1 {
+		t.Fatalf("got %+v, want the newer update with count 2 and 1 attempt", obj)
+	}
+	q.Finish(obj)
+}
+
+// 创建又删除的对象被丢弃后，wal 中的记录也完成，重启后不会重放
+func TestCoalescingDropPersistent(t *testing.T) {
+	dir := t.TempDir()
+	q, err := NewPersistentQueue(NewCoalescingQueue(NewQueue(3)), PersistenceConfig{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	q.Push(coalescingEvent(resource.EventUpdate, "default/web", start))
+	processing, _ := q.Pop()
+	q.Push(coalescingEvent(resource.EventDelete, "default/web", start.Add(time.Second)))
+	q.Push(coalescingEvent(resource.EventAdd, "default/web", start.Add(2*time.Second)))
+	q.Push(coalescingEvent(resource.EventAdd, "default/api", start.Add(3*time.Second)))
+	q.Push(coalescingEvent(resource.EventDelete, "default/api", start.Add(4*time.Second)))
+	q.Close()
+
+	live, _, err := q.wal.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 处理中的 update 与之后的 delete、add 都还没有完成
+	if len(live) != 3 {
+		t.Fatalf("live wal records = %d, want 3", len(live))
+	}
+	for _, record := range live {
+		if record.Object.Key != processing.Key {
+			t.Fatalf("dropped object %s is still in the wal", record.Object.Key)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package queue
+
+import (
+	"sync"
+	"time"
+)
+
+// DeadLetterItem 死信对象
+// 超过最大重新入列次数后仍然处理失败的资源对象，记录所有handler错误与每次尝试的时间
+type DeadLetterItem struct {
+	ID       string      `json:"id"`
+	Object   QueueObject `json:"object"`
+	Errors   []string    `json:"errors"`   // 每次处理失败时handler返回的错误
+	Attempts []time.Time `json:"attempts"` // 每次重新入列的时间
+	DeadAt   time.Time   `json:"deadAt"`   // 放入死信队列的时间
+}
+
+// DeadLetter 死信队列接口，默认为内存环形缓冲区，可自行实现写文件、写数据库等
+type DeadLetter interface {
+	// Put 放入死信
+	Put(DeadLetterItem)
+	// List 列出所有死信，按放入时间排序
+	List() []DeadLetterItem
+	// Get 输入id，返回死信
+	Get(id string) (DeadLetterItem, bool)
+	// Remove 删除死信
+	Remove(id string) bool
+}
+
+// RingDeadLetter 内存环形缓冲区实现的死信队列，超过容量时丢弃最早的死信
+type RingDeadLetter struct {
+	mu    sync.RWMutex
+	items []DeadLetterItem
+	size  int
+}
+
+var _ DeadLetter = &RingDeadLetter{}
+
+func NewRingDeadLetter(size int) *RingDeadLetter {
+	if size <= 0 {
+		size = DefaultDeadLetterSize
+	}
+	return &RingDeadLetter{
+		items: make([]DeadLetterItem, 0, size),
+		size:  size,
+	}
+}
+
+func (r *RingDeadLetter) Put(item DeadLetterItem) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.items) >= r.size {
+		// 覆盖最早的死信
+		copy(r.items, r.items[1:])
+		r.items = r.items[:len(r.items)-1]
+	}
+	r.items = append(r.items, item)
+}
+
+func (r *RingDeadLetter) List() []DeadLetterItem {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	items := make([]DeadLetterItem, len(r.items))
+	copy(items, r.items)
+	return items
+}
+
+func (r *RingDeadLetter) Get(id string) (DeadLetterItem, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, item := range r.items {
+		if item.ID == id {
+			return item, true
+		}
+	}
+	return DeadLetterItem{}, false
+}
+
+func (r *RingDeadLetter) Remove(id string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, item := range r.items {
+		if item.ID == id {
+			r.items = append(r.items[:i], r.items[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,132 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/util/workqueue"
+)
+
+func newTestQueue(maxReQueueTime int) *Wq {
+	return NewQueueWithRateLimiter(maxReQueueTime, workqueue.NewItemExponentialFailureRateLimiter(time.Millisecond, 10*time.Millisecond))
+}
+
+// 超过 MaxReQueueTime 后放入死信队列，记录每次的错误与时间
+func TestDeadLetterAfterMaxReQueue(t *testing.T) {
+	q := newTestQueue(2)
+	defer q.Close()
+
+	start := time.Now()
+	q.Push(QueueObject{ClusterName: "c1", Key: "default/a"})
+	for i := 0; ; i++ {
+		obj, err := q.Pop()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = q.ReQueueWithError(obj, fmt.Errorf("failed %d", i))
+		if i < 2 {
+			if err != nil {
+				t.Fatalf("requeue %d = %v", i, err)
+			}
+			continue
+		}
+		if !errors.Is(err, ErrMaxReQueue) {
+			t.Fatalf("requeue %d = %v, want ErrMaxReQueue", i, err)
+		}
+		break
+	}
+
+	items := q.DeadLetters().List()
+	if len(items) != 1 {
+		t.Fatalf("dead letters = %d, want 1", len(items))
+	}
+	item := items[0]
+	if item.Object.Key != "default/a" || item.ID == "" {
+		t.Fatalf("dead letter = %+v", item)
+	}
+	if got := strings.Join(item.Errors, ","); got != "failed 0,failed 1,failed 2" {
+		t.Fatalf("errors = %s", got)
+	}
+	if len(item.Attempts) != 3 {
+		t.Fatalf("attempts = %v, want 3", item.Attempts)
+	}
+	for i, at := range item.Attempts {
+		if at.Before(start) || at.After(item.DeadAt) || (i > 0 && at.Before(item.Attempts[i-1])) {
+			t.Fatalf("attempt %d at %v is out of order, dead at %v", i, at, item.DeadAt)
+		}
+	}
+	if n := q.Len(); n != 0 {
+		t.Fatalf("queue length = %d, want 0", n)
+	}
+}
+
+// Permanent 错误不重试，直接放入死信队列
+func TestDeadLetterPermanent(t *testing.T) {
+	q := newTestQueue(5)
+	defer q.Close()
+
+	q.Push(QueueObject{Key: "default/a"})
+	obj, _ := q.Pop()
+	if err := q.ReQueueWithError(obj, Permanent(errors.New("bad object"))); !errors.Is(err, ErrPermanent) {
+		t.Fatalf("requeue = %v, want ErrPermanent", err)
+	}
+	items := q.DeadLetters().List()
+	if len(items) != 1 || len(items[0].Attempts) != 1 || len(items[0].Errors) != 1 {
+		t.Fatalf("dead letters = %+v", items)
+	}
+}
+
+func TestRingDeadLetter(t *testing.T) {
+	r := NewRingDeadLetter(2)
+	for _, id := range []string{"1", "2", "3"} {
+		r.Put(DeadLetterItem{ID: id})
+	}
+
+	var ids []string
+	for _, item := range r.List() {
+		ids = append(ids, item.ID)
+	}
+	if got := strings.Join(ids, ","); got != "2,3" {
+		t.Fatalf("ids = %s, want 2,3 after the oldest is evicted", got)
+	}
+	if _, ok := r.Get("1"); ok {
+		t.Fatal("evicted dead letter 1 is still found")
+	}
+	if !r.Remove("2") || r.Remove("2") {
+		t.Fatal("remove 2 should succeed exactly once")
+	}
+	if items := r.List(); len(items) != 1 || items[0].ID != "3" {
+		t.Fatalf("dead letters = %+v, want only 3", items)
+	}
+}
+
+// Replay 将死信放回主队列，重新入列次数从0开始
+func TestReplay(t *testing.T) {
+	q := newTestQueue(0)
+	defer q.Close()
+
+	q.Push(QueueObject{Key: "default/a"})
+	obj, _ := q.Pop()
+	if err := q.ReQueueWithError(obj, errors.New("failed")); !errors.Is(err, ErrMaxReQueue) {
+		t.Fatalf("requeue = %v, want ErrMaxReQueue", err)
+	}
+	id := q.DeadLetters().List()[0].ID
+
+	if err := q.Replay("unknown"); err == nil {
+		t.Fatal("replay of an unknown id returned nil")
+	}
+	if err := q.Replay(id); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := q.DeadLetters().Get(id); ok {
+		t.Fatal("replayed dead letter is still in the dead letter queue")
+	}
+	obj, err := q.Pop()
+	if err != nil || obj.Key != "default/a" || obj.Attempts != 0 {
+		t.Fatalf("replayed object = %+v, %v", obj, err)
+	}
+	q.Finish(obj)
+}
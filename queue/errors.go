@@ -0,0 +1,64 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrPermanent handler 返回该错误(或用 Permanent 包装的错误)时不再重试，直接放入死信队列
+var ErrPermanent = errors.New("permanent failure, do not retry")
+
+// ErrMaxReQueue 超过最大重新入列次数
+var ErrMaxReQueue = errors.New("This object has been requeued for many times, but still fails. ")
+
+// ErrNotSupported 被包装的队列不支持该操作，如不支持批量出队
+var ErrNotSupported = errors.New("operation is not supported by the queue")
+
+// RequeueAfterError handler 返回该错误时，在 After 之后重新入列
+// 不计入重新入列次数，也不经过限速器
+type RequeueAfterError struct {
+	After time.Duration
+	Err   error
+}
+
+// RequeueAfter 在指定时间后重新入列
+func RequeueAfter(after time.Duration) error {
+	return &RequeueAfterError{After: after}
+}
+
+// RequeueAfterWithError 在指定时间后重新入列，并带上原因
+func RequeueAfterWithError(after time.Duration, err error) error {
+	return &RequeueAfterError{After: after, Err: err}
+}
+
+func (e *RequeueAfterError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("requeue after %s: %s", e.After, e.Err)
+	}
+	return fmt.Sprintf("requeue after %s", e.After)
+}
+
+func (e *RequeueAfterError) Unwrap() error {
+	return e.Err
+}
+
+// Permanent 将错误标记为不再重试
+func Permanent(err error) error {
+	if err == nil {
+		return ErrPermanent
+	}
+	return &permanentError{err}
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return "permanent failure: " + e.err.Error()
+}
+
+func (e *permanentError) Unwrap() []error {
+	return []error{e.err, ErrPermanent}
+}
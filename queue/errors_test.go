@@ -0,0 +1,78 @@
+package queue
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/util/workqueue"
+)
+
+// RequeueAfter 不计入重新入列次数，也不重置限速器的退避
+func TestRequeueAfter(t *testing.T) {
+	tests := []struct {
+		name     string
+		errs     []error
+		attempts int
+		requeues int // 限速器记录的次数
+	}{
+		{"failures", []error{errors.New("a"), errors.New("b")}, 2, 2},
+		{"requeue after keeps backoff", []error{errors.New("a"), RequeueAfter(0), errors.New("b")}, 2, 2},
+		{"requeue after only", []error{RequeueAfter(0), RequeueAfterWithError(0, errors.New("a"))}, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rateLimiter := workqueue.NewItemExponentialFailureRateLimiter(time.Millisecond, 10*time.Millisecond)
+			q := NewQueueWithRateLimiter(5, rateLimiter)
+			defer q.Close()
+
+			q.Push(QueueObject{Key: "default/a"})
+			obj, err := q.Pop()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, handleErr := range tt.errs {
+				if err := q.ReQueueWithError(obj, handleErr); err != nil {
+					t.Fatal(err)
+				}
+				if obj, err = q.Pop(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if obj.Attempts != tt.attempts {
+				t.Errorf("attempts = %d, want %d", obj.Attempts, tt.attempts)
+			}
+			if n := rateLimiter.NumRequeues(item(obj)); n != tt.requeues {
+				t.Errorf("rate limiter requeues = %d, want %d", n, tt.requeues)
+			}
+		})
+	}
+}
+
+func TestPersistentQueueRequeueAfter(t *testing.T) {
+	q, err := NewPersistentQueue(NewQueue(5), PersistenceConfig{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	q.Push(QueueObject{Key: "default/a", CreateAt: time.Now()})
+	obj, _ := q.Pop()
+	if err := q.ReQueueWithError(obj, RequeueAfter(0)); err != nil {
+		t.Fatal(err)
+	}
+	obj, _ = q.Pop()
+	if err := q.ReQueueWithError(obj, errors.New("failed")); err != nil {
+		t.Fatal(err)
+	}
+
+	live, _, err := q.wal.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, record := range live {
+		if record.Attempts != 1 {
+			t.Fatalf("wal attempts = %d, want 1", record.Attempts)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package queue
+
+import (
+	"k8s.io/client-go/util/workqueue"
+)
+
+// FairConfig 公平队列配置
+type FairConfig struct {
+	Enabled        bool           `json:"enabled" yaml:"enabled"`
+	ByResourceType bool           `json:"byResourceType" yaml:"byResourceType"` // 按 集群+资源类型 分通道，默认只按集群
+	Weights        map[string]int `json:"weights" yaml:"weights"`               // 通道权重，key 为集群名或 集群名/资源类型，默认 1
+}
+
+// NewFairQueue 按集群(可选再按资源类型)分通道的公平队列
+// 通道之间按权重做平滑加权轮询，避免某个集群的大量事件阻塞其他集群
+func NewFairQueue(maxReQueueTime int, rateLimiter workqueue.RateLimiter, config FairConfig) *Wq {
+	laneOf := func(item interface{}) string {
+		obj := itemObject(item)
+		if config.ByResourceType {
+			return obj.ClusterName + "/" + obj.ResourceType
+		}
+		return obj.ClusterName
+	}
+
+	newLane := func(name string) *lane {
+		weight, ok := config.Weights[name]
+		if !ok && config.ByResourceType {
+			// 集群+资源类型 未配置时使用集群的权重
+			weight = config.Weights[itemObject(name).ClusterName]
+		}
+		if weight <= 0 {
+			weight = 1
+		}
+		return &lane{name: name, weight: weight}
+	}
+
+	fq := newLaneQueue(laneOf, newLane, pickWeightedRoundRobin)
+	return newQueueWithCustomQueue(maxReQueueTime, rateLimiter, fq)
+}
+
+// pickWeightedRoundRobin 平滑加权轮询 (nginx smooth weighted round-robin)
+func pickWeightedRoundRobin(lanes []*lane) *lane {
+	var best *lane
+	total := 0
+	for _, l := range lanes {
+		l.current += l.weight
+		total += l.weight
+		if best == nil || l.current > best.current {
+			best = l
+		}
+	}
+	best.current -= total
+	return best
+}
@@ -0,0 +1,89 @@
+package queue
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"multiple-k8s-informer/resource"
+
+	"k8s.io/client-go/util/workqueue"
+)
+
+// popClusters 出队 n 个对象，返回集群名
+func popClusters(t *testing.T, q Queue, n int) []string {
+	t.Helper()
+	var clusters []string
+	for i := 0; i < n; i++ {
+		obj, err := q.Pop()
+		if err != nil {
+			t.Fatal(err)
+		}
+		clusters = append(clusters, obj.ClusterName)
+		q.Finish(obj)
+	}
+	return clusters
+}
+
+func pushN(q Queue, cluster, resourceType string, n int) {
+	for i := 0; i < n; i++ {
+		q.Push(QueueObject{ClusterName: cluster, ResourceType: resourceType, Key: fmt.Sprintf("default/%s-%d", resourceType, i)})
+	}
+}
+
+func TestFairQueue(t *testing.T) {
+	tests := []struct {
+		name   string
+		config FairConfig
+		push   func(q Queue)
+		want   string
+	}{
+		{"equal weights", FairConfig{}, func(q Queue) {
+			pushN(q, "c1", resource.Pods, 3)
+			pushN(q, "c2", resource.Pods, 3)
+		}, "c1,c2,c1,c2,c1,c2"},
+		{"weights", FairConfig{Weights: map[string]int{"c1": 2}}, func(q Queue) {
+			pushN(q, "c1", resource.Pods, 4)
+			pushN(q, "c2", resource.Pods, 2)
+		}, "c1,c2,c1,c1,c2,c1"},
+		{"idle cluster is skipped", FairConfig{Weights: map[string]int{"c1": 5}}, func(q Queue) {
+			pushN(q, "c1", resource.Pods, 1)
+			pushN(q, "c2", resource.Pods, 3)
+		}, "c1,c2,c2,c2"},
+		{"by resource type", FairConfig{ByResourceType: true, Weights: map[string]int{"c1": 2}}, func(q Queue) {
+			pushN(q, "c1", resource.Pods, 2)
+			pushN(q, "c1", resource.Events, 2)
+			pushN(q, "c2", resource.Pods, 1)
+		}, "c1,c1,c2,c1,c1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := NewFairQueue(3, workqueue.DefaultItemBasedRateLimiter(), tt.config)
+			defer q.Close()
+			tt.push(q)
+			if got := strings.Join(popClusters(t, q, strings.Count(tt.want, ",")+1), ","); got != tt.want {
+				t.Fatalf("order = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// 大量事件的集群不会饿死后来的集群
+func TestFairQueueNoisyCluster(t *testing.T) {
+	q := NewFairQueue(3, workqueue.DefaultItemBasedRateLimiter(), FairConfig{})
+	defer q.Close()
+
+	pushN(q, "noisy", resource.Pods, 1000)
+	popClusters(t, q, 10)
+	pushN(q, "c1", resource.Pods, 1)
+	pushN(q, "c2", resource.Pods, 1)
+
+	clusters := popClusters(t, q, 4)
+	got := strings.Join(clusters, ",")
+	if !strings.Contains(got, "c1") || !strings.Contains(got, "c2") {
+		t.Fatalf("order = %s, want c1 and c2 within the next 4 items", got)
+	}
+	if n := q.Len(); n != 1000-10-2 {
+		t.Fatalf("queue length = %d, want %d", n, 1000-10-2)
+	}
+}
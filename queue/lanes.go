@@ -0,0 +1,183 @@
+package queue
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/util/workqueue"
+)
+
+// laneQueue 多通道的 workqueue.Interface 实现
+// 保留 workqueue 的去重语义(dirty/processing)，对象按 laneOf 分到不同通道，由 pick 决定下一个出队的通道
+type laneQueue struct {
+	cond *sync.Cond
+
+	lanes map[string]*lane
+	order []string // 通道创建顺序，保证 pick 的遍历顺序稳定
+	size  int
+
+	dirty      map[interface{}]struct{}
+	processing map[interface{}]struct{}
+
+	laneOf  func(item interface{}) string
+	newLane func(name string) *lane
+	pick    func(lanes []*lane) *lane
+
+	shuttingDown bool
+	drain        bool
+}
+
+// lane 单个通道，FIFO
+type lane struct {
+	name       string
+	items      []interface{}
+	enqueuedAt []time.Time
+
+	weight   int // 公平队列的权重
+	current  int // 平滑加权轮询的当前值
+	priority int // 优先级队列的优先级，越大越优先
+}
+
+var _ workqueue.Interface = &laneQueue{}
+
+func newLaneQueue(laneOf func(interface{}) string, newLane func(string) *lane, pick func([]*lane) *lane) *laneQueue {
+	return &laneQueue{
+		cond:       sync.NewCond(&sync.Mutex{}),
+		lanes:      make(map[string]*lane),
+		dirty:      make(map[interface{}]struct{}),
+		processing: make(map[interface{}]struct{}),
+		laneOf:     laneOf,
+		newLane:    newLane,
+		pick:       pick,
+	}
+}
+
+func (q *laneQueue) Add(item interface{}) {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+
+	if q.shuttingDown {
+		return
+	}
+	if _, ok := q.dirty[item]; ok {
+		return
+	}
+	q.dirty[item] = struct{}{}
+	if _, ok := q.processing[item]; ok {
+		return
+	}
+	q.enqueue(item)
+	q.cond.Signal()
+}
+
+func (q *laneQueue) Len() int {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	return q.size
+}
+
+func (q *laneQueue) Get() (item interface{}, shutdown bool) {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+
+	for q.size == 0 && !q.shuttingDown {
+		q.cond.Wait()
+	}
+	if q.size == 0 {
+		return nil, true
+	}
+
+	nonEmpty := make([]*lane, 0, len(q.order))
+	for _, name := range q.order {
+		if l := q.lanes[name]; len(l.items) > 0 {
+			nonEmpty = append(nonEmpty, l)
+		}
+	}
+	l := q.pick(nonEmpty)
+
+	item = l.items[0]
+	l.items[0] = nil
+	l.items = l.items[1:]
+	l.enqueuedAt = l.enqueuedAt[1:]
+	q.size--
+
+	q.processing[item] = struct{}{}
+	delete(q.dirty, item)
+	return item, false
+}
+
+func (q *laneQueue) Done(item interface{}) {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+
+	delete(q.processing, item)
+	if _, ok := q.dirty[item]; ok {
+		q.enqueue(item)
+		q.cond.Signal()
+	} else if len(q.processing) == 0 {
+		// 等待的可能是阻塞在 Get 中的 goroutine，需要唤醒所有等待者，保证 ShutDownWithDrain 能返回
+		q.cond.Broadcast()
+	}
+}
+
+func (q *laneQueue) ShutDown() {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+
+	q.drain = false
+	q.shuttingDown = true
+	q.cond.Broadcast()
+}
+
+func (q *laneQueue) ShutDownWithDrain() {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+
+	q.drain = true
+	q.shuttingDown = true
+	q.cond.Broadcast()
+
+	for len(q.processing) != 0 && q.drain {
+		q.cond.Wait()
+	}
+}
+
+func (q *laneQueue) ShuttingDown() bool {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	return q.shuttingDown
+}
+
+// enqueue 调用时需持有锁
+func (q *laneQueue) enqueue(item interface{}) {
+	name := q.laneOf(item)
+	l, ok := q.lanes[name]
+	if !ok {
+		l = q.newLane(name)
+		q.lanes[name] = l
+		q.order = append(q.order, name)
+	}
+	l.items = append(l.items, item)
+	l.enqueuedAt = append(l.enqueuedAt, time.Now())
+	q.size++
+}
+
+// itemObject 从 workqueue 中的对象解析出集群与资源类型，兼容合并模式的 <cluster>/<resource>/<key>
+func itemObject(item interface{}) QueueObject {
+	switch v := item.(type) {
+	case QueueObject:
+		return v
+	case string:
+		parts := strings.SplitN(v, "/", 3)
+		obj := QueueObject{ClusterName: parts[0]}
+		if len(parts) > 1 {
+			obj.ResourceType = parts[1]
+		}
+		if len(parts) > 2 {
+			obj.Key = parts[2]
+		}
+		return obj
+	}
+	return QueueObject{}
+}
@@ -0,0 +1,358 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"multiple-k8s-informer/metrics"
+	"multiple-k8s-informer/resource"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/klog"
+)
+
+// DefaultSegmentSize 默认 wal 段大小
+const DefaultSegmentSize = 64 * 1024 * 1024
+
+// PersistenceConfig 持久化队列配置
+type PersistenceConfig struct {
+	Enabled     bool   `json:"enabled" yaml:"enabled"`
+	Dir         string `json:"dir" yaml:"dir"`                 // wal 目录
+	SegmentSize int64  `json:"segmentSize" yaml:"segmentSize"` // 段大小，超过后压缩，默认 64MB；未完成的记录超过该大小时，按压缩后大小的 2 倍
+	Sync        bool   `json:"sync" yaml:"sync"`               // 每次写入后 fsync
+}
+
+// PersistentQueue 持久化队列
+// Push、ReQueue、Finish 写入磁盘上的 wal，进程重启时将未完成的对象重新放入队列
+// wal 写入失败时立即压缩重写所有未完成的记录，仍然失败时 Err 返回错误，直到下一次压缩成功
+type PersistentQueue struct {
+	Decorator
+
+	mu       sync.Mutex
+	wal      *wal
+	nextID   uint64
+	live     map[uint64]*walRecord
+	byKey    map[string][]uint64 // CoalesceKey -> 未完成记录的id
+	coalesce bool
+	err      error         // 最近一次未恢复的 wal 错误
+	replayed []QueueObject // 启动时重新放入队列的对象
+
+	batcher batcher
+}
+
+var (
+	_ Queue           = &PersistentQueue{}
+	_ ErrorReQueuer   = &PersistentQueue{}
+	_ BatchQueue      = &PersistentQueue{}
+	_ DeadLetterQueue = &PersistentQueue{}
+)
+
+// NewPersistentQueue 在 q 之上增加持久化，并将上次未完成的对象重新放入 q
+func NewPersistentQueue(q Queue, config PersistenceConfig) (*PersistentQueue, error) {
+	if config.Dir == "" {
+		return nil, errors.New("persistence dir is empty")
+	}
+	if config.SegmentSize <= 0 {
+		config.SegmentSize = DefaultSegmentSize
+	}
+
+	w, err := openWal(config.Dir, config.SegmentSize, config.Sync)
+	if err != nil {
+		return nil, err
+	}
+	live, maxID, err := w.load()
+	if err != nil {
+		return nil, err
+	}
+	// 启动时压缩一次，去掉已完成的记录
+	if err := w.compact(live); err != nil {
+		return nil, err
+	}
+
+	cq, coalesce := q.(*CoalescingQueue)
+	pq := &PersistentQueue{
+		Decorator: Decorator{Queue: q},
+		wal:       w,
+		nextID:    maxID,
+		live:      live,
+		byKey:     make(map[string][]uint64),
+		coalesce:  coalesce,
+	}
+	if coalesce {
+		cq.onDrop = pq.dropped
+	}
+
+	ids := make([]uint64, 0, len(live))
+	for id := range live {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		obj, err := decodeObject(live[id].Object)
+		if err != nil {
+			klog.Error("replay queue object error: ", err)
+			delete(live, id)
+			continue
+		}
+		key := CoalesceKey(obj)
+		pq.byKey[key] = append(pq.byKey[key], id)
+		if r, ok := q.(attemptRestorer); ok && live[id].Attempts > 0 {
+			r.restoreAttempts(obj, live[id].Attempts)
+		}
+		q.Push(obj)
+		pq.replayed = append(pq.replayed, obj)
+	}
+	if len(ids) > 0 {
+		klog.Infof("replay %d unfinished queue objects from %s", len(live), config.Dir)
+	}
+
+	return pq, nil
+}
+
+func (q *PersistentQueue) Push(obj QueueObject) {
+	record := &walRecord{Op: walPush, Object: encodeObject(obj)}
+
+	q.mu.Lock()
+	q.nextID++
+	record.ID = q.nextID
+	q.live[record.ID] = record
+	key := CoalesceKey(obj)
+	q.byKey[key] = append(q.byKey[key], record.ID)
+	q.write(record)
+	q.mu.Unlock()
+
+	q.Queue.Push(obj)
+}
+
+func (q *PersistentQueue) ReQueue(obj QueueObject) error {
+	return q.ReQueueWithError(obj, nil)
+}
+
+func (q *PersistentQueue) ReQueueWithError(obj QueueObject, handleErr error) error {
+	err := ReQueueWithError(q.Queue, obj, handleErr)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err != nil {
+		// 已放入死信队列，不再需要重放
+		q.finish(obj)
+		return err
+	}
+	var after *RequeueAfterError
+	if errors.As(handleErr, &after) {
+		// 指定时间重新入列不计入次数
+		return nil
+	}
+	for _, id := range q.matched(obj) {
+		record := q.live[id]
+		record.Attempts++
+		q.write(&walRecord{Op: walReQueue, ID: id, Attempts: record.Attempts})
+	}
+	return nil
+}
+
+func (q *PersistentQueue) Finish(obj QueueObject) {
+	q.Queue.Finish(obj)
+
+	q.mu.Lock()
+	q.finish(obj)
+	q.mu.Unlock()
+}
+
+// Err wal 写入或压缩失败、之后也没有压缩成功时返回错误，此时对象不一定能在重启后重放
+func (q *PersistentQueue) Err() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.err
+}
+
+// Replayed 启动时从 wal 重新放入队列的对象，按原来的顺序，用于外层的队列恢复状态
+func (q *PersistentQueue) Replayed() []QueueObject {
+	return q.replayed
+}
+
+func (q *PersistentQueue) PopBatch(ctx context.Context, maxItems int, maxWait time.Duration) ([]QueueObject, error) {
+	return q.batcher.popBatch(ctx, q, maxItems, maxWait)
+}
+
+func (q *PersistentQueue) FinishBatch(objs []QueueObject) {
+	finishBatch(q, objs)
+}
+
+func (q *PersistentQueue) ReQueueBatch(objs []QueueObject, handleErr error) error {
+	return reQueueBatch(q, objs, handleErr)
+}
+
+// Replay 将死信重新放入队列，同样写入 wal
+func (q *PersistentQueue) Replay(id string) error {
+	deadLetter := q.DeadLetters()
+	if deadLetter == nil {
+		return errors.New("dead letter is not set. ")
+	}
+	item, ok := deadLetter.Get(id)
+	if !ok {
+		return fmt.Errorf("dead letter %s not found. ", id)
+	}
+	deadLetter.Remove(id)
+	q.Push(item.Object)
+	return nil
+}
+
+func (q *PersistentQueue) Close() {
+	q.Queue.Close()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err := q.wal.close(); err != nil {
+		klog.Error("close wal error: ", err)
+	}
+}
+
+// dropped 合并模式下对象在被处理前创建又删除，完成被合并的记录
+func (q *PersistentQueue) dropped(obj QueueObject) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	key := CoalesceKey(obj)
+	var ids []uint64
+	for _, id := range q.byKey[key] {
+		at := q.live[id].Object.CreateAt
+		if !at.Before(obj.Coalesced.Since) && !at.After(obj.CreateAt) {
+			ids = append(ids, id)
+		}
+	}
+	q.finishIDs(key, ids)
+}
+
+// finish 调用时需持有锁
+func (q *PersistentQueue) finish(obj QueueObject) {
+	q.finishIDs(CoalesceKey(obj), q.matched(obj))
+}
+
+// finishIDs 调用时需持有锁
+func (q *PersistentQueue) finishIDs(key string, ids []uint64) {
+	if len(ids) == 0 {
+		return
+	}
+
+	rest := q.byKey[key][:0]
+	for _, id := range q.byKey[key] {
+		if containsID(ids, id) {
+			delete(q.live, id)
+			q.write(&walRecord{Op: walFinish, ID: id})
+			continue
+		}
+		rest = append(rest, id)
+	}
+	if len(rest) == 0 {
+		delete(q.byKey, key)
+	} else {
+		q.byKey[key] = rest
+	}
+}
+
+// matched 找到 obj 对应的未完成记录，调用时需持有锁
+// 合并模式下，Pop 出来的是最新的对象，在它之前收到的同一对象的事件都已被合并
+func (q *PersistentQueue) matched(obj QueueObject) (ids []uint64) {
+	for _, id := range q.byKey[CoalesceKey(obj)] {
+		o := q.live[id].Object
+		if q.coalesce {
+			if !o.CreateAt.After(obj.CreateAt) {
+				ids = append(ids, id)
+			}
+			continue
+		}
+		if o.Event == obj.Event && o.CreateAt.Equal(obj.CreateAt) {
+			ids = append(ids, id)
+		}
+	}
+	return
+}
+
+// write 写入 wal，段满时压缩，调用时需持有锁
+// 写入失败或之前有未恢复的错误时也压缩，新段包含所有未完成的记录，成功后恢复持久化
+func (q *PersistentQueue) write(record *walRecord) {
+	err := q.wal.append(record)
+	if err != nil {
+		klog.Error("write wal error: ", err)
+		metrics.ObserveWalError("write")
+	}
+	if err == nil && q.err == nil && !q.wal.full() {
+		return
+	}
+
+	if err := q.wal.compact(q.live); err != nil {
+		klog.Error("compact wal error: ", err)
+		metrics.ObserveWalError("compact")
+		q.err = fmt.Errorf("wal is not durable: %w", err)
+		return
+	}
+	if q.err != nil {
+		klog.Info("wal recovered after compaction")
+	}
+	q.err = nil
+}
+
+func encodeObject(obj QueueObject) *walObject {
+	o := &walObject{
+		ClusterName:  obj.ClusterName,
+		Event:        obj.Event,
+		ResourceType: obj.ResourceType,
+		Key:          obj.Key,
+		CreateAt:     obj.CreateAt,
+		Diff:         obj.Diff,
+	}
+
+	if raw := resource.Unwrap(obj.Obj); raw != nil {
+		b, err := json.Marshal(raw)
+		if err != nil {
+			klog.Error("encode queue object error: ", err)
+		} else {
+			o.Obj = b
+		}
+	}
+	return o
+}
+
+func decodeObject(o *walObject) (QueueObject, error) {
+	if o == nil {
+		return QueueObject{}, errors.New("empty wal record")
+	}
+	obj := QueueObject{
+		ClusterName:  o.ClusterName,
+		Event:        o.Event,
+		ResourceType: o.ResourceType,
+		Key:          o.Key,
+		CreateAt:     o.CreateAt,
+		Diff:         o.Diff,
+	}
+	if len(o.Obj) == 0 {
+		return obj, nil
+	}
+
+	runtimeObj := resource.NewObject(o.ResourceType)
+	if u, ok := runtimeObj.(*unstructured.Unstructured); ok {
+		// informer 中的对象通常没有 kind，不能直接用 unstructured 反序列化
+		if err := json.Unmarshal(o.Obj, &u.Object); err != nil {
+			return obj, err
+		}
+	} else if err := json.Unmarshal(o.Obj, runtimeObj); err != nil {
+		return obj, err
+	}
+	obj.Obj = runtimeObj
+	return obj, nil
+}
+
+func containsID(ids []uint64, id uint64) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package queue
+
+import (
+	"strconv"
+	"time"
+
+	"multiple-k8s-informer/resource"
+
+	"k8s.io/client-go/util/workqueue"
+)
+
+// DefaultStarvationTimeout 低优先级通道最长等待时间，超过后优先出队
+const DefaultStarvationTimeout = 10 * time.Second
+
+// PriorityFunc 计算对象的优先级，越大越优先
+// 合并模式下 workqueue 中只有 <cluster>/<resource>/<key>，此时 Event 为空
+type PriorityFunc func(obj QueueObject) int
+
+// PriorityConfig 优先级队列配置
+type PriorityConfig struct {
+	Enabled           bool           `json:"enabled" yaml:"enabled"`
+	DefaultPriority   int            `json:"defaultPriority" yaml:"defaultPriority"`     // 未匹配任何通道时的优先级
+	StarvationTimeout time.Duration  `json:"starvationTimeout" yaml:"starvationTimeout"` // 通道队首等待超过该时间则优先出队，默认 10s
+	Lanes             []PriorityLane `json:"lanes" yaml:"lanes"`
+}
+
+// PriorityLane 优先级通道，按顺序匹配，第一个匹配的通道生效；匹配条件为空表示匹配全部
+type PriorityLane struct {
+	Name          string   `json:"name" yaml:"name"` // 通道名称，仅用于说明
+	Priority      int      `json:"priority" yaml:"priority"`
+	Clusters      []string `json:"clusters" yaml:"clusters"`
+	ResourceTypes []string `json:"resourceTypes" yaml:"resourceTypes"`
+	Events        []string `json:"events" yaml:"events"`
+}
+
+// PriorityFunc 将配置的通道转换为 PriorityFunc
+func (c PriorityConfig) PriorityFunc() PriorityFunc {
+	return func(obj QueueObject) int {
+		for _, l := range c.Lanes {
+			if resource.Match(l.Clusters, obj.ClusterName) && resource.Match(l.ResourceTypes, obj.ResourceType) && resource.Match(l.Events, obj.Event) {
+				return l.Priority
+			}
+		}
+		return c.DefaultPriority
+	}
+}
+
+// NewPriorityQueue 优先级队列，每个优先级一个通道，优先出队优先级高的通道
+// 某个通道队首等待超过 StarvationTimeout 时，优先出队等待最久的通道，避免低优先级对象饿死
+// priorityFunc 为 nil 时使用配置中的通道
+func NewPriorityQueue(maxReQueueTime int, rateLimiter workqueue.RateLimiter, config PriorityConfig, priorityFunc PriorityFunc) *Wq {
+	if priorityFunc == nil {
+		priorityFunc = config.PriorityFunc()
+	}
+	starvationTimeout := config.StarvationTimeout
+	if starvationTimeout <= 0 {
+		starvationTimeout = DefaultStarvationTimeout
+	}
+
+	laneOf := func(item interface{}) string {
+		return strconv.Itoa(priorityFunc(itemObject(item)))
+	}
+
+	newLane := func(name string) *lane {
+		priority, _ := strconv.Atoi(name)
+		return &lane{name: name, priority: priority}
+	}
+
+	pick := func(lanes []*lane) *lane {
+		var best, oldest *lane
+		for _, l := range lanes {
+			if best == nil || l.priority > best.priority {
+				best = l
+			}
+			if oldest == nil || l.enqueuedAt[0].Before(oldest.enqueuedAt[0]) {
+				oldest = l
+			}
+		}
+		if time.Since(oldest.enqueuedAt[0]) > starvationTimeout {
+			return oldest
+		}
+		return best
+	}
+
+	pq := newLaneQueue(laneOf, newLane, pick)
+	return newQueueWithCustomQueue(maxReQueueTime, rateLimiter, pq)
+}
@@ -0,0 +1,116 @@
+package queue
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"multiple-k8s-informer/resource"
+
+	"k8s.io/client-go/util/workqueue"
+)
+
+func popKeys(t *testing.T, q Queue, n int) string {
+	t.Helper()
+	var keys []string
+	for i := 0; i < n; i++ {
+		obj, err := q.Pop()
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, obj.Key)
+		q.Finish(obj)
+	}
+	return strings.Join(keys, ",")
+}
+
+var testPriorityConfig = PriorityConfig{
+	DefaultPriority: 1,
+	Lanes: []PriorityLane{
+		{Name: "deletes", Priority: 10, Events: []string{resource.EventDelete}},
+		{Name: "prod", Priority: 5, Clusters: []string{"prod"}},
+		{Name: "events", Priority: 0, ResourceTypes: []string{resource.Events}},
+	},
+}
+
+func TestPriorityFunc(t *testing.T) {
+	priority := testPriorityConfig.PriorityFunc()
+	tests := []struct {
+		obj  QueueObject
+		want int
+	}{
+		{QueueObject{ClusterName: "prod", ResourceType: resource.Pods, Event: resource.EventDelete}, 10},
+		{QueueObject{ClusterName: "prod", ResourceType: resource.Events, Event: resource.EventAdd}, 5},
+		{QueueObject{ClusterName: "dev", ResourceType: resource.Events, Event: resource.EventAdd}, 0},
+		{QueueObject{ClusterName: "dev", ResourceType: resource.Pods, Event: resource.EventUpdate}, 1},
+	}
+	for _, tt := range tests {
+		if got := priority(tt.obj); got != tt.want {
+			t.Errorf("priority(%s %s %s) = %d, want %d", tt.obj.ClusterName, tt.obj.ResourceType, tt.obj.Event, got, tt.want)
+		}
+	}
+}
+
+func TestPriorityQueueOrder(t *testing.T) {
+	q := NewPriorityQueue(3, workqueue.DefaultItemBasedRateLimiter(), testPriorityConfig, nil)
+	defer q.Close()
+
+	q.Push(QueueObject{ClusterName: "dev", ResourceType: resource.Events, Event: resource.EventAdd, Key: "event"})
+	q.Push(QueueObject{ClusterName: "dev", ResourceType: resource.Pods, Event: resource.EventAdd, Key: "dev-1"})
+	q.Push(QueueObject{ClusterName: "prod", ResourceType: resource.Pods, Event: resource.EventAdd, Key: "prod"})
+	q.Push(QueueObject{ClusterName: "dev", ResourceType: resource.Pods, Event: resource.EventAdd, Key: "dev-2"})
+	q.Push(QueueObject{ClusterName: "dev", ResourceType: resource.Pods, Event: resource.EventDelete, Key: "delete"})
+
+	// 优先级高的先出队，同一通道内先进先出
+	if got, want := popKeys(t, q, 5), "delete,prod,dev-1,dev-2,event"; got != want {
+		t.Fatalf("order = %s, want %s", got, want)
+	}
+}
+
+// 低优先级通道队首等待超过 StarvationTimeout 后优先出队
+func TestPriorityQueueStarvation(t *testing.T) {
+	config := testPriorityConfig
+	config.StarvationTimeout = 20 * time.Millisecond
+	q := NewPriorityQueue(3, workqueue.DefaultItemBasedRateLimiter(), config, nil)
+	defer q.Close()
+
+	q.Push(QueueObject{ClusterName: "dev", ResourceType: resource.Events, Key: "event"})
+	q.Push(QueueObject{ClusterName: "prod", Key: "prod-1"})
+	if got := popKeys(t, q, 1); got != "prod-1" {
+		t.Fatalf("got %s before the starvation timeout, want prod-1", got)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	q.Push(QueueObject{ClusterName: "prod", Key: "prod-2"})
+	if got, want := popKeys(t, q, 2), "event,prod-2"; got != want {
+		t.Fatalf("order = %s, want %s", got, want)
+	}
+}
+
+// 处理中的对象完成后 ShutDownWithDrain 返回，即使有 goroutine 阻塞在 Get
+func TestLaneQueueShutDownWithDrain(t *testing.T) {
+	q := newLaneQueue(func(interface{}) string { return "" }, func(name string) *lane { return &lane{name: name} }, func(lanes []*lane) *lane { return lanes[0] })
+
+	q.Add("a")
+	item, _ := q.Get()
+	for i := 0; i < 3; i++ {
+		go q.Get()
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		q.ShutDownWithDrain()
+		close(drained)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	q.Done(item)
+
+	select {
+	case <-drained:
+	case <-time.After(time.Second):
+		t.Fatal("ShutDownWithDrain did not return after the last item was done")
+	}
+	if _, shutdown := q.Get(); !shutdown {
+		t.Fatal("Get after shut down returned an item")
+	}
+}
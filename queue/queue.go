@@ -1,13 +1,25 @@
 package queue
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
 
 	"time"
 
+	"multiple-k8s-informer/metrics"
+
 	"k8s.io/client-go/util/workqueue"
 )
 
+// DefaultDeadLetterSize 默认死信队列容量
+const DefaultDeadLetterSize = 1000
+
+// QueueName workqueue 的名字，用于 metrics
+const QueueName = "multiple_k8s_informer"
+
 // QueueObject 入队对象
 // 用来包装经由informer收到的资源对象
 
@@ -19,6 +31,9 @@ type QueueObject struct {
 	Key          string      // <namespace>/<name>
 	Obj          interface{} // runtime.Object	资源对象
 	CreateAt     time.Time   // 创建时间，也可以记录更新次数 与 更新时间
+	Coalesced    *Coalesced  // 合并模式下被合并的事件，非合并模式为 nil
+	Attempts     int         // 已失败重新入列的次数，Pop 时填入
+	Diff         string      // update 事件中旧对象到新对象的 JSON merge patch，开启 diff 时才有
 }
 
 type Queue interface {
@@ -36,17 +51,168 @@ type Queue interface {
 	SetReMaxReQueueTime(int)
 }
 
+// 以下为队列的可选能力，通过类型断言检查，Wq 全部实现
+
+// ErrorReQueuer 重新入列时记录handler返回的错误
+type ErrorReQueuer interface {
+	// ReQueueWithError 重新放入队列，并记录handler返回的错误，超过次数后放入死信队列
+	// 支持 RequeueAfter 指定重新入列的时间，Permanent/ErrPermanent 不再重试
+	ReQueueWithError(QueueObject, error) error
+}
+
+// BatchQueue 批量出队
+type BatchQueue interface {
+	// PopBatch 批量出队，阻塞直到拿到第一个对象，之后最多等待 maxWait，凑够 maxItems 个立即返回
+	PopBatch(ctx context.Context, maxItems int, maxWait time.Duration) ([]QueueObject, error)
+	// FinishBatch 批量完成
+	FinishBatch([]QueueObject)
+	// ReQueueBatch 批量重新入列，错误为 BatchError 时只有失败的对象重新入列
+	ReQueueBatch([]QueueObject, error) error
+}
+
+// DeadLetterQueue 超过最大重新入列次数的对象放入死信队列
+type DeadLetterQueue interface {
+	// SetDeadLetter 设置死信队列
+	SetDeadLetter(DeadLetter)
+	// DeadLetters 死信队列，可查看与删除死信
+	DeadLetters() DeadLetter
+	// Replay 将死信重新放入队列
+	Replay(id string) error
+}
+
+// Sized 可以查看队列长度
+type Sized interface {
+	// Len 队列中等待处理的对象数量
+	Len() int
+}
+
+// ReQueueWithError q 实现了 ErrorReQueuer 时记录错误，否则调用 ReQueue
+func ReQueueWithError(q Queue, obj QueueObject, handleErr error) error {
+	if r, ok := q.(ErrorReQueuer); ok {
+		return r.ReQueueWithError(obj, handleErr)
+	}
+	return q.ReQueue(obj)
+}
+
+// Len q 没有实现 Sized 时返回 0
+func Len(q Queue) int {
+	if s, ok := q.(Sized); ok {
+		return s.Len()
+	}
+	return 0
+}
+
+// Decorator 包装队列时嵌入，将可选能力转发给被包装的队列，被包装的队列不支持时返回 ErrNotSupported
+type Decorator struct {
+	Queue
+}
+
+var (
+	_ ErrorReQueuer   = Decorator{}
+	_ BatchQueue      = Decorator{}
+	_ DeadLetterQueue = Decorator{}
+	_ Sized           = Decorator{}
+)
+
+func (d Decorator) ReQueueWithError(obj QueueObject, handleErr error) error {
+	return ReQueueWithError(d.Queue, obj, handleErr)
+}
+
+func (d Decorator) PopBatch(ctx context.Context, maxItems int, maxWait time.Duration) ([]QueueObject, error) {
+	if b, ok := d.Queue.(BatchQueue); ok {
+		return b.PopBatch(ctx, maxItems, maxWait)
+	}
+	return nil, ErrNotSupported
+}
+
+func (d Decorator) FinishBatch(objs []QueueObject) {
+	if b, ok := d.Queue.(BatchQueue); ok {
+		b.FinishBatch(objs)
+		return
+	}
+	finishBatch(d.Queue, objs)
+}
+
+func (d Decorator) ReQueueBatch(objs []QueueObject, handleErr error) error {
+	if b, ok := d.Queue.(BatchQueue); ok {
+		return b.ReQueueBatch(objs, handleErr)
+	}
+	return reQueueBatch(d.Queue, objs, handleErr)
+}
+
+func (d Decorator) SetDeadLetter(deadLetter DeadLetter) {
+	if q, ok := d.Queue.(DeadLetterQueue); ok {
+		q.SetDeadLetter(deadLetter)
+	}
+}
+
+// DeadLetters 被包装的队列不支持时返回 nil
+func (d Decorator) DeadLetters() DeadLetter {
+	if q, ok := d.Queue.(DeadLetterQueue); ok {
+		return q.DeadLetters()
+	}
+	return nil
+}
+
+func (d Decorator) Replay(id string) error {
+	if q, ok := d.Queue.(DeadLetterQueue); ok {
+		return q.Replay(id)
+	}
+	return ErrNotSupported
+}
+
+func (d Decorator) Len() int {
+	return Len(d.Queue)
+}
+
 type Wq struct {
 	workqueue.RateLimitingInterface
 	MaxReQueueTime int
+
+	deadLetter DeadLetter
+	deadSeq    uint64
+
+	mu      sync.Mutex
+	history map[interface{}]*attemptHistory
+
+	batcher batcher
 }
 
-var _ Queue = &Wq{}
+// attemptHistory 记录对象每次失败的错误与重新入列时间
+type attemptHistory struct {
+	errors   []string
+	attempts []time.Time
+}
+
+var (
+	_ Queue           = &Wq{}
+	_ ErrorReQueuer   = &Wq{}
+	_ BatchQueue      = &Wq{}
+	_ DeadLetterQueue = &Wq{}
+	_ Sized           = &Wq{}
+)
 
 func NewQueue(maxReQueueTime int) *Wq {
+	return NewQueueWithRateLimiter(maxReQueueTime, workqueue.DefaultItemBasedRateLimiter())
+}
+
+// NewQueueWithRateLimiter 使用自定义限速器创建队列，限速器只在 ReQueue 时生效
+func NewQueueWithRateLimiter(maxReQueueTime int, rateLimiter workqueue.RateLimiter) *Wq {
+	return newWq(maxReQueueTime, workqueue.NewRateLimitingQueueWithConfig(rateLimiter, workqueue.RateLimitingQueueConfig{Name: QueueName}))
+}
+
+// newQueueWithCustomQueue 使用自定义出队顺序的 workqueue.Interface 创建队列，如公平队列、优先级队列
+func newQueueWithCustomQueue(maxReQueueTime int, rateLimiter workqueue.RateLimiter, q workqueue.Interface) *Wq {
+	delaying := workqueue.NewDelayingQueueWithCustomQueue(q, QueueName)
+	return newWq(maxReQueueTime, workqueue.NewRateLimitingQueueWithDelayingInterface(delaying, rateLimiter))
+}
+
+func newWq(maxReQueueTime int, q workqueue.RateLimitingInterface) *Wq {
 	return &Wq{
-		workqueue.NewRateLimitingQueue(workqueue.DefaultItemBasedRateLimiter()),
-		maxReQueueTime,
+		RateLimitingInterface: q,
+		MaxReQueueTime:        maxReQueueTime,
+		deadLetter:            NewRingDeadLetter(DefaultDeadLetterSize),
+		history:               make(map[interface{}]*attemptHistory),
 	}
 }
 
@@ -54,36 +220,202 @@ func (q *Wq) SetReMaxReQueueTime(maxReQueueTime int) {
 	q.MaxReQueueTime = maxReQueueTime
 }
 
+func (q *Wq) SetDeadLetter(deadLetter DeadLetter) {
+	q.deadLetter = deadLetter
+}
+
+func (q *Wq) DeadLetters() DeadLetter {
+	return q.deadLetter
+}
+
+// Push 新事件直接入列，不经过限速器
 func (q *Wq) Push(obj QueueObject) {
-	q.AddRateLimited(obj)
+	q.Add(item(obj))
 }
 
 func (q *Wq) Pop() (QueueObject, error) {
-	item, shutdown := q.Get()
+	i, shutdown := q.Get()
 	if shutdown {
 		return QueueObject{}, errors.New("Controller has been stoped. ")
 	}
-	return item.(QueueObject), nil
+	obj := i.(QueueObject)
+	obj.Attempts = q.attempts(i)
+	return obj, nil
 }
 
 func (q *Wq) ReQueue(obj QueueObject) (err error) {
-	// 这里根据配置文件的尝试次数来推送至队列
-
-	if q.NumRequeues(obj) < q.MaxReQueueTime {
-		q.AddRateLimited(obj)
-		return nil
-	}
+	return q.ReQueueWithError(obj, nil)
+}
 
-	q.Forget(obj)
-	q.Done(obj)
-	return errors.New("This object has been requeued for many times, but still fails. ")
+func (q *Wq) ReQueueWithError(obj QueueObject, handleErr error) error {
+	obj = item(obj)
+	return q.retry(obj, obj, handleErr, nil)
 }
 
 func (q *Wq) Finish(obj QueueObject) {
+	obj = item(obj)
+	q.forgetHistory(obj)
 	q.Forget(obj)
 	q.Done(obj)
 }
 
+func (q *Wq) PopBatch(ctx context.Context, maxItems int, maxWait time.Duration) ([]QueueObject, error) {
+	return q.batcher.popBatch(ctx, q, maxItems, maxWait)
+}
+
+func (q *Wq) FinishBatch(objs []QueueObject) {
+	finishBatch(q, objs)
+}
+
+func (q *Wq) ReQueueBatch(objs []QueueObject, handleErr error) error {
+	return reQueueBatch(q, objs, handleErr)
+}
+
+// Replay 从死信队列中取出对象，重新放入队列，重新入列次数从0开始计算
+func (q *Wq) Replay(id string) error {
+	obj, err := q.takeDeadLetter(id)
+	if err != nil {
+		return err
+	}
+	q.Push(obj)
+	return nil
+}
+
 func (q *Wq) Close() {
 	q.ShutDown()
 }
+
+// retry 根据 handler 返回的错误重新入列，item 为 workqueue 中的对象，beforeAdd 在重新入列前调用
+func (q *Wq) retry(item interface{}, obj QueueObject, handleErr error, beforeAdd func()) error {
+	var after *RequeueAfterError
+	switch {
+	case errors.Is(handleErr, ErrPermanent):
+		history := q.record(item, handleErr)
+		q.Forget(item)
+		q.Done(item)
+		q.bury(item, obj, history)
+		return handleErr
+	case errors.As(handleErr, &after):
+		// 指定了时间，不计入次数，也不经过限速器，限速器中已有的退避保留
+		if beforeAdd != nil {
+			beforeAdd()
+		}
+		q.AddAfter(item, after.After)
+		q.Done(item)
+		metrics.ObserveReQueue(obj.ClusterName, obj.ResourceType)
+		return nil
+	}
+
+	// 这里根据配置文件的尝试次数来推送至队列
+	// 次数由 history 记录，令牌桶等限速器的 NumRequeues 恒为0
+	history := q.record(item, handleErr)
+
+	if len(history.attempts) <= q.MaxReQueueTime {
+		if beforeAdd != nil {
+			beforeAdd()
+		}
+		q.AddRateLimited(item)
+		q.Done(item)
+		metrics.ObserveReQueue(obj.ClusterName, obj.ResourceType)
+		return nil
+	}
+
+	q.Forget(item)
+	q.Done(item)
+	q.bury(item, obj, history)
+	return ErrMaxReQueue
+}
+
+// attempts 已失败重新入列的次数
+func (q *Wq) attempts(item interface{}) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if history, ok := q.history[item]; ok {
+		return len(history.attempts)
+	}
+	return 0
+}
+
+// attemptRestorer 持久化队列重放时恢复对象已失败的次数
+type attemptRestorer interface {
+	restoreAttempts(obj QueueObject, attempts int)
+}
+
+func (q *Wq) restoreAttempts(obj QueueObject, attempts int) {
+	q.restoreHistory(item(obj), attempts)
+}
+
+// restoreHistory 恢复失败次数，重放前的失败时间与错误已丢失，时间记为重放时间
+func (q *Wq) restoreHistory(item interface{}, attempts int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	history := &attemptHistory{}
+	now := time.Now()
+	for i := 0; i < attempts; i++ {
+		history.attempts = append(history.attempts, now)
+	}
+	q.history[item] = history
+}
+
+// record 记录本次失败的错误与时间，item 为 workqueue 中的对象
+func (q *Wq) record(item interface{}, handleErr error) *attemptHistory {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	history, ok := q.history[item]
+	if !ok {
+		history = &attemptHistory{}
+		q.history[item] = history
+	}
+	if handleErr != nil {
+		history.errors = append(history.errors, handleErr.Error())
+	}
+	history.attempts = append(history.attempts, time.Now())
+	return history
+}
+
+func (q *Wq) forgetHistory(item interface{}) {
+	q.mu.Lock()
+	delete(q.history, item)
+	q.mu.Unlock()
+}
+
+// bury 超过最大重新入列次数，放入死信队列
+func (q *Wq) bury(item interface{}, obj QueueObject, history *attemptHistory) {
+	q.forgetHistory(item)
+	metrics.ObserveDeadLetter(obj.ClusterName, obj.ResourceType)
+
+	if q.deadLetter == nil {
+		return
+	}
+
+	now := time.Now()
+	q.deadLetter.Put(DeadLetterItem{
+		ID:       fmt.Sprintf("%d-%d", now.UnixNano(), atomic.AddUint64(&q.deadSeq, 1)),
+		Object:   obj,
+		Errors:   history.errors,
+		Attempts: history.attempts,
+		DeadAt:   now,
+	})
+}
+
+// item 放入 workqueue 的对象，Attempts 每次 Pop 时重新填入，不能作为对象的一部分
+func item(obj QueueObject) QueueObject {
+	obj.Attempts = 0
+	return obj
+}
+
+// takeDeadLetter 从死信队列中取出对象
+func (q *Wq) takeDeadLetter(id string) (QueueObject, error) {
+	if q.deadLetter == nil {
+		return QueueObject{}, errors.New("dead letter is not set. ")
+	}
+	item, ok := q.deadLetter.Get(id)
+	if !ok {
+		return QueueObject{}, fmt.Errorf("dead letter %s not found. ", id)
+	}
+	q.deadLetter.Remove(id)
+	return item.Object, nil
+}
@@ -0,0 +1,70 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// minimalQueue 只实现 Queue，没有任何可选能力
+type minimalQueue struct {
+	Queue
+	requeued int
+}
+
+func (q *minimalQueue) ReQueue(obj QueueObject) error {
+	q.requeued++
+	return q.Queue.ReQueue(obj)
+}
+
+func TestDecorator(t *testing.T) {
+	t.Run("forwards optional capabilities", func(t *testing.T) {
+		wq := NewQueue(3)
+		defer wq.Close()
+		d := Decorator{Queue: wq}
+
+		d.Push(QueueObject{Key: "a"})
+		if n := d.Len(); n != 1 {
+			t.Fatalf("Len() = %d, want 1", n)
+		}
+		objs, err := d.PopBatch(context.Background(), 2, time.Millisecond)
+		if err != nil || len(objs) != 1 {
+			t.Fatalf("PopBatch() = %v, %v", objs, err)
+		}
+		if err := d.ReQueueWithError(objs[0], Permanent(errors.New("bad"))); !errors.Is(err, ErrPermanent) {
+			t.Fatalf("ReQueueWithError() = %v, want ErrPermanent", err)
+		}
+		if d.DeadLetters() != wq.DeadLetters() || len(d.DeadLetters().List()) != 1 {
+			t.Fatal("dead letters are not forwarded")
+		}
+	})
+
+	t.Run("queue without optional capabilities", func(t *testing.T) {
+		wq := NewQueue(3)
+		defer wq.Close()
+		m := &minimalQueue{Queue: wq}
+		d := Decorator{Queue: m}
+
+		d.Push(QueueObject{Key: "a"})
+		if n := d.Len(); n != 0 {
+			t.Fatalf("Len() = %d, want 0 for a queue without Len", n)
+		}
+		if _, err := d.PopBatch(context.Background(), 2, time.Millisecond); !errors.Is(err, ErrNotSupported) {
+			t.Fatalf("PopBatch() = %v, want ErrNotSupported", err)
+		}
+		if err := d.Replay("1"); !errors.Is(err, ErrNotSupported) {
+			t.Fatalf("Replay() = %v, want ErrNotSupported", err)
+		}
+		if d.DeadLetters() != nil {
+			t.Fatal("DeadLetters() is not nil")
+		}
+
+		obj, _ := d.Pop()
+		if err := d.ReQueueWithError(obj, errors.New("failed")); err != nil || m.requeued != 1 {
+			t.Fatalf("ReQueueWithError() = %v with %d requeues, want a fallback to ReQueue", err, m.requeued)
+		}
+		obj, _ = d.Pop()
+		d.FinishBatch([]QueueObject{obj})
+	})
+}
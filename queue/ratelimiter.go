@@ -0,0 +1,60 @@
+package queue
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/time/rate"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// 限速器类型，只作用于 ReQueue，Push 新事件不做限速
+const (
+	RateLimiterDefault     = "default"     // workqueue.DefaultItemBasedRateLimiter
+	RateLimiterExponential = "exponential" // 按对象指数退避
+	RateLimiterBucket      = "bucket"      // 全局令牌桶
+	RateLimiterMaxOf       = "maxOf"       // 指数退避与令牌桶取最大值，即 workqueue.DefaultControllerRateLimiter
+)
+
+// RateLimiterConfig 限速器配置
+type RateLimiterConfig struct {
+	Type      string        `json:"type" yaml:"type"`
+	BaseDelay time.Duration `json:"baseDelay" yaml:"baseDelay"` // 指数退避初始延迟，默认 5ms
+	MaxDelay  time.Duration `json:"maxDelay" yaml:"maxDelay"`   // 指数退避最大延迟，默认 1000s
+	QPS       float64       `json:"qps" yaml:"qps"`             // 令牌桶每秒令牌数，默认 10
+	Burst     int           `json:"burst" yaml:"burst"`         // 令牌桶容量，默认 100
+}
+
+// NewRateLimiter 根据配置创建限速器，未配置类型时使用 workqueue.DefaultItemBasedRateLimiter
+func (c RateLimiterConfig) NewRateLimiter() (workqueue.RateLimiter, error) {
+	baseDelay, maxDelay := c.BaseDelay, c.MaxDelay
+	if baseDelay <= 0 {
+		baseDelay = 5 * time.Millisecond
+	}
+	if maxDelay <= 0 {
+		maxDelay = 1000 * time.Second
+	}
+	qps, burst := c.QPS, c.Burst
+	if qps <= 0 {
+		qps = 10
+	}
+	if burst <= 0 {
+		burst = 100
+	}
+
+	switch c.Type {
+	case "", RateLimiterDefault:
+		return workqueue.DefaultItemBasedRateLimiter(), nil
+	case RateLimiterExponential:
+		return workqueue.NewItemExponentialFailureRateLimiter(baseDelay, maxDelay), nil
+	case RateLimiterBucket:
+		return &workqueue.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Limit(qps), burst)}, nil
+	case RateLimiterMaxOf:
+		return workqueue.NewMaxOfRateLimiter(
+			workqueue.NewItemExponentialFailureRateLimiter(baseDelay, maxDelay),
+			&workqueue.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Limit(qps), burst)},
+		), nil
+	}
+
+	return nil, fmt.Errorf("unknown rate limiter type: %s", c.Type)
+}
@@ -0,0 +1,69 @@
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func TestNewRateLimiter(t *testing.T) {
+	tests := []struct {
+		name   string
+		config RateLimiterConfig
+		delays []time.Duration // 同一对象连续 When 的结果，nil 表示不检查
+		check  func(t *testing.T, r workqueue.RateLimiter)
+	}{
+		{"empty type", RateLimiterConfig{}, []time.Duration{time.Millisecond, 2 * time.Millisecond}, func(t *testing.T, r workqueue.RateLimiter) {
+			if _, ok := r.(*workqueue.ItemExponentialFailureRateLimiter); !ok {
+				t.Fatalf("got %T, want the default item based rate limiter", r)
+			}
+		}},
+		{"default", RateLimiterConfig{Type: RateLimiterDefault}, []time.Duration{time.Millisecond}, nil},
+		{"exponential defaults", RateLimiterConfig{Type: RateLimiterExponential}, []time.Duration{5 * time.Millisecond, 10 * time.Millisecond, 20 * time.Millisecond}, nil},
+		{"exponential", RateLimiterConfig{Type: RateLimiterExponential, BaseDelay: time.Second, MaxDelay: 3 * time.Second}, []time.Duration{time.Second, 2 * time.Second, 3 * time.Second}, nil},
+		{"bucket", RateLimiterConfig{Type: RateLimiterBucket, QPS: 5, Burst: 2}, nil, func(t *testing.T, r workqueue.RateLimiter) {
+			b, ok := r.(*workqueue.BucketRateLimiter)
+			if !ok {
+				t.Fatalf("got %T, want a bucket rate limiter", r)
+			}
+			if b.Limit() != rate.Limit(5) || b.Burst() != 2 {
+				t.Fatalf("limit %v burst %d, want 5 and 2", b.Limit(), b.Burst())
+			}
+		}},
+		{"bucket defaults", RateLimiterConfig{Type: RateLimiterBucket}, nil, func(t *testing.T, r workqueue.RateLimiter) {
+			b := r.(*workqueue.BucketRateLimiter)
+			if b.Limit() != rate.Limit(10) || b.Burst() != 100 {
+				t.Fatalf("limit %v burst %d, want 10 and 100", b.Limit(), b.Burst())
+			}
+		}},
+		{"max of", RateLimiterConfig{Type: RateLimiterMaxOf, BaseDelay: time.Second}, []time.Duration{time.Second, 2 * time.Second}, func(t *testing.T, r workqueue.RateLimiter) {
+			if _, ok := r.(*workqueue.MaxOfRateLimiter); !ok {
+				t.Fatalf("got %T, want a max of rate limiter", r)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := tt.config.NewRateLimiter()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, want := range tt.delays {
+				if got := r.When("a"); got != want {
+					t.Fatalf("delay %d = %v, want %v", i, got, want)
+				}
+			}
+			if tt.check != nil {
+				tt.check(t, r)
+			}
+		})
+	}
+}
+
+func TestNewRateLimiterUnknownType(t *testing.T) {
+	if r, err := (RateLimiterConfig{Type: "leaky"}).NewRateLimiter(); err == nil {
+		t.Fatalf("got %T, want an error for an unknown type", r)
+	}
+}
@@ -0,0 +1,198 @@
+package queue
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// wal 记录的操作类型
+const (
+	walPush    = "push"
+	walReQueue = "requeue"
+	walFinish  = "finish"
+)
+
+const walSegmentPrefix = "wal-"
+
+// walRecord 写入磁盘的一条记录，每行一个 JSON
+type walRecord struct {
+	Op       string     `json:"op"`
+	ID       uint64     `json:"id"`
+	Object   *walObject `json:"object,omitempty"`
+	Attempts int        `json:"attempts,omitempty"`
+}
+
+// walObject 持久化的 QueueObject，Obj 保存为资源对象的 JSON
+type walObject struct {
+	ClusterName  string          `json:"clusterName"`
+	Event        string          `json:"event"`
+	ResourceType string          `json:"resourceType"`
+	Key          string          `json:"key"`
+	CreateAt     time.Time       `json:"createAt"`
+	Obj          json.RawMessage `json:"obj,omitempty"`
+	Diff         string          `json:"diff,omitempty"`
+}
+
+// wal 按段写入的追加日志，文件名为 wal-<序号>.log
+// 当前段超过 limit 后，将仍未完成的记录写入新段，并删除旧段（压缩）
+// limit 为 segmentSize 与压缩后大小的 2 倍中较大的一个，未完成的记录本身超过 segmentSize 时不会每次写入都压缩
+type wal struct {
+	dir         string
+	segmentSize int64
+	sync        bool
+
+	seq   uint64
+	file  *os.File
+	size  int64
+	limit int64
+}
+
+func openWal(dir string, segmentSize int64, sync bool) (*wal, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &wal{dir: dir, segmentSize: segmentSize, sync: sync, limit: segmentSize}, nil
+}
+
+// segments 按序号排序的所有段
+func (w *wal) segments() ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(w.dir, walSegmentPrefix+"*.log"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+// load 读取所有段，返回仍未完成的记录与最大id
+// 进程崩溃时最后一行可能不完整，直接忽略
+func (w *wal) load() (map[uint64]*walRecord, uint64, error) {
+	segments, err := w.segments()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	live := make(map[uint64]*walRecord)
+	var maxID uint64
+	for _, segment := range segments {
+		var seq uint64
+		if _, err := fmt.Sscanf(strings.TrimPrefix(filepath.Base(segment), walSegmentPrefix), "%016d.log", &seq); err == nil && seq > w.seq {
+			w.seq = seq
+		}
+
+		f, err := os.Open(segment)
+		if err != nil {
+			return nil, 0, err
+		}
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+		for scanner.Scan() {
+			record := &walRecord{}
+			if err := json.Unmarshal(scanner.Bytes(), record); err != nil {
+				continue
+			}
+			if record.ID > maxID {
+				maxID = record.ID
+			}
+			switch record.Op {
+			case walPush:
+				live[record.ID] = record
+			case walReQueue:
+				if r, ok := live[record.ID]; ok {
+					r.Attempts = record.Attempts
+				}
+			case walFinish:
+				delete(live, record.ID)
+			}
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	return live, maxID, nil
+}
+
+// append 写入一条记录
+func (w *wal) append(record *walRecord) error {
+	b, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+
+	n, err := w.file.Write(b)
+	w.size += int64(n)
+	if err != nil {
+		return err
+	}
+	if w.sync {
+		return w.file.Sync()
+	}
+	return nil
+}
+
+// full 当前段是否需要压缩
+func (w *wal) full() bool {
+	return w.limit > 0 && w.size >= w.limit
+}
+
+// compact 新建一个段，写入所有未完成的记录，再删除旧段
+func (w *wal) compact(live map[uint64]*walRecord) error {
+	old, err := w.segments()
+	if err != nil {
+		return err
+	}
+
+	w.seq++
+	name := filepath.Join(w.dir, fmt.Sprintf("%s%016d.log", walSegmentPrefix, w.seq))
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	if w.file != nil {
+		w.file.Close()
+	}
+	w.file, w.size = f, 0
+
+	ids := make([]uint64, 0, len(live))
+	for id := range live {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		record := *live[id]
+		record.Op = walPush
+		if err := w.append(&record); err != nil {
+			return err
+		}
+	}
+	// 新段落盘后才能删除旧段
+	if err := w.file.Sync(); err != nil {
+		return err
+	}
+
+	for _, segment := range old {
+		if err := os.Remove(segment); err != nil {
+			return err
+		}
+	}
+	if w.segmentSize > 0 {
+		w.limit = max(w.segmentSize, 2*w.size)
+	}
+	return nil
+}
+
+func (w *wal) close() error {
+	if w.file == nil {
+		return nil
+	}
+	return w.file.Close()
+}
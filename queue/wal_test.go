@@ -0,0 +1,194 @@
+package queue
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWalLoad(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		live  map[uint64]int // id -> attempts
+		maxID uint64
+	}{
+		{
+			name: "push requeue finish",
+			lines: []string{
+				`{"op":"push","id":1,"object":{"key":"a"}}`,
+				`{"op":"push","id":2,"object":{"key":"b"}}`,
+				`{"op":"requeue","id":1,"attempts":2}`,
+				`{"op":"finish","id":2}`,
+			},
+			live:  map[uint64]int{1: 2},
+			maxID: 2,
+		},
+		{
+			name: "truncated last line",
+			lines: []string{
+				`{"op":"push","id":1,"object":{"key":"a"}}`,
+				`{"op":"push","id":2,"obj`,
+			},
+			live:  map[uint64]int{1: 0},
+			maxID: 1,
+		},
+		{
+			name: "finished ids still count for max id",
+			lines: []string{
+				`{"op":"push","id":7,"object":{"key":"a"}}`,
+				`{"op":"finish","id":7}`,
+			},
+			live:  map[uint64]int{},
+			maxID: 7,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			content := strings.Join(tt.lines, "\n")
+			if err := os.WriteFile(filepath.Join(dir, walSegmentPrefix+"0000000000000001.log"), []byte(content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			w, err := openWal(dir, DefaultSegmentSize, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			live, maxID, err := w.load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if maxID != tt.maxID {
+				t.Errorf("maxID = %d, want %d", maxID, tt.maxID)
+			}
+			if len(live) != len(tt.live) {
+				t.Fatalf("%d live records, want %d", len(live), len(tt.live))
+			}
+			for id, attempts := range tt.live {
+				if r, ok := live[id]; !ok || r.Attempts != attempts {
+					t.Errorf("record %d = %+v, want attempts %d", id, r, attempts)
+				}
+			}
+		})
+	}
+}
+
+// 未完成的记录超过 segmentSize 时，压缩后按 2 倍大小计算下一次压缩，不会每次写入都压缩
+func TestWalCompactLimit(t *testing.T) {
+	w, err := openWal(t.TempDir(), 1024, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	live := make(map[uint64]*walRecord)
+	if err := w.compact(live); err != nil {
+		t.Fatal(err)
+	}
+	defer w.close()
+
+	compactions := 0
+	for id := uint64(1); id <= 500; id++ {
+		record := &walRecord{Op: walPush, ID: id, Object: &walObject{Key: "default/object"}}
+		live[id] = record
+		if err := w.append(record); err != nil {
+			t.Fatal(err)
+		}
+		if w.full() {
+			compactions++
+			if err := w.compact(live); err != nil {
+				t.Fatal(err)
+			}
+			if w.limit < 2*w.size {
+				t.Fatalf("limit %d is less than twice the compacted size %d", w.limit, w.size)
+			}
+		}
+	}
+	// 每次压缩后大小至少翻倍，500 条记录只需要压缩几次
+	if compactions == 0 || compactions > 10 {
+		t.Fatalf("%d compactions for 500 live records", compactions)
+	}
+	segments, _ := w.segments()
+	if len(segments) != 1 {
+		t.Fatalf("%d segments after compaction, want 1", len(segments))
+	}
+}
+
+func TestPersistentQueueReplay(t *testing.T) {
+	dir := t.TempDir()
+	config := PersistenceConfig{Dir: dir}
+
+	q, err := NewPersistentQueue(NewQueue(3), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	q.Push(QueueObject{Key: "default/a", Event: "add", CreateAt: now})
+	q.Push(QueueObject{Key: "default/b", Event: "add", CreateAt: now})
+	a, _ := q.Pop()
+	b, _ := q.Pop()
+	if err := q.ReQueueWithError(a, errors.New("failed")); err != nil {
+		t.Fatal(err)
+	}
+	q.Finish(b)
+	q.Close()
+
+	q, err = NewPersistentQueue(NewQueue(3), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	if n := q.Len(); n != 1 {
+		t.Fatalf("replayed %d objects, want 1", n)
+	}
+	obj, err := q.Pop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obj.Key != "default/a" || obj.Attempts != 1 {
+		t.Fatalf("replayed %s with %d attempts, want default/a with 1", obj.Key, obj.Attempts)
+	}
+}
+
+// wal 写入失败时压缩重写，压缩也失败时 Err 返回错误，之后压缩成功时恢复
+func TestPersistentQueueWalError(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "wal")
+	q, err := NewPersistentQueue(NewQueue(3), PersistenceConfig{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	// 当前段被关闭，写入失败后压缩到新段
+	q.wal.file.Close()
+	q.Push(QueueObject{Key: "default/a", CreateAt: time.Now()})
+	if err := q.Err(); err != nil {
+		t.Fatalf("Err() = %v after a successful compaction", err)
+	}
+
+	// 目录被删除，压缩也失败
+	q.wal.file.Close()
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	q.Push(QueueObject{Key: "default/b", CreateAt: time.Now()})
+	if q.Err() == nil {
+		t.Fatal("Err() = nil after the wal became unwritable")
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	q.Push(QueueObject{Key: "default/c", CreateAt: time.Now()})
+	if err := q.Err(); err != nil {
+		t.Fatalf("Err() = %v after the wal became writable again", err)
+	}
+	live, _, err := q.wal.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(live) != 3 {
+		t.Fatalf("%d records in the wal after recovery, want 3", len(live))
+	}
+}
@@ -0,0 +1,22 @@
+package resource
+
+import (
+	"slices"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// Match list 为空表示不限制，否则 s 需要在 list 中
+func Match(list []string, s string) bool {
+	return len(list) == 0 || slices.Contains(list, s)
+}
+
+// ToUnstructured 将资源对象转换为 map，兼容删除事件中的 cache.DeletedFinalStateUnknown
+func ToUnstructured(obj interface{}) (map[string]interface{}, error) {
+	obj = Unwrap(obj)
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		return u.Object, nil
+	}
+	return runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+}
@@ -0,0 +1,70 @@
+package resource
+
+import (
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/cache"
+)
+
+// NewObject 根据资源类型返回对应的空对象，用于反序列化，未知类型返回 unstructured
+func NewObject(rType string) runtime.Object {
+	switch rType {
+	case Pods:
+		return &v1.Pod{}
+	case Services:
+		return &v1.Service{}
+	case ConfigMaps:
+		return &v1.ConfigMap{}
+	case Secrets:
+		return &v1.Secret{}
+	case Events:
+		return &v1.Event{}
+	case Deployments:
+		return &appsv1.Deployment{}
+	case Statefulsets:
+		return &appsv1.StatefulSet{}
+	case Daemonsets:
+		return &appsv1.DaemonSet{}
+	}
+	return &unstructured.Unstructured{}
+}
+
+// TypeOf 根据对象类型返回资源类型，与 NewObject 相反，未知类型返回空字符串
+func TypeOf(obj interface{}) string {
+	switch Unwrap(obj).(type) {
+	case *v1.Pod:
+		return Pods
+	case *v1.Service:
+		return Services
+	case *v1.ConfigMap:
+		return ConfigMaps
+	case *v1.Secret:
+		return Secrets
+	case *v1.Event:
+		return Events
+	case *appsv1.Deployment:
+		return Deployments
+	case *appsv1.StatefulSet:
+		return Statefulsets
+	case *appsv1.DaemonSet:
+		return Daemonsets
+	}
+	return ""
+}
+
+// Accessor 返回资源对象的 metadata，兼容删除事件中的 cache.DeletedFinalStateUnknown
+func Accessor(obj interface{}) (metav1.Object, error) {
+	return meta.Accessor(Unwrap(obj))
+}
+
+// Unwrap 删除事件中的 cache.DeletedFinalStateUnknown 返回其中的对象
+func Unwrap(obj interface{}) interface{} {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		return tombstone.Obj
+	}
+	return obj
+}
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"net/http"
+	"sort"
+
+	"multiple-k8s-informer/resource"
+	"multiple-k8s-informer/store"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Item 带集群名称的资源对象
+type Item struct {
+	Cluster string      `json:"cluster"`
+	Object  interface{} `json:"object"`
+}
+
+// ItemList 资源对象列表
+type ItemList struct {
+	Items []Item `json:"items"`
+}
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// registerAPI 只读 REST API
+//
+//	GET /clusters                                            集群列表
+//	GET /clusters/{cluster}/{resource}?labelSelector=        集群中的资源对象
+//	GET /clusters/{cluster}/{resource}/{namespace}/{name}    单个资源对象
+//	GET /resources/{resource}?labelSelector=                 所有集群中的资源对象
+func (s *Server) registerAPI() {
+	s.HandleFunc("GET /clusters", s.listClusters)
+	s.HandleFunc("GET /clusters/{cluster}/{resource}", s.listClusterResources)
+	s.HandleFunc("GET /clusters/{cluster}/{resource}/{namespace}/{name}", s.getClusterResource)
+	s.HandleFunc("GET /resources/{resource}", s.listResources)
+}
+
+func (s *Server) listClusters(w http.ResponseWriter, r *http.Request) {
+	cs := s.informer.ClusterStore()
+	if cs == nil {
+		writeJSON(w, http.StatusNotImplemented, apiError{"store is not cluster aware"})
+		return
+	}
+	writeJSON(w, http.StatusOK, cs.Clusters())
+}
+
+func (s *Server) listClusterResources(w http.ResponseWriter, r *http.Request) {
+	cs, selector, ok := s.prepare(w, r)
+	if !ok {
+		return
+	}
+	cluster := r.PathValue("cluster")
+	if !hasCluster(cs.Clusters(), cluster) {
+		writeJSON(w, http.StatusNotFound, apiError{"cluster " + cluster + " not found"})
+		return
+	}
+
+	list := ItemList{Items: []Item{}}
+	list.Items = s.appendItems(list.Items, cluster, cs.ListByCluster(cluster, r.PathValue("resource")), selector)
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (s *Server) getClusterResource(w http.ResponseWriter, r *http.Request) {
+	cs, _, ok := s.prepare(w, r)
+	if !ok {
+		return
+	}
+
+	key := r.PathValue("namespace") + "/" + r.PathValue("name")
+	obj, exists := cs.GetByClusterKey(r.PathValue("cluster"), r.PathValue("resource"), key)
+	if !exists {
+		writeJSON(w, http.StatusNotFound, apiError{key + " not found"})
+		return
+	}
+	if !s.exposed(obj) {
+		writeJSON(w, http.StatusForbidden, apiError{"secrets are not exposed, see server.exposeSecrets"})
+		return
+	}
+	writeJSON(w, http.StatusOK, obj)
+}
+
+func (s *Server) listResources(w http.ResponseWriter, r *http.Request) {
+	cs, selector, ok := s.prepare(w, r)
+	if !ok {
+		return
+	}
+
+	list := ItemList{Items: []Item{}}
+	for _, cluster := range cs.Clusters() {
+		list.Items = s.appendItems(list.Items, cluster, cs.ListByCluster(cluster, r.PathValue("resource")), selector)
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// prepare 检查 store、资源类型与 labelSelector
+func (s *Server) prepare(w http.ResponseWriter, r *http.Request) (cs store.ClusterStore, selector labels.Selector, ok bool) {
+	cs = s.informer.ClusterStore()
+	if cs == nil {
+		writeJSON(w, http.StatusNotImplemented, apiError{"store is not cluster aware"})
+		return nil, nil, false
+	}
+	if r.PathValue("resource") == resource.Secrets && !s.config.ExposeSecrets {
+		writeJSON(w, http.StatusForbidden, apiError{"secrets are not exposed, see server.exposeSecrets"})
+		return nil, nil, false
+	}
+
+	selector, err := labels.Parse(r.URL.Query().Get("labelSelector"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, apiError{err.Error()})
+		return nil, nil, false
+	}
+	return cs, selector, true
+}
+
+// exposed 未开启 exposeSecrets 时不返回 secret，resource 为 all 时也会列出 secret，需要逐个对象检查
+func (s *Server) exposed(obj interface{}) bool {
+	return s.config.ExposeSecrets || resource.TypeOf(obj) != resource.Secrets
+}
+
+func (s *Server) appendItems(items []Item, cluster string, objs []interface{}, selector labels.Selector) []Item {
+	matched := make([]Item, 0, len(objs))
+	for _, obj := range objs {
+		if !s.exposed(obj) {
+			continue
+		}
+		if !selector.Empty() {
+			accessor, err := meta.Accessor(obj)
+			if err != nil || !selector.Matches(labels.Set(accessor.GetLabels())) {
+				continue
+			}
+		}
+		matched = append(matched, Item{Cluster: cluster, Object: obj})
+	}
+	// indexer 中的对象无序，按 namespace/name 排序保证输出稳定
+	sort.Slice(matched, func(i, j int) bool {
+		return objectKey(matched[i].Object) < objectKey(matched[j].Object)
+	})
+	return append(items, matched...)
+}
+
+func objectKey(obj interface{}) string {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return ""
+	}
+	return accessor.GetNamespace() + "/" + accessor.GetName()
+}
+
+func hasCluster(clusters []string, cluster string) bool {
+	for _, c := range clusters {
+		if c == cluster {
+			return true
+		}
+	}
+	return false
+}
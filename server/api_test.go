@@ -0,0 +1,88 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"multiple-k8s-informer/controller"
+	"multiple-k8s-informer/queue"
+	"multiple-k8s-informer/resource"
+	"multiple-k8s-informer/store"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func newTestInformer(t *testing.T) *controller.Controller {
+	t.Helper()
+	cs := store.ClusterIndexers{}
+	add := func(rType string, obj interface{}) {
+		indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+		if err := indexer.Add(obj); err != nil {
+			t.Fatal(err)
+		}
+		cs.Add("c1", rType, indexer)
+	}
+	add(resource.Pods, &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"}})
+	add(resource.Secrets, &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "token", Namespace: "default"},
+		Data:       map[string][]byte{"password": []byte("hunter2")},
+	})
+	return &controller.Controller{Queue: queue.NewQueue(1), Store: cs}
+}
+
+func TestAPISecrets(t *testing.T) {
+	informer := newTestInformer(t)
+
+	tests := []struct {
+		path          string
+		exposeSecrets bool
+		code          int
+		items         int // 列表接口返回的对象数量，-1 表示不是列表
+	}{
+		{"/resources/all", false, http.StatusOK, 1},
+		{"/clusters/c1/all", false, http.StatusOK, 1},
+		{"/resources/secrets", false, http.StatusForbidden, -1},
+		{"/clusters/c1/secrets", false, http.StatusForbidden, -1},
+		{"/clusters/c1/all/default/token", false, http.StatusForbidden, -1},
+		{"/clusters/c1/all/default/web", false, http.StatusOK, -1},
+		{"/resources/all", true, http.StatusOK, 2},
+		{"/clusters/c1/secrets", true, http.StatusOK, 1},
+		{"/clusters/c1/all/default/token", true, http.StatusOK, -1},
+	}
+	for _, tt := range tests {
+		s := NewServer(Config{API: true, ExposeSecrets: tt.exposeSecrets}, informer)
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+		if w.Code != tt.code {
+			t.Errorf("%s exposeSecrets=%v: code = %d, want %d", tt.path, tt.exposeSecrets, w.Code, tt.code)
+			continue
+		}
+		if tt.items < 0 {
+			continue
+		}
+		var list struct {
+			Items []struct {
+				Object map[string]interface{} `json:"object"`
+			} `json:"items"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+			t.Fatalf("%s: %v", tt.path, err)
+		}
+		if len(list.Items) != tt.items {
+			t.Errorf("%s exposeSecrets=%v: %d items, want %d", tt.path, tt.exposeSecrets, len(list.Items), tt.items)
+		}
+		if tt.exposeSecrets {
+			continue
+		}
+		for _, item := range list.Items {
+			if _, ok := item.Object["data"]; ok {
+				t.Errorf("%s: secret returned while exposeSecrets is false: %v", tt.path, item.Object)
+			}
+		}
+	}
+}
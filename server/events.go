@@ -0,0 +1,98 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"multiple-k8s-informer/resource"
+	"multiple-k8s-informer/stream"
+)
+
+// heartbeatInterval SSE 心跳间隔，避免代理断开空闲连接
+const heartbeatInterval = 15 * time.Second
+
+// events Server-Sent Events 推送 informer 放入队列的对象
+//
+//	GET /events?cluster=&resource=&event=&namespace=&object=true
+//
+// 过滤参数可重复或用逗号分隔，object=true 时带完整对象
+// 未开启 exposeSecrets 时不推送 secrets
+// 每个客户端有独立的缓冲区，消费过慢时服务端断开连接，不会阻塞主队列
+func (s *Server) events(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSON(w, http.StatusInternalServerError, apiError{"streaming unsupported"})
+		return
+	}
+
+	query := r.URL.Query()
+	filter := stream.Filter{
+		Clusters:   queryValues(query["cluster"]),
+		Resources:  queryValues(query["resource"]),
+		Events:     queryValues(query["event"]),
+		Namespaces: queryValues(query["namespace"]),
+	}
+	withObject := query.Get("object") == "true"
+	if !s.config.ExposeSecrets {
+		for _, rType := range filter.Resources {
+			if rType == resource.Secrets {
+				writeJSON(w, http.StatusForbidden, apiError{"secrets are not exposed, see server.exposeSecrets"})
+				return
+			}
+		}
+		filter.Exclude = []string{resource.Secrets}
+	}
+
+	sub := s.informer.Subscribe(filter, s.config.StreamBuffer)
+	defer s.informer.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			_, _ = fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		case obj, ok := <-sub.C:
+			if !ok {
+				if sub.Dropped() {
+					_, _ = fmt.Fprint(w, "event: error\ndata: slow consumer, disconnected\n\n")
+					flusher.Flush()
+				}
+				return
+			}
+			b, err := json.Marshal(stream.NewEvent(obj, withObject))
+			if err != nil {
+				continue
+			}
+			if _, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", obj.Event, b); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// queryValues 支持 ?a=1&a=2 与 ?a=1,2
+func queryValues(values []string) (result []string) {
+	for _, value := range values {
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				result = append(result, v)
+			}
+		}
+	}
+	return
+}
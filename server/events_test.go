@@ -0,0 +1,65 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"multiple-k8s-informer/queue"
+	"multiple-k8s-informer/resource"
+	"multiple-k8s-informer/stream"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestEventsSecrets(t *testing.T) {
+	informer := newTestInformer(t)
+	informer.Broadcaster = stream.NewBroadcaster()
+	ts := httptest.NewServer(NewServer(Config{Stream: true}, informer))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/events?resource=secrets&object=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("resource=secrets: code = %d, want %d", resp.StatusCode, http.StatusForbidden)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/events?object=true", nil)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	// 响应头返回时已经订阅
+	informer.Broadcaster.Publish(queue.QueueObject{
+		ClusterName: "c1", ResourceType: resource.Secrets, Event: resource.EventAdd, Key: "default/token",
+		Obj: &v1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "token", Namespace: "default"}, Data: map[string][]byte{"password": []byte("hunter2")}},
+	})
+	informer.Broadcaster.Publish(queue.QueueObject{
+		ClusterName: "c1", ResourceType: resource.Pods, Event: resource.EventAdd, Key: "default/web",
+		Obj: &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"}},
+	})
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+		if !strings.Contains(line, `"resource":"pods"`) {
+			t.Fatalf("first event is not the pod: %s", line)
+		}
+		return
+	}
+	t.Fatal("no event received: ", scanner.Err())
+}
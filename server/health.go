@@ -0,0 +1,47 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// HealthConfig 健康检查配置，0 表示不检查
+type HealthConfig struct {
+	QueueStallTimeout   time.Duration `json:"queueStallTimeout" yaml:"queueStallTimeout"`     // 队列有对象但超过该时间没有出队，/healthz 失败
+	WatchFailureTimeout time.Duration `json:"watchFailureTimeout" yaml:"watchFailureTimeout"` // 集群 list/watch 连续失败超过该时间，/healthz 失败
+}
+
+// healthz 存活检查
+func (s *Server) healthz(w http.ResponseWriter, r *http.Request) {
+	err := s.informer.Healthy(s.config.Health.QueueStallTimeout, s.config.Health.WatchFailureTimeout)
+	writeCheck(w, err)
+}
+
+// readyz 就绪检查，所有 informer 都已同步
+func (s *Server) readyz(w http.ResponseWriter, r *http.Request) {
+	writeCheck(w, s.informer.Ready())
+}
+
+// debugClusters 每个集群的连接状态、最近事件时间与缓存对象数量
+func (s *Server) debugClusters(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.informer.ClusterStatuses())
+}
+
+func writeCheck(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte(err.Error() + "\n"))
+		return
+	}
+	_, _ = w.Write([]byte("ok\n"))
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
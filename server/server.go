@@ -0,0 +1,84 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"multiple-k8s-informer/controller"
+	"multiple-k8s-informer/metrics"
+
+	"k8s.io/klog"
+)
+
+// Config 内置 http 服务配置
+type Config struct {
+	Enabled bool         `json:"enabled" yaml:"enabled"`
+	Addr    string       `json:"addr" yaml:"addr"`       // 监听地址，默认 :8080
+	Metrics bool         `json:"metrics" yaml:"metrics"` // 是否暴露 /metrics
+	Health  HealthConfig `json:"health" yaml:"health"`   // /healthz /readyz
+
+	API           bool `json:"api" yaml:"api"`                     // 是否开启只读 REST API：/clusters /resources
+	ExposeSecrets bool `json:"exposeSecrets" yaml:"exposeSecrets"` // REST API 与 /events 是否返回 secrets
+	EventSummary  bool `json:"eventSummary" yaml:"eventSummary"`   // 是否开启 /events/summary：按 involvedObject、reason 聚合的 Event
+
+	Stream       bool `json:"stream" yaml:"stream"`             // 是否开启 /events 事件推送(SSE)
+	StreamBuffer int  `json:"streamBuffer" yaml:"streamBuffer"` // 每个客户端的缓冲区大小，满了断开，默认 256
+}
+
+// Server 内置 http 服务，按配置注册 /metrics、/healthz 等路由
+type Server struct {
+	*http.ServeMux
+	srv      *http.Server
+	config   Config
+	informer controller.MultiClusterInformer
+}
+
+func NewServer(config Config, informer controller.MultiClusterInformer) *Server {
+	if config.Addr == "" {
+		config.Addr = ":8080"
+	}
+
+	mux := http.NewServeMux()
+	s := &Server{
+		ServeMux: mux,
+		srv:      &http.Server{Addr: config.Addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second},
+		config:   config,
+		informer: informer,
+	}
+
+	if config.Metrics {
+		mux.Handle("/metrics", metrics.Handler())
+	}
+	mux.HandleFunc("/healthz", s.healthz)
+	mux.HandleFunc("/readyz", s.readyz)
+	mux.HandleFunc("/debug/clusters", s.debugClusters)
+	if config.API {
+		s.registerAPI()
+	}
+	if config.EventSummary {
+		mux.HandleFunc("GET /events/summary", s.eventSummary)
+	}
+	if config.Stream {
+		mux.HandleFunc("GET /events", s.events)
+	}
+
+	return s
+}
+
+// Run 启动 http 服务，阻塞直到服务关闭
+func (s *Server) Run() {
+	klog.Info("run http server on ", s.srv.Addr)
+	if err := s.srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		klog.Error("http server error: ", err)
+	}
+}
+
+// Stop 关闭 http 服务
+func (s *Server) Stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.srv.Shutdown(ctx); err != nil {
+		klog.Error("http server shutdown error: ", err)
+	}
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"multiple-k8s-informer/aggregate"
+)
+
+// GroupList Event 聚合结果
+type GroupList struct {
+	Items []aggregate.Group `json:"items"`
+}
+
+// eventSummary 对 Store 中的 Event 按集群、involvedObject、reason 聚合
+//
+//	GET /events/summary?cluster=&namespace=&kind=&name=&reason=&type=Warning&since=1h&sort=count|lastSeen&limit=100
+//
+// 过滤参数可重复或用逗号分隔，since 为相对现在的时间，只统计该时间内出现过的 Event
+func (s *Server) eventSummary(w http.ResponseWriter, r *http.Request) {
+	cs := s.informer.ClusterStore()
+	if cs == nil {
+		writeJSON(w, http.StatusNotImplemented, apiError{"store is not cluster aware"})
+		return
+	}
+
+	query := r.URL.Query()
+	q := aggregate.Query{
+		Clusters:   queryValues(query["cluster"]),
+		Namespaces: queryValues(query["namespace"]),
+		Kinds:      queryValues(query["kind"]),
+		Names:      queryValues(query["name"]),
+		Reasons:    queryValues(query["reason"]),
+		Types:      queryValues(query["type"]),
+		Sort:       query.Get("sort"),
+	}
+	if since := query.Get("since"); since != "" {
+		d, err := time.ParseDuration(since)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, apiError{"invalid since: " + err.Error()})
+			return
+		}
+		q.Since = time.Now().Add(-d)
+	}
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 0 {
+			writeJSON(w, http.StatusBadRequest, apiError{"invalid limit " + limit})
+			return
+		}
+		q.Limit = n
+	}
+	if q.Sort != "" && q.Sort != aggregate.SortCount && q.Sort != aggregate.SortLastSeen {
+		writeJSON(w, http.StatusBadRequest, apiError{"sort must be count or lastSeen"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, GroupList{Items: aggregate.Summarize(cs, q)})
+}
@@ -0,0 +1,117 @@
+package sink
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"multiple-k8s-informer/queue"
+	"multiple-k8s-informer/resource"
+)
+
+// CloudEvents 1.0
+const (
+	CloudEventsSpecVersion = "1.0"
+
+	// ContentTypeCloudEvents structured 模式
+	ContentTypeCloudEvents = "application/cloudevents+json"
+	// ContentTypeCloudEventsBatch 批量 structured 模式
+	ContentTypeCloudEventsBatch = "application/cloudevents-batch+json"
+)
+
+// 输出格式
+const (
+	FormatJSON              = "json"               // stream.Event
+	FormatCloudEvents       = "cloudevents"        // CloudEvents structured 模式
+	FormatCloudEventsBinary = "cloudevents-binary" // CloudEvents binary 模式，不支持批量
+)
+
+// CloudEvent CloudEvents 1.0 信封
+//
+//	source  = 集群名称
+//	type    = <resource>.<event>，如 pods.add
+//	subject = key，如 default/nginx
+//	data    = 资源对象 JSON
+type CloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject,omitempty"`
+	Time            time.Time       `json:"time"`
+	DataContentType string          `json:"datacontenttype,omitempty"`
+	Data            json.RawMessage `json:"data,omitempty"`
+}
+
+// NewCloudEvent 将 QueueObject 转换为 CloudEvent
+// id 为 <resource>/<key>/<resourceVersion>/<event>，同一次变更多次发送时 id 相同，接收方可以据此去重
+func NewCloudEvent(obj queue.QueueObject) (CloudEvent, error) {
+	e := CloudEvent{
+		SpecVersion: CloudEventsSpecVersion,
+		Source:      obj.ClusterName,
+		Type:        obj.ResourceType + "." + obj.Event,
+		Subject:     obj.Key,
+		Time:        obj.CreateAt,
+	}
+
+	e.ID = eventID(obj)
+
+	if raw := resource.Unwrap(obj.Obj); raw != nil {
+		data, err := json.Marshal(raw)
+		if err != nil {
+			return e, err
+		}
+		e.Data = data
+		e.DataContentType = "application/json"
+	}
+	return e, nil
+}
+
+// eventID <resource>/<key>/<resourceVersion>/<event>，没有 resourceVersion 时使用入队时间
+func eventID(obj queue.QueueObject) string {
+	version := strconv.FormatInt(obj.CreateAt.UnixNano(), 10)
+	if accessor, err := resource.Accessor(obj.Obj); err == nil && accessor.GetResourceVersion() != "" {
+		version = accessor.GetResourceVersion()
+	}
+	return obj.ResourceType + "/" + obj.Key + "/" + version + "/" + obj.Event
+}
+
+// Structured structured 模式的请求体，Content-Type 为 ContentTypeCloudEvents
+func (e CloudEvent) Structured() ([]byte, error) {
+	return json.Marshal(e)
+}
+
+// Binary binary 模式，属性放在 ce- 请求头中，请求体为 data
+func (e CloudEvent) Binary() (http.Header, []byte) {
+	header := http.Header{}
+	header.Set("ce-specversion", e.SpecVersion)
+	header.Set("ce-id", encodeHeader(e.ID))
+	header.Set("ce-source", encodeHeader(e.Source))
+	header.Set("ce-type", encodeHeader(e.Type))
+	if e.Subject != "" {
+		header.Set("ce-subject", encodeHeader(e.Subject))
+	}
+	header.Set("ce-time", e.Time.UTC().Format(time.RFC3339Nano))
+	if e.DataContentType != "" {
+		header.Set("Content-Type", e.DataContentType)
+	}
+	return header, e.Data
+}
+
+// encodeHeader 按 CloudEvents HTTP binding 对请求头做百分号编码
+// 空格、双引号、百分号以及 U+0021-U+007E 之外的字符(如中文集群名)需要编码
+func encodeHeader(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c <= ' ' || c > '~' || c == '"' || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
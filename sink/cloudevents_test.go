@@ -0,0 +1,151 @@
+package sink
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"multiple-k8s-informer/queue"
+	"multiple-k8s-informer/resource"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func podObject(cluster, resourceVersion string) queue.QueueObject {
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web", ResourceVersion: resourceVersion}}
+	return queue.QueueObject{
+		ClusterName:  cluster,
+		ResourceType: resource.Pods,
+		Event:        resource.EventUpdate,
+		Key:          "default/web",
+		Obj:          pod,
+		CreateAt:     time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestNewCloudEvent(t *testing.T) {
+	e, err := NewCloudEvent(podObject("c1", "42"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := CloudEvent{
+		SpecVersion:     "1.0",
+		ID:              "pods/default/web/42/update",
+		Source:          "c1",
+		Type:            "pods.update",
+		Subject:         "default/web",
+		Time:            time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC),
+		DataContentType: "application/json",
+	}
+	got := e
+	got.Data = nil
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("NewCloudEvent() = %+v, want %+v", got, want)
+	}
+
+	var pod corev1.Pod
+	if err := json.Unmarshal(e.Data, &pod); err != nil || pod.Name != "web" {
+		t.Fatalf("data = %s, %v", e.Data, err)
+	}
+
+	// 没有对象时不带 data 和 datacontenttype
+	e, err = NewCloudEvent(auditObject("web"))
+	if err != nil || e.Data != nil || e.DataContentType != "" {
+		t.Fatalf("NewCloudEvent() without object = %+v, %v", e, err)
+	}
+}
+
+// 重试时对象不变，id 相同；新的 resourceVersion 生成新的 id
+func TestCloudEventIDStable(t *testing.T) {
+	obj := podObject("c1", "42")
+	first, _ := NewCloudEvent(obj)
+	retried, _ := NewCloudEvent(obj)
+	if first.ID != retried.ID {
+		t.Fatalf("id changed across retries: %s, %s", first.ID, retried.ID)
+	}
+
+	next, _ := NewCloudEvent(podObject("c1", "43"))
+	if next.ID == first.ID {
+		t.Fatalf("id %s is reused for a new resourceVersion", next.ID)
+	}
+
+	// 没有 resourceVersion 时使用入队时间
+	noVersion := auditObject("web")
+	noVersion.CreateAt = time.Unix(0, 1714550400000000000)
+	a, _ := NewCloudEvent(noVersion)
+	b, _ := NewCloudEvent(noVersion)
+	if a.ID != b.ID || a.ID != "pods/default/web/1714550400000000000/add" {
+		t.Fatalf("id = %s, %s", a.ID, b.ID)
+	}
+}
+
+func TestCloudEventStructured(t *testing.T) {
+	e, _ := NewCloudEvent(podObject("c1", "42"))
+	body, err := e.Structured()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got map[string]json.RawMessage
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{
+		"specversion":     `"1.0"`,
+		"id":              `"pods/default/web/42/update"`,
+		"source":          `"c1"`,
+		"type":            `"pods.update"`,
+		"subject":         `"default/web"`,
+		"time":            `"2024-05-01T08:00:00Z"`,
+		"datacontenttype": `"application/json"`,
+	} {
+		if string(got[name]) != want {
+			t.Errorf("%s = %s, want %s", name, got[name], want)
+		}
+	}
+	var pod corev1.Pod
+	if err := json.Unmarshal(got["data"], &pod); err != nil || pod.ResourceVersion != "42" {
+		t.Fatalf("data = %s, %v", got["data"], err)
+	}
+}
+
+func TestCloudEventBinary(t *testing.T) {
+	e, _ := NewCloudEvent(podObject("生产 \"集群\"", "42"))
+	header, body := e.Binary()
+
+	for name, want := range map[string]string{
+		"ce-specversion": "1.0",
+		"ce-id":          "pods/default/web/42/update",
+		"ce-source":      "%E7%94%9F%E4%BA%A7%20%22%E9%9B%86%E7%BE%A4%22",
+		"ce-type":        "pods.update",
+		"ce-subject":     "default/web",
+		"ce-time":        "2024-05-01T08:00:00Z",
+		"Content-Type":   "application/json",
+	} {
+		if got := header.Get(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	if string(body) != string(e.Data) {
+		t.Fatalf("body = %s, want data", body)
+	}
+}
+
+func TestEncodeHeader(t *testing.T) {
+	tests := map[string]string{
+		"c1":          "c1",
+		"a b":         "a%20b",
+		`"quoted"`:    "%22quoted%22",
+		"100%":        "100%25",
+		"tab\tnl\n":   "tab%09nl%0A",
+		"集群":          "%E9%9B%86%E7%BE%A4",
+		"pods.update": "pods.update",
+	}
+	for value, want := range tests {
+		if got := encodeHeader(value); got != want {
+			t.Errorf("encodeHeader(%q) = %q, want %q", value, got, want)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package sink
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"multiple-k8s-informer/queue"
+)
+
+// DefaultBatchWait 批量处理时拿到第一个对象后默认的等待时间
+const DefaultBatchWait = time.Second
+
+// BatchConfig 批量处理配置，MaxItems 大于 1 时开启
+type BatchConfig struct {
+	MaxItems int           `json:"maxItems" yaml:"maxItems"` // 每批最多的对象数
+	MaxWait  time.Duration `json:"maxWait" yaml:"maxWait"`   // 拿到第一个对象后最多等待的时间，默认 1s
+}
+
+func (c BatchConfig) Enabled() bool {
+	return c.MaxItems > 1
+}
+
+// Sink 内置 handler 的公共接口
+type Sink interface {
+	Handle(queue.QueueObject) error
+	HandleBatch([]queue.QueueObject) error
+}
+
+// Fanout 将对象交给所有加入的 sink，错误带上 sink 的名字合并后返回
+// 只有所有失败的 sink 都返回 ErrPermanent 时才不再重试；重试时已成功的 sink 会再次收到该对象
+type Fanout struct {
+	sinks []fanoutSink
+}
+
+type fanoutSink struct {
+	Sink
+	name  string
+	batch BatchConfig
+}
+
+// Add 加入 sink，batch 未开启时批量处理中逐个调用 Handle
+func (f *Fanout) Add(name string, s Sink, batch BatchConfig) {
+	f.sinks = append(f.sinks, fanoutSink{Sink: s, name: name, batch: batch})
+}
+
+// Len 加入的 sink 数量
+func (f *Fanout) Len() int {
+	return len(f.sinks)
+}
+
+// Batch 任意一个 sink 开启了批量处理时返回 true，maxItems 与 maxWait 取所有开启的 sink 中的最大值
+func (f *Fanout) Batch() (maxItems int, maxWait time.Duration, ok bool) {
+	for _, s := range f.sinks {
+		if !s.batch.Enabled() {
+			continue
+		}
+		ok = true
+		maxItems = max(maxItems, s.batch.MaxItems)
+		wait := s.batch.MaxWait
+		if wait <= 0 {
+			wait = DefaultBatchWait
+		}
+		maxWait = max(maxWait, wait)
+	}
+	return
+}
+
+// Handle 实现 controller.HandleFunc
+func (f *Fanout) Handle(obj queue.QueueObject) error {
+	var errs []error
+	for _, s := range f.sinks {
+		if err := s.Handle(obj); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", s.name, err))
+		}
+	}
+	return joinErrors(errs)
+}
+
+// HandleBatch 实现 controller.BatchHandleFunc，开启批量的 sink 按各自的 MaxItems 分批，部分失败时返回 queue.BatchError
+func (f *Fanout) HandleBatch(objs []queue.QueueObject) error {
+	perObject := make([][]error, len(objs))
+	for _, s := range f.sinks {
+		for i, err := range s.handleBatch(objs) {
+			if err != nil {
+				perObject[i] = append(perObject[i], fmt.Errorf("%s: %w", s.name, err))
+			}
+		}
+	}
+
+	errs := make([]error, len(objs))
+	for i := range objs {
+		errs[i] = joinErrors(perObject[i])
+	}
+	return batchError(errs)
+}
+
+// handleBatch 返回每个对象的错误
+func (s fanoutSink) handleBatch(objs []queue.QueueObject) []error {
+	errs := make([]error, len(objs))
+	if !s.batch.Enabled() {
+		for i, obj := range objs {
+			errs[i] = s.Handle(obj)
+		}
+		return errs
+	}
+
+	for start := 0; start < len(objs); start += s.batch.MaxItems {
+		end := min(start+s.batch.MaxItems, len(objs))
+		err := s.HandleBatch(objs[start:end])
+		if err == nil {
+			continue
+		}
+		var batchErr *queue.BatchError
+		ok := errors.As(err, &batchErr)
+		for i := start; i < end; i++ {
+			switch {
+			case !ok:
+				errs[i] = err
+			case i-start < len(batchErr.Errors):
+				errs[i] = batchErr.Errors[i-start]
+			}
+		}
+	}
+	return errs
+}
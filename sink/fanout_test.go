@@ -0,0 +1,110 @@
+package sink
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"multiple-k8s-informer/queue"
+)
+
+// fakeSink 记录收到的对象，fail 中的 key 处理失败
+type fakeSink struct {
+	fail    map[string]error
+	handled []string
+	batches []int // 每次 HandleBatch 的对象数
+}
+
+func (s *fakeSink) Handle(obj queue.QueueObject) error {
+	s.handled = append(s.handled, obj.Key)
+	return s.fail[obj.Key]
+}
+
+func (s *fakeSink) HandleBatch(objs []queue.QueueObject) error {
+	s.batches = append(s.batches, len(objs))
+	errs := make([]error, len(objs))
+	for i, obj := range objs {
+		errs[i] = s.Handle(obj)
+	}
+	return batchError(errs)
+}
+
+func TestFanoutHandle(t *testing.T) {
+	transient, permanent := errors.New("unavailable"), queue.Permanent(errors.New("bad request"))
+	tests := []struct {
+		name      string
+		a, b      error
+		wantErr   bool
+		permanent bool
+	}{
+		{"all succeeded", nil, nil, false, false},
+		{"one failed", nil, transient, true, false},
+		{"permanent and transient", permanent, transient, true, false},
+		{"all permanent", permanent, permanent, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &fakeSink{fail: map[string]error{"default/web": tt.a}}
+			b := &fakeSink{fail: map[string]error{"default/web": tt.b}}
+			f := &Fanout{}
+			f.Add("a", a, BatchConfig{})
+			f.Add("b", b, BatchConfig{})
+
+			err := f.Handle(queue.QueueObject{Key: "default/web"})
+			if (err != nil) != tt.wantErr || errors.Is(err, queue.ErrPermanent) != tt.permanent {
+				t.Fatalf("Handle() = %v, want error %v permanent %v", err, tt.wantErr, tt.permanent)
+			}
+			if len(a.handled) != 1 || len(b.handled) != 1 {
+				t.Fatalf("handled %v and %v, want every sink to receive the object", a.handled, b.handled)
+			}
+			if tt.b != nil && !strings.Contains(err.Error(), "b: ") {
+				t.Fatalf("error %q does not name the sink", err)
+			}
+		})
+	}
+}
+
+func TestFanoutHandleBatch(t *testing.T) {
+	single := &fakeSink{fail: map[string]error{"b": errors.New("failed")}}
+	batched := &fakeSink{fail: map[string]error{"d": errors.New("failed")}}
+	f := &Fanout{}
+	f.Add("single", single, BatchConfig{})
+	f.Add("batched", batched, BatchConfig{MaxItems: 2})
+
+	var objs []queue.QueueObject
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		objs = append(objs, queue.QueueObject{Key: key})
+	}
+	err := f.HandleBatch(objs)
+
+	var batchErr *queue.BatchError
+	if !errors.As(err, &batchErr) || len(batchErr.Errors) != len(objs) {
+		t.Fatalf("HandleBatch() = %v, want a BatchError", err)
+	}
+	for i, obj := range objs {
+		if failed := batchErr.Errors[i] != nil; failed != (obj.Key == "b" || obj.Key == "d") {
+			t.Errorf("%s failed = %v", obj.Key, failed)
+		}
+	}
+	if len(single.batches) != 0 || len(single.handled) != 5 {
+		t.Fatalf("sink without batch: batches %v handled %v, want 5 single calls", single.batches, single.handled)
+	}
+	if got := batched.batches; len(got) != 3 || got[0] != 2 || got[2] != 1 {
+		t.Fatalf("batched sink got batches %v, want 2,2,1", got)
+	}
+}
+
+func TestFanoutBatch(t *testing.T) {
+	f := &Fanout{}
+	f.Add("a", &fakeSink{}, BatchConfig{})
+	if _, _, ok := f.Batch(); ok {
+		t.Fatal("Batch() is enabled without any sink setting maxItems")
+	}
+	f.Add("b", &fakeSink{}, BatchConfig{MaxItems: 50})
+	f.Add("c", &fakeSink{}, BatchConfig{MaxItems: 100, MaxWait: 100 * time.Millisecond})
+	maxItems, maxWait, ok := f.Batch()
+	if !ok || maxItems != 100 || maxWait != DefaultBatchWait {
+		t.Fatalf("Batch() = %d, %v, %v, want 100, %v, true", maxItems, maxWait, ok, DefaultBatchWait)
+	}
+}
@@ -0,0 +1,257 @@
+package sink
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"multiple-k8s-informer/queue"
+	"multiple-k8s-informer/stream"
+
+	"k8s.io/klog"
+)
+
+// DefaultFileMaxSize 默认单个文件大小上限
+const DefaultFileMaxSize = 100 * 1024 * 1024
+
+// rotatedTimeFormat 轮转后的文件名中的时间
+const rotatedTimeFormat = "20060102T150405.000"
+
+// FileConfig 审计文件配置
+type FileConfig struct {
+	Enabled        bool          `json:"enabled" yaml:"enabled"`
+	Path           string        `json:"path" yaml:"path"`                     // 当前文件，如 ./audit/events.jsonl
+	MaxSize        int64         `json:"maxSize" yaml:"maxSize"`               // 超过该大小(字节)时轮转，默认 100MB
+	RotateInterval time.Duration `json:"rotateInterval" yaml:"rotateInterval"` // 超过该时间时轮转，0 表示不按时间轮转
+	MaxBackups     int           `json:"maxBackups" yaml:"maxBackups"`         // 保留的轮转文件数量，0 表示全部保留
+	Compress       bool          `json:"compress" yaml:"compress"`             // gzip 压缩轮转后的文件
+	WithObject     bool          `json:"withObject" yaml:"withObject"`         // 是否带完整对象
+	Sync           bool          `json:"sync" yaml:"sync"`                     // 每次写入后 fsync
+	Batch          BatchConfig   `json:"batch" yaml:"batch"`                   // 批量处理，一批对象一次写入
+}
+
+// auditRecord 每行一个 JSON
+type auditRecord struct {
+	Timestamp time.Time `json:"timestamp"`
+	stream.Event
+}
+
+// File 将 QueueObject 以 JSON 行追加写入文件
+// 文件超过 MaxSize 或打开超过 RotateInterval 时轮转为 <name>-<时间><ext>，Compress 时再压缩为 .gz
+type File struct {
+	config FileConfig
+
+	mu       sync.Mutex
+	file     *os.File // 为 nil 且未关闭时，下次写入重新打开
+	closed   bool
+	size     int64
+	openedAt time.Time
+
+	wg         sync.WaitGroup // 后台压缩
+	compressMu sync.Mutex     // 压缩与清理依次执行，清理时没有正在压缩的文件
+}
+
+func NewFile(config FileConfig) (*File, error) {
+	if config.Path == "" {
+		return nil, errors.New("audit file path is empty")
+	}
+	if config.MaxSize <= 0 {
+		config.MaxSize = DefaultFileMaxSize
+	}
+	f := &File{config: config}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Handle 实现 controller.HandleFunc
+func (f *File) Handle(obj queue.QueueObject) error {
+	line, err := f.line(obj)
+	if err != nil {
+		return queue.Permanent(err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.write(line)
+}
+
+// HandleBatch 实现 controller.BatchHandleFunc
+func (f *File) HandleBatch(objs []queue.QueueObject) error {
+	errs := make([]error, len(objs))
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, obj := range objs {
+		line, err := f.line(obj)
+		if err != nil {
+			errs[i] = queue.Permanent(err)
+			continue
+		}
+		errs[i] = f.write(line)
+	}
+	return batchError(errs)
+}
+
+// Close 关闭当前文件，并等待后台压缩完成
+func (f *File) Close() {
+	f.mu.Lock()
+	if f.file != nil {
+		if err := f.file.Close(); err != nil {
+			klog.Error("close audit file error: ", err)
+		}
+		f.file = nil
+	}
+	f.closed = true
+	f.mu.Unlock()
+	f.wg.Wait()
+}
+
+func (f *File) line(obj queue.QueueObject) ([]byte, error) {
+	b, err := json.Marshal(auditRecord{Timestamp: time.Now(), Event: stream.NewEvent(obj, f.config.WithObject)})
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+// write 调用时需持有锁
+func (f *File) write(line []byte) error {
+	if f.closed {
+		return errors.New("audit file is closed")
+	}
+	if f.file == nil {
+		if err := f.open(); err != nil {
+			return err
+		}
+	}
+	if f.size > 0 && (f.size+int64(len(line)) > f.config.MaxSize ||
+		f.config.RotateInterval > 0 && time.Since(f.openedAt) >= f.config.RotateInterval) {
+		if err := f.rotate(); err != nil {
+			klog.Error("rotate audit file error: ", err)
+			if f.file == nil {
+				return err
+			}
+			// 轮转失败时继续写入当前文件，下次写入再轮转
+		}
+	}
+
+	n, err := f.file.Write(line)
+	f.size += int64(n)
+	if err != nil {
+		return err
+	}
+	if f.config.Sync {
+		return f.file.Sync()
+	}
+	return nil
+}
+
+// open 打开当前文件，已存在时继续追加
+func (f *File) open() error {
+	if err := os.MkdirAll(filepath.Dir(f.config.Path), 0o755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(f.config.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size, f.openedAt = file, info.Size(), time.Now()
+	return nil
+}
+
+// rotate 重命名当前文件并打开新文件，调用时需持有锁
+// 失败时重新打开原路径继续写入；仍然失败时 f.file 为 nil，下次写入时再打开
+func (f *File) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+
+	ext := filepath.Ext(f.config.Path)
+	rotated := strings.TrimSuffix(f.config.Path, ext) + "-" + time.Now().Format(rotatedTimeFormat) + ext
+	if err := os.Rename(f.config.Path, rotated); err != nil {
+		return errors.Join(err, f.open())
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		f.compressMu.Lock()
+		defer f.compressMu.Unlock()
+		if f.config.Compress {
+			if err := compressFile(rotated); err != nil {
+				klog.Error("compress audit file error: ", err)
+			}
+		}
+		f.prune()
+	}()
+	return nil
+}
+
+// prune 删除超过 MaxBackups 的旧文件，文件名中的时间可以直接按字符串排序
+// 只匹配 <name>-<时间><ext> 与压缩完成的 <name>-<时间><ext>.gz，调用时需持有 compressMu
+func (f *File) prune() {
+	if f.config.MaxBackups <= 0 {
+		return
+	}
+	ext := filepath.Ext(f.config.Path)
+	prefix := strings.TrimSuffix(f.config.Path, ext) + "-*" + ext
+	var backups []string
+	for _, pattern := range []string{prefix, prefix + ".gz"} {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return
+		}
+		backups = append(backups, matches...)
+	}
+	sort.Strings(backups)
+	for len(backups) > f.config.MaxBackups {
+		if err := os.Remove(backups[0]); err != nil {
+			klog.Error("remove audit file error: ", err)
+		}
+		backups = backups[1:]
+	}
+}
+
+// compressFile 压缩为 <path>.gz 后删除原文件
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	if _, err = io.Copy(zw, src); err == nil {
+		err = zw.Close()
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+	return os.Remove(path)
+}
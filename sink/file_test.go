@@ -0,0 +1,95 @@
+package sink
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"multiple-k8s-informer/queue"
+	"multiple-k8s-informer/resource"
+)
+
+func auditObject(name string) queue.QueueObject {
+	return queue.QueueObject{ClusterName: "c1", ResourceType: resource.Pods, Event: resource.EventAdd, Key: "default/" + name}
+}
+
+// 每次写入都轮转，压缩完成后只保留 MaxBackups 个完整的 .gz
+func TestFileRotateCompress(t *testing.T) {
+	dir := t.TempDir()
+	f, err := NewFile(FileConfig{Path: filepath.Join(dir, "events.jsonl"), MaxSize: 1, MaxBackups: 2, Compress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 6; i++ {
+		if err := f.Handle(auditObject("web")); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(2 * time.Millisecond) // 轮转后的文件名精确到毫秒
+	}
+	f.Close()
+
+	backups, _ := filepath.Glob(filepath.Join(dir, "events-*"))
+	if len(backups) != 2 {
+		t.Fatalf("backups = %v, want 2", backups)
+	}
+	for _, path := range backups {
+		if !strings.HasSuffix(path, ".jsonl.gz") {
+			t.Fatalf("backup %s is not compressed", path)
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		zr, err := gzip.NewReader(file)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		b, err := io.ReadAll(zr)
+		file.Close()
+		if err != nil || !strings.Contains(string(b), `"key":"default/web"`) {
+			t.Fatalf("%s = %q, %v", path, b, err)
+		}
+	}
+}
+
+// 轮转失败后重新打开原路径，之后的写入不受影响
+func TestFileRotateFailure(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "audit")
+	path := filepath.Join(dir, "events.jsonl")
+	f, err := NewFile(FileConfig{Path: path, MaxSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := f.Handle(auditObject("a")); err != nil {
+		t.Fatal(err)
+	}
+
+	// 当前文件被删除，重命名失败
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"b", "c"} {
+		if err := f.Handle(auditObject(name)); err != nil {
+			t.Fatalf("write %s after a failed rotation: %v", name, err)
+		}
+	}
+	// b 写入重新打开的文件，写入 c 时轮转成功
+	backups, _ := filepath.Glob(filepath.Join(dir, "events-*.jsonl"))
+	if len(backups) != 1 {
+		t.Fatalf("backups = %v, want 1", backups)
+	}
+	for path, key := range map[string]string{backups[0]: "default/b", path: "default/c"} {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(b), `"key":"`+key+`"`) {
+			t.Fatalf("%s = %q, want %s", path, b, key)
+		}
+	}
+}
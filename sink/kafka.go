@@ -0,0 +1,218 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"multiple-k8s-informer/queue"
+	"multiple-k8s-informer/stream"
+
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// DefaultKafkaTopic 默认 topic
+const DefaultKafkaTopic = "k8s-events"
+
+// KafkaConfig kafka 配置
+type KafkaConfig struct {
+	Enabled  bool     `json:"enabled" yaml:"enabled"`
+	Brokers  []string `json:"brokers" yaml:"brokers"`
+	ClientID string   `json:"clientID" yaml:"clientID"`
+	// Topic 模板，可用 {{.Cluster}} {{.Resource}} {{.Event}} {{.Namespace}}，如 k8s-{{.Resource}}，默认 k8s-events
+	// topic 只允许 [a-zA-Z0-9._-]，其他字符替换为 _
+	Topic             string        `json:"topic" yaml:"topic"`
+	Format            string        `json:"format" yaml:"format"`                       // json(默认) / cloudevents / cloudevents-binary
+	WithObject        bool          `json:"withObject" yaml:"withObject"`               // 是否带完整对象，只对 json 格式生效
+	Compression       string        `json:"compression" yaml:"compression"`             // none(默认) / gzip / snappy / lz4 / zstd
+	DeliveryTimeout   time.Duration `json:"deliveryTimeout" yaml:"deliveryTimeout"`     // 单条消息投递超时，超时后交给队列重试，默认 30s
+	DisableIdempotent bool          `json:"disableIdempotent" yaml:"disableIdempotent"` // 关闭幂等写入，关闭后 acks=1
+	Batch             BatchConfig   `json:"batch" yaml:"batch"`                         // 批量处理，一批消息一起发送
+}
+
+// Kafka 将 QueueObject 写入 kafka
+// 消息 key 为 <ClusterName>/<Key>，按 key 分区，同一集群同一对象的事件有序
+// 默认开启幂等写入(acks=all)，投递失败的错误交给队列重试
+type Kafka struct {
+	config KafkaConfig
+	topic  *template.Template
+	client *kgo.Client
+}
+
+// NewKafka opts 会追加在配置生成的选项之后，可用于 SASL/TLS 或测试
+func NewKafka(config KafkaConfig, opts ...kgo.Opt) (*Kafka, error) {
+	if len(config.Brokers) == 0 {
+		return nil, errors.New("kafka brokers is empty")
+	}
+	format, err := checkFormat(config.Format)
+	if err != nil {
+		return nil, err
+	}
+	config.Format = format
+	if config.Topic == "" {
+		config.Topic = DefaultKafkaTopic
+	}
+	if config.DeliveryTimeout <= 0 {
+		config.DeliveryTimeout = 30 * time.Second
+	}
+	topic, err := template.New("topic").Option("missingkey=error").Parse(config.Topic)
+	if err != nil {
+		return nil, fmt.Errorf("kafka topic template: %w", err)
+	}
+
+	kopts := []kgo.Opt{
+		kgo.SeedBrokers(config.Brokers...),
+		kgo.DefaultProduceTopic(DefaultKafkaTopic),
+		// 与 java 客户端一致的 murmur2 哈希
+		kgo.RecordPartitioner(kgo.StickyKeyPartitioner(nil)),
+		kgo.RecordDeliveryTimeout(config.DeliveryTimeout),
+	}
+	if config.ClientID != "" {
+		kopts = append(kopts, kgo.ClientID(config.ClientID))
+	}
+	if config.DisableIdempotent {
+		kopts = append(kopts, kgo.DisableIdempotentWrite(), kgo.RequiredAcks(kgo.LeaderAck()))
+	} else {
+		kopts = append(kopts, kgo.RequiredAcks(kgo.AllISRAcks()))
+	}
+	codec, err := compression(config.Compression)
+	if err != nil {
+		return nil, err
+	}
+	kopts = append(kopts, kgo.ProducerBatchCompression(codec))
+
+	client, err := kgo.NewClient(append(kopts, opts...)...)
+	if err != nil {
+		return nil, err
+	}
+	return &Kafka{config: config, topic: topic, client: client}, nil
+}
+
+// Handle 实现 controller.HandleFunc，同步等待投递结果
+func (k *Kafka) Handle(obj queue.QueueObject) error {
+	record, err := k.record(obj)
+	if err != nil {
+		return queue.Permanent(err)
+	}
+	return deliveryError(k.client.ProduceSync(context.Background(), record).FirstErr())
+}
+
+// HandleBatch 实现 controller.BatchHandleFunc，所有消息一起发送，部分失败时返回 queue.BatchError
+func (k *Kafka) HandleBatch(objs []queue.QueueObject) error {
+	errs := make([]error, len(objs))
+	records := make([]*kgo.Record, 0, len(objs))
+	indexes := make([]int, 0, len(objs))
+	for i, obj := range objs {
+		record, err := k.record(obj)
+		if err != nil {
+			errs[i] = queue.Permanent(err)
+			continue
+		}
+		records = append(records, record)
+		indexes = append(indexes, i)
+	}
+
+	for j, result := range k.client.ProduceSync(context.Background(), records...) {
+		errs[indexes[j]] = deliveryError(result.Err)
+	}
+	return batchError(errs)
+}
+
+// Close 等待缓冲中的消息发送完成后关闭
+func (k *Kafka) Close() {
+	ctx, cancel := context.WithTimeout(context.Background(), k.config.DeliveryTimeout)
+	defer cancel()
+	_ = k.client.Flush(ctx)
+	k.client.Close()
+}
+
+func (k *Kafka) record(obj queue.QueueObject) (*kgo.Record, error) {
+	var topic bytes.Buffer
+	if err := k.topic.Execute(&topic, stream.NewEvent(obj, false)); err != nil {
+		return nil, err
+	}
+
+	value, contentType, err := marshal(k.config.Format, k.config.WithObject, obj)
+	if err != nil {
+		return nil, err
+	}
+	record := &kgo.Record{
+		Topic: topicName(topic.String()),
+		Key:   []byte(obj.ClusterName + "/" + obj.Key),
+		Value: value,
+		Headers: []kgo.RecordHeader{
+			{Key: "cluster", Value: []byte(obj.ClusterName)},
+			{Key: "resource", Value: []byte(obj.ResourceType)},
+			{Key: "event", Value: []byte(obj.Event)},
+		},
+	}
+	if contentType != "" {
+		record.Headers = append(record.Headers, kgo.RecordHeader{Key: "content-type", Value: []byte(contentType)})
+	}
+
+	// CloudEvents kafka binding 的 binary 模式，属性放在 ce_ 消息头中，不需要像 http 一样编码
+	if k.config.Format == FormatCloudEventsBinary {
+		event, err := NewCloudEvent(obj)
+		if err != nil {
+			return nil, err
+		}
+		attributes := [][2]string{
+			{"ce_specversion", event.SpecVersion},
+			{"ce_id", event.ID},
+			{"ce_source", event.Source},
+			{"ce_type", event.Type},
+			{"ce_subject", event.Subject},
+			{"ce_time", event.Time.UTC().Format(time.RFC3339Nano)},
+		}
+		for _, attr := range attributes {
+			if attr[1] != "" {
+				record.Headers = append(record.Headers, kgo.RecordHeader{Key: attr[0], Value: []byte(attr[1])})
+			}
+		}
+	}
+	return record, nil
+}
+
+// deliveryError 消息过大等无法通过重试解决的错误不再重试
+func deliveryError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, kerr.MessageTooLarge) || errors.Is(err, kerr.RecordListTooLarge) ||
+		errors.Is(err, kerr.InvalidRecord) {
+		return queue.Permanent(err)
+	}
+	return fmt.Errorf("kafka produce: %w", err)
+}
+
+func compression(name string) (kgo.CompressionCodec, error) {
+	switch name {
+	case "", "none":
+		return kgo.NoCompression(), nil
+	case "gzip":
+		return kgo.GzipCompression(), nil
+	case "snappy":
+		return kgo.SnappyCompression(), nil
+	case "lz4":
+		return kgo.Lz4Compression(), nil
+	case "zstd":
+		return kgo.ZstdCompression(), nil
+	default:
+		return kgo.NoCompression(), fmt.Errorf("unknown kafka compression %q", name)
+	}
+}
+
+// topicName 将 topic 中不允许的字符替换为 _
+func topicName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '_' || r == '-' {
+			return r
+		}
+		return '_'
+	}, name)
+}
@@ -0,0 +1,127 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"multiple-k8s-informer/queue"
+	"multiple-k8s-informer/resource"
+
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// newKafkaCluster 启动进程内的 kafka broker，预先创建 topics
+func newKafkaCluster(t *testing.T, topics ...string) []string {
+	t.Helper()
+	c, err := kfake.NewCluster(kfake.NumBrokers(1), kfake.SeedTopics(3, topics...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.Close)
+	return c.ListenAddrs()
+}
+
+// consume 读取 topic 中的 n 条消息
+func consume(t *testing.T, brokers []string, topic string, n int) []*kgo.Record {
+	t.Helper()
+	client, err := kgo.NewClient(kgo.SeedBrokers(brokers...), kgo.ConsumeTopics(topic), kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var records []*kgo.Record
+	for len(records) < n {
+		fetches := client.PollFetches(ctx)
+		if err := ctx.Err(); err != nil {
+			t.Fatalf("got %d of %d records from %s: %v", len(records), n, topic, err)
+		}
+		records = append(records, fetches.Records()...)
+	}
+	return records
+}
+
+func header(record *kgo.Record, key string) string {
+	for _, h := range record.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func TestKafkaHandle(t *testing.T) {
+	brokers := newKafkaCluster(t, "k8s-pods")
+	k, err := NewKafka(KafkaConfig{Brokers: brokers, Topic: "k8s-{{.Resource}}", Format: FormatCloudEventsBinary})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer k.Close()
+
+	obj := queue.QueueObject{ClusterName: "c1", ResourceType: resource.Pods, Event: resource.EventAdd, Key: "default/web", CreateAt: time.Now()}
+	if err := k.Handle(obj); err != nil {
+		t.Fatal(err)
+	}
+	records := consume(t, brokers, "k8s-pods", 1)
+	r := records[0]
+	if string(r.Key) != "c1/default/web" || header(r, "event") != resource.EventAdd || header(r, "ce_specversion") == "" {
+		t.Fatalf("record key %s, headers %v", r.Key, r.Headers)
+	}
+}
+
+// 同一对象的消息进入同一个分区，保持顺序
+func TestKafkaHandleBatch(t *testing.T) {
+	brokers := newKafkaCluster(t, DefaultKafkaTopic)
+	k, err := NewKafka(KafkaConfig{Brokers: brokers})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer k.Close()
+
+	var objs []queue.QueueObject
+	for _, event := range []string{resource.EventAdd, resource.EventUpdate, resource.EventDelete} {
+		for _, key := range []string{"default/web", "default/api"} {
+			objs = append(objs, queue.QueueObject{ClusterName: "c1", ResourceType: resource.Pods, Event: event, Key: key, CreateAt: time.Now()})
+		}
+	}
+	if err := k.HandleBatch(objs); err != nil {
+		t.Fatal(err)
+	}
+
+	events := map[string][]string{}
+	partitions := map[string]int32{}
+	for _, r := range consume(t, brokers, DefaultKafkaTopic, len(objs)) {
+		key := string(r.Key)
+		if p, ok := partitions[key]; ok && p != r.Partition {
+			t.Fatalf("%s written to partitions %d and %d", key, p, r.Partition)
+		}
+		partitions[key] = r.Partition
+		events[key] = append(events[key], header(r, "event"))
+	}
+	for _, key := range []string{"c1/default/web", "c1/default/api"} {
+		if got := strings.Join(events[key], ","); got != "add,update,delete" {
+			t.Errorf("%s events = %s, want add,update,delete", key, got)
+		}
+	}
+}
+
+func TestKafkaDeliveryError(t *testing.T) {
+	brokers := newKafkaCluster(t, DefaultKafkaTopic)
+	k, err := NewKafka(KafkaConfig{Brokers: brokers, DeliveryTimeout: time.Second}, kgo.ProducerBatchMaxBytes(1024))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer k.Close()
+
+	// 消息超过上限，不再重试
+	obj := queue.QueueObject{ClusterName: "c1", ResourceType: resource.Pods, Event: resource.EventAdd, Key: "default/" + strings.Repeat("a", 2048)}
+	if err := k.Handle(obj); !errors.Is(err, queue.ErrPermanent) {
+		t.Fatalf("Handle() = %v, want a permanent error", err)
+	}
+}
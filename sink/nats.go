@@ -0,0 +1,200 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"multiple-k8s-informer/queue"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// DefaultNATSSubjectPrefix 默认 subject 前缀
+const DefaultNATSSubjectPrefix = "k8s"
+
+// NATSConfig nats 配置
+type NATSConfig struct {
+	Enabled       bool          `json:"enabled" yaml:"enabled"`
+	URL           string        `json:"url" yaml:"url"`                     // 如 nats://127.0.0.1:4222，多个地址用逗号分隔
+	SubjectPrefix string        `json:"subjectPrefix" yaml:"subjectPrefix"` // subject 为 <prefix>.<cluster>.<resource>.<event>，默认 k8s
+	Format        string        `json:"format" yaml:"format"`               // json(默认) / cloudevents / cloudevents-binary
+	WithObject    bool          `json:"withObject" yaml:"withObject"`       // 是否带完整对象，只对 json 格式生效
+	Timeout       time.Duration `json:"timeout" yaml:"timeout"`             // 等待 JetStream ack 的超时时间，默认 10s
+	JetStream     bool          `json:"jetStream" yaml:"jetStream"`         // 使用 JetStream 并等待 ack，否则为普通 publish
+	Stream        string        `json:"stream" yaml:"stream"`               // 不为空时启动时创建或更新该 stream，subjects 为 <prefix>.>
+	Batch         BatchConfig   `json:"batch" yaml:"batch"`                 // 批量处理，JetStream 模式下一起等待 ack
+}
+
+// NATS 将 QueueObject 发布到 <prefix>.<cluster>.<resource>.<event>
+// JetStream 模式下等待 ack，ack 成功返回 nil 由调用方 Finish，失败返回错误由调用方 ReQueue
+// 消息带 Nats-Msg-Id，重试导致的重复消息在 stream 的去重窗口内会被丢弃
+type NATS struct {
+	config NATSConfig
+	conn   *nats.Conn
+	js     jetstream.JetStream
+}
+
+// NewNATS opts 用于认证、TLS 等连接选项
+func NewNATS(config NATSConfig, opts ...nats.Option) (*NATS, error) {
+	if config.URL == "" {
+		return nil, errors.New("nats url is empty")
+	}
+	format, err := checkFormat(config.Format)
+	if err != nil {
+		return nil, err
+	}
+	config.Format = format
+	if config.SubjectPrefix == "" {
+		config.SubjectPrefix = DefaultNATSSubjectPrefix
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+
+	conn, err := nats.Connect(config.URL, append([]nats.Option{nats.Name("multiple-k8s-informer")}, opts...)...)
+	if err != nil {
+		return nil, err
+	}
+	n := &NATS{config: config, conn: conn}
+	if !config.JetStream {
+		return n, nil
+	}
+
+	if n.js, err = jetstream.New(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if config.Stream != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), config.Timeout)
+		defer cancel()
+		_, err = n.js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+			Name:     config.Stream,
+			Subjects: []string{config.SubjectPrefix + ".>"},
+		})
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("create nats stream %s: %w", config.Stream, err)
+		}
+	}
+	return n, nil
+}
+
+// Handle 实现 controller.HandleFunc
+func (n *NATS) Handle(obj queue.QueueObject) error {
+	msg, err := n.msg(obj)
+	if err != nil {
+		return queue.Permanent(err)
+	}
+
+	if n.js == nil {
+		if err := n.conn.PublishMsg(msg); err != nil {
+			return fmt.Errorf("nats publish: %w", err)
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), n.config.Timeout)
+	defer cancel()
+	if _, err := n.js.PublishMsg(ctx, msg, jetstream.WithMsgID(msg.Header.Get(nats.MsgIdHdr))); err != nil {
+		return fmt.Errorf("nats publish %s: %w", msg.Subject, err)
+	}
+	return nil
+}
+
+// HandleBatch 实现 controller.BatchHandleFunc
+// JetStream 模式下异步发布后一起等待 ack，部分失败时返回 queue.BatchError
+func (n *NATS) HandleBatch(objs []queue.QueueObject) error {
+	if n.js == nil {
+		errs := make([]error, len(objs))
+		for i, obj := range objs {
+			errs[i] = n.Handle(obj)
+		}
+		if err := n.conn.FlushTimeout(n.config.Timeout); err != nil {
+			return fmt.Errorf("nats flush: %w", err)
+		}
+		return batchError(errs)
+	}
+
+	errs := make([]error, len(objs))
+	futures := make([]jetstream.PubAckFuture, len(objs))
+	for i, obj := range objs {
+		msg, err := n.msg(obj)
+		if err != nil {
+			errs[i] = queue.Permanent(err)
+			continue
+		}
+		if futures[i], err = n.js.PublishMsgAsync(msg, jetstream.WithMsgID(msg.Header.Get(nats.MsgIdHdr))); err != nil {
+			errs[i] = fmt.Errorf("nats publish %s: %w", msg.Subject, err)
+		}
+	}
+
+	timeout := time.After(n.config.Timeout)
+	for i, future := range futures {
+		if future == nil {
+			continue
+		}
+		select {
+		case <-future.Ok():
+		case err := <-future.Err():
+			errs[i] = fmt.Errorf("nats publish %s: %w", future.Msg().Subject, err)
+		case <-timeout:
+			errs[i] = fmt.Errorf("nats publish %s: %w", future.Msg().Subject, context.DeadlineExceeded)
+		}
+	}
+	return batchError(errs)
+}
+
+// Close 发送缓冲中的消息后关闭连接
+func (n *NATS) Close() {
+	if err := n.conn.Drain(); err != nil {
+		n.conn.Close()
+	}
+}
+
+// Subject <prefix>.<cluster>.<resource>.<event>
+func (n *NATS) Subject(obj queue.QueueObject) string {
+	return strings.Join([]string{n.config.SubjectPrefix, subjectToken(obj.ClusterName), subjectToken(obj.ResourceType), subjectToken(obj.Event)}, ".")
+}
+
+func (n *NATS) msg(obj queue.QueueObject) (*nats.Msg, error) {
+	data, contentType, err := marshal(n.config.Format, n.config.WithObject, obj)
+	if err != nil {
+		return nil, err
+	}
+	msg := nats.NewMsg(n.Subject(obj))
+	msg.Data = data
+	msg.Header.Set(nats.MsgIdHdr, obj.ClusterName+"/"+eventID(obj))
+	if contentType != "" {
+		msg.Header.Set("Content-Type", contentType)
+	}
+
+	if n.config.Format == FormatCloudEventsBinary {
+		event, err := NewCloudEvent(obj)
+		if err != nil {
+			return nil, err
+		}
+		header, _ := event.Binary()
+		for name, values := range header {
+			msg.Header[name] = values
+		}
+	}
+	return msg, nil
+}
+
+// subjectToken subject 中的一段不能包含 . * > 与空白字符
+func subjectToken(s string) string {
+	if s == "" {
+		return "_"
+	}
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '.', '*', '>', ' ', '\t', '\r', '\n':
+			return '_'
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,103 @@
+package sink
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"multiple-k8s-informer/queue"
+	"multiple-k8s-informer/resource"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+)
+
+// runNATSServer 启动进程内的 nats-server，开启 JetStream
+func runNATSServer(t *testing.T) string {
+	t.Helper()
+	s, err := server.NewServer(&server.Options{Host: "127.0.0.1", Port: -1, JetStream: true, StoreDir: t.TempDir(), NoSigs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Start()
+	if !s.ReadyForConnections(5 * time.Second) {
+		t.Fatal("nats server is not ready")
+	}
+	t.Cleanup(s.Shutdown)
+	return s.ClientURL()
+}
+
+func natsObject(cluster, key string) queue.QueueObject {
+	return queue.QueueObject{ClusterName: cluster, ResourceType: resource.Pods, Event: resource.EventAdd, Key: key, CreateAt: time.Now()}
+}
+
+func TestNATSPublish(t *testing.T) {
+	url := runNATSServer(t)
+	n, err := NewNATS(NATSConfig{URL: url})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+
+	conn, err := nats.Connect(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	sub, err := conn.SubscribeSync("k8s.>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := n.Handle(natsObject("prod.eu", "default/web")); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := sub.NextMsg(5 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Subject != "k8s.prod_eu.pods.add" || msg.Header.Get(nats.MsgIdHdr) == "" {
+		t.Fatalf("got subject %s, header %v", msg.Subject, msg.Header)
+	}
+}
+
+// JetStream 模式下重试的消息按 Nats-Msg-Id 去重
+func TestNATSJetStream(t *testing.T) {
+	url := runNATSServer(t)
+	n, err := NewNATS(NATSConfig{URL: url, JetStream: true, Stream: "K8S"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+
+	web := natsObject("c1", "default/web")
+	for i := 0; i < 2; i++ {
+		if err := n.Handle(web); err != nil {
+			t.Fatal(err)
+		}
+	}
+	batch := []queue.QueueObject{web, natsObject("c1", "default/api"), natsObject("c1", "default/db")}
+	if err := n.HandleBatch(batch); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream, err := n.js.Stream(ctx, "K8S")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := stream.Info(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.State.Msgs != 3 {
+		t.Fatalf("stream has %d messages, want 3", info.State.Msgs)
+	}
+	if _, err := stream.GetLastMsgForSubject(ctx, "k8s.c1.pods.add"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,86 @@
+package sink
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"multiple-k8s-informer/queue"
+	"multiple-k8s-informer/stream"
+)
+
+// marshal 按输出格式序列化单个对象，返回消息体与 Content-Type
+// cloudevents-binary 模式的属性需要由各个 sink 放到消息头中，这里只返回 data
+func marshal(format string, withObject bool, obj queue.QueueObject) ([]byte, string, error) {
+	switch format {
+	case "", FormatJSON:
+		body, err := json.Marshal(stream.NewEvent(obj, withObject))
+		return body, "application/json", err
+	case FormatCloudEvents:
+		event, err := NewCloudEvent(obj)
+		if err != nil {
+			return nil, "", err
+		}
+		body, err := event.Structured()
+		return body, ContentTypeCloudEvents, err
+	case FormatCloudEventsBinary:
+		event, err := NewCloudEvent(obj)
+		if err != nil {
+			return nil, "", err
+		}
+		return event.Data, event.DataContentType, nil
+	default:
+		return nil, "", fmt.Errorf("unknown format %q", format)
+	}
+}
+
+// checkFormat 检查输出格式，为空时返回 json
+func checkFormat(format string) (string, error) {
+	switch format {
+	case "":
+		return FormatJSON, nil
+	case FormatJSON, FormatCloudEvents, FormatCloudEventsBinary:
+		return format, nil
+	default:
+		return "", fmt.Errorf("unknown format %q", format)
+	}
+}
+
+// batchError 有失败时返回 queue.BatchError
+func batchError(errs []error) error {
+	for _, err := range errs {
+		if err != nil {
+			return &queue.BatchError{Errors: errs}
+		}
+	}
+	return nil
+}
+
+// joinErrors 忽略 nil，只有一个错误时原样返回，保留 RequeueAfterError 等错误类型
+// 多个错误时只有全部是 ErrPermanent 才不再重试，否则去掉其中的 ErrPermanent，使其他地址或 sink 可以重试
+func joinErrors(errs []error) error {
+	var nonNil []error
+	permanent := 0
+	for _, err := range errs {
+		if err != nil {
+			nonNil = append(nonNil, err)
+			if errors.Is(err, queue.ErrPermanent) {
+				permanent++
+			}
+		}
+	}
+	switch {
+	case len(nonNil) == 0:
+		return nil
+	case len(nonNil) == 1:
+		return nonNil[0]
+	case permanent == 0 || permanent == len(nonNil):
+		return errors.Join(nonNil...)
+	}
+	for i, err := range nonNil {
+		if errors.Is(err, queue.ErrPermanent) {
+			nonNil[i] = errors.New(err.Error())
+		}
+	}
+	return errors.Join(nonNil...)
+}
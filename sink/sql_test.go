@@ -0,0 +1,140 @@
+package sink
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"multiple-k8s-informer/queue"
+	"multiple-k8s-informer/resource"
+	"multiple-k8s-informer/store"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	_ "modernc.org/sqlite"
+)
+
+func TestNewSQLDriver(t *testing.T) {
+	tests := []struct {
+		driver  string
+		wantErr bool
+	}{
+		{"sqlite", false},
+		{"sqlite3", true},
+		{"pgx", true},
+		{"mysql", true},
+	}
+	for _, tt := range tests {
+		s, err := NewSQL(SQLConfig{Driver: tt.driver, DSN: "file:" + filepath.Join(t.TempDir(), "test.db")})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("driver %s: error = %v, want error %v", tt.driver, err, tt.wantErr)
+		}
+		if err == nil {
+			s.Close()
+		}
+	}
+}
+
+func TestSQLSync(t *testing.T) {
+	s, err := NewSQL(SQLConfig{Driver: "sqlite", DSN: "file:" + filepath.Join(t.TempDir(), "test.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	pod := func(name string) *v1.Pod {
+		return &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"}}
+	}
+	for _, name := range []string{"stale", "web"} {
+		obj := queue.QueueObject{ClusterName: "c1", ResourceType: resource.Pods, Event: resource.EventAdd, Key: "default/" + name, Obj: pod(name)}
+		if err := s.Handle(obj); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cs := store.ClusterIndexers{}
+	pods := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	_ = pods.Add(pod("web"))
+	_ = pods.Add(pod("api"))
+	cs.Add("c1", resource.Pods, pods)
+	if err := s.Sync(context.Background(), cs); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := s.DB().Query("SELECT name FROM " + DefaultSQLTable + " ORDER BY name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+	if got := strings.Join(names, ","); got != "api,web" {
+		t.Fatalf("rows after sync = %s, want api,web", got)
+	}
+}
+
+// 重试的旧事件晚于新事件写入时不覆盖新记录，resourceVersion 按数值比较
+func TestSQLReplayOlder(t *testing.T) {
+	s, err := NewSQL(SQLConfig{Driver: "sqlite", DSN: "file:" + filepath.Join(t.TempDir(), "test.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	object := func(event, version string) queue.QueueObject {
+		pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", ResourceVersion: version}}
+		return queue.QueueObject{ClusterName: "c1", ResourceType: resource.Pods, Event: event, Key: "default/web", Obj: pod}
+	}
+	version := func() string {
+		var v string
+		err := s.DB().QueryRow("SELECT resource_version FROM " + DefaultSQLTable + " WHERE name = 'web'").Scan(&v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	steps := []struct {
+		name string
+		obj  queue.QueueObject
+		want string
+	}{
+		{"add", object(resource.EventAdd, "99"), "99"},
+		{"newer update", object(resource.EventUpdate, "100"), "100"},
+		{"older update replayed", object(resource.EventUpdate, "99"), "100"},
+		{"older delete replayed", object(resource.EventDelete, "98"), "100"},
+		{"same version", object(resource.EventUpdate, "100"), "100"},
+	}
+	for _, step := range steps {
+		if err := s.Handle(step.obj); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if got := version(); got != step.want {
+			t.Fatalf("%s: resource_version = %s, want %s", step.name, got, step.want)
+		}
+	}
+
+	// 批量写入同样生效
+	if err := s.HandleBatch([]queue.QueueObject{object(resource.EventUpdate, "101"), object(resource.EventUpdate, "100")}); err != nil {
+		t.Fatal(err)
+	}
+	if got := version(); got != "101" {
+		t.Fatalf("resource_version after batch = %s, want 101", got)
+	}
+
+	if err := s.Handle(object(resource.EventDelete, "102")); err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	if err := s.DB().QueryRow("SELECT COUNT(*) FROM " + DefaultSQLTable).Scan(&n); err != nil || n != 0 {
+		t.Fatalf("rows after delete = %d, %v, want 0", n, err)
+	}
+}
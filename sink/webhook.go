@@ -0,0 +1,250 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"multiple-k8s-informer/queue"
+	"multiple-k8s-informer/stream"
+)
+
+// DefaultWebhookTimeout 默认请求超时时间
+const DefaultWebhookTimeout = 10 * time.Second
+
+// 签名相关的请求头
+const (
+	HeaderTimestamp = "X-Informer-Timestamp"
+	HeaderSignature = "X-Informer-Signature"
+)
+
+// WebhookConfig webhook 配置
+type WebhookConfig struct {
+	Enabled    bool              `json:"enabled" yaml:"enabled"`
+	Timeout    time.Duration     `json:"timeout" yaml:"timeout"`       // 请求超时时间，默认 10s
+	BatchSize  int               `json:"batchSize" yaml:"batchSize"`   // HandleBatch 时每个请求最多带的对象数，默认 100
+	WithObject bool              `json:"withObject" yaml:"withObject"` // 是否带完整对象，只对 json 格式生效
+	Format     string            `json:"format" yaml:"format"`         // json(默认) / cloudevents / cloudevents-binary
+	Endpoints  []WebhookEndpoint `json:"endpoints" yaml:"endpoints"`
+	Batch      BatchConfig       `json:"batch" yaml:"batch"` // 批量处理，batchSize 为每个请求的对象数
+}
+
+// WebhookEndpoint 一个 webhook 地址，匹配条件为空表示匹配全部
+type WebhookEndpoint struct {
+	Name      string            `json:"name" yaml:"name"`
+	URL       string            `json:"url" yaml:"url"`
+	Secret    string            `json:"secret" yaml:"secret"` // 不为空时对请求签名
+	Headers   map[string]string `json:"headers" yaml:"headers"`
+	Timeout   time.Duration     `json:"timeout" yaml:"timeout"` // 覆盖全局超时时间
+	Clusters  []string          `json:"clusters" yaml:"clusters"`
+	Resources []string          `json:"resources" yaml:"resources"`
+	Events    []string          `json:"events" yaml:"events"`
+}
+
+func (e WebhookEndpoint) filter() stream.Filter {
+	return stream.Filter{Clusters: e.Clusters, Resources: e.Resources, Events: e.Events}
+}
+
+// Webhook 将 QueueObject 以 JSON POST 到配置的地址
+// Handle 发送单个 stream.Event，HandleBatch 按地址分组，每个请求发送一个 stream.Event 数组
+// Format 为 cloudevents 时发送 CloudEvent，批量时为 CloudEvent 数组；cloudevents-binary 不支持批量，逐个发送
+// 返回的错误交给队列重试：4xx 不再重试，429 按 Retry-After 重新入列，其他错误按限速器重试
+// 一个对象匹配多个地址时，任意一个失败都会重试，已成功的地址会再次收到该对象；所有失败的地址都返回 4xx 时才不再重试
+type Webhook struct {
+	config WebhookConfig
+	client *http.Client
+}
+
+func NewWebhook(config WebhookConfig) (*Webhook, error) {
+	if len(config.Endpoints) == 0 {
+		return nil, errors.New("webhook endpoints is empty")
+	}
+	for i, endpoint := range config.Endpoints {
+		if endpoint.URL == "" {
+			return nil, fmt.Errorf("webhook endpoint %d url is empty", i)
+		}
+	}
+	format, err := checkFormat(config.Format)
+	if err != nil {
+		return nil, err
+	}
+	config.Format = format
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultWebhookTimeout
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 100
+	}
+	return &Webhook{config: config, client: &http.Client{}}, nil
+}
+
+// Handle 实现 controller.HandleFunc
+func (w *Webhook) Handle(obj queue.QueueObject) error {
+	var errs []error
+	for _, endpoint := range w.config.Endpoints {
+		if !endpoint.filter().Match(obj) {
+			continue
+		}
+		header, body, err := w.encode(obj)
+		if err != nil {
+			return queue.Permanent(err)
+		}
+		if err := w.post(endpoint, header, body); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return joinErrors(errs)
+}
+
+// HandleBatch 实现 controller.BatchHandleFunc，部分失败时返回 queue.BatchError
+func (w *Webhook) HandleBatch(objs []queue.QueueObject) error {
+	errs := make([]error, len(objs))
+	for _, endpoint := range w.config.Endpoints {
+		var indexes []int
+		for i, obj := range objs {
+			if endpoint.filter().Match(obj) {
+				indexes = append(indexes, i)
+			}
+		}
+
+		batchSize := w.config.BatchSize
+		if w.config.Format == FormatCloudEventsBinary {
+			batchSize = 1
+		}
+		for start := 0; start < len(indexes); start += batchSize {
+			chunk := indexes[start:min(start+batchSize, len(indexes))]
+			batch := make([]queue.QueueObject, 0, len(chunk))
+			for _, i := range chunk {
+				batch = append(batch, objs[i])
+			}
+
+			header, body, err := w.encodeBatch(batch)
+			if err != nil {
+				err = queue.Permanent(err)
+			} else {
+				err = w.post(endpoint, header, body)
+			}
+			if err == nil {
+				continue
+			}
+			for _, i := range chunk {
+				errs[i] = joinErrors([]error{errs[i], err})
+			}
+		}
+	}
+
+	return batchError(errs)
+}
+
+// encode 按 Format 生成单个对象的请求头与请求体
+func (w *Webhook) encode(obj queue.QueueObject) (http.Header, []byte, error) {
+	if w.config.Format == FormatCloudEventsBinary {
+		event, err := NewCloudEvent(obj)
+		if err != nil {
+			return nil, nil, err
+		}
+		header, body := event.Binary()
+		return header, body, nil
+	}
+
+	body, contentType, err := marshal(w.config.Format, w.config.WithObject, obj)
+	return http.Header{"Content-Type": {contentType}}, body, err
+}
+
+// encodeBatch 按 Format 生成批量请求，cloudevents-binary 只能有一个对象
+func (w *Webhook) encodeBatch(objs []queue.QueueObject) (http.Header, []byte, error) {
+	switch w.config.Format {
+	case FormatCloudEventsBinary:
+		return w.encode(objs[0])
+	case FormatCloudEvents:
+		events := make([]CloudEvent, 0, len(objs))
+		for _, obj := range objs {
+			event, err := NewCloudEvent(obj)
+			if err != nil {
+				return nil, nil, err
+			}
+			events = append(events, event)
+		}
+		body, err := json.Marshal(events)
+		return http.Header{"Content-Type": {ContentTypeCloudEventsBatch}}, body, err
+	default:
+		events := make([]stream.Event, 0, len(objs))
+		for _, obj := range objs {
+			events = append(events, stream.NewEvent(obj, w.config.WithObject))
+		}
+		body, err := json.Marshal(events)
+		return http.Header{"Content-Type": {"application/json"}}, body, err
+	}
+}
+
+// post 发送请求，非 2xx 返回错误
+func (w *Webhook) post(endpoint WebhookEndpoint, header http.Header, body []byte) error {
+	timeout := w.config.Timeout
+	if endpoint.Timeout > 0 {
+		timeout = endpoint.Timeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return queue.Permanent(err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	for k, v := range endpoint.Headers {
+		req.Header.Set(k, v)
+	}
+	if endpoint.Secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(HeaderTimestamp, timestamp)
+		req.Header.Set(HeaderSignature, Sign(endpoint.Secret, timestamp, body))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook %s: %w", endpoint.URL, err)
+	}
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+
+	err = fmt.Errorf("webhook %s: %s", endpoint.URL, resp.Status)
+	if msg = bytes.TrimSpace(msg); len(msg) > 0 {
+		err = fmt.Errorf("%w: %s", err, msg)
+	}
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusTooManyRequests:
+		if seconds, e := strconv.Atoi(resp.Header.Get("Retry-After")); e == nil {
+			return queue.RequeueAfterWithError(time.Duration(seconds)*time.Second, err)
+		}
+		return err
+	case resp.StatusCode == http.StatusRequestTimeout:
+		return err
+	case resp.StatusCode >= 400 && resp.StatusCode < 500:
+		return queue.Permanent(err)
+	default:
+		return err
+	}
+}
+
+// Sign 签名为 sha256=<hex(HMAC-SHA256(secret, timestamp + "." + body))>
+// 接收方用同样的方式计算并比较，同时检查时间戳防止重放
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,256 @@
+package sink
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"multiple-k8s-informer/queue"
+	"multiple-k8s-informer/resource"
+	"multiple-k8s-informer/stream"
+)
+
+func statusServer(t *testing.T, code int) string {
+	t.Helper()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if code == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", "5")
+		}
+		w.WriteHeader(code)
+	}))
+	t.Cleanup(ts.Close)
+	return ts.URL
+}
+
+// 多个地址失败时，只有全部是 4xx 才不再重试
+func TestWebhookPermanent(t *testing.T) {
+	tests := []struct {
+		name         string
+		codes        []int
+		wantErr      bool
+		permanent    bool
+		requeueAfter bool
+	}{
+		{"all ok", []int{200, 204}, false, false, false},
+		{"one 4xx", []int{200, 400}, true, true, false},
+		{"all 4xx", []int{400, 404}, true, true, false},
+		{"4xx and 5xx", []int{400, 500}, true, false, false},
+		{"5xx and 4xx", []int{503, 403}, true, false, false},
+		{"4xx and 429", []int{400, 429}, true, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var endpoints []WebhookEndpoint
+			for _, code := range tt.codes {
+				endpoints = append(endpoints, WebhookEndpoint{URL: statusServer(t, code)})
+			}
+			w, err := NewWebhook(WebhookConfig{Endpoints: endpoints})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			check := func(method string, err error) {
+				t.Helper()
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("%s error = %v, want error %v", method, err, tt.wantErr)
+				}
+				if got := errors.Is(err, queue.ErrPermanent); got != tt.permanent {
+					t.Errorf("%s: errors.Is(%v, ErrPermanent) = %v, want %v", method, err, got, tt.permanent)
+				}
+				var requeue *queue.RequeueAfterError
+				if got := errors.As(err, &requeue); got != tt.requeueAfter {
+					t.Errorf("%s: errors.As(%v, RequeueAfterError) = %v, want %v", method, err, got, tt.requeueAfter)
+				}
+			}
+			check("Handle", w.Handle(auditObject("web")))
+
+			err = w.HandleBatch([]queue.QueueObject{auditObject("web")})
+			var batch *queue.BatchError
+			if errors.As(err, &batch) {
+				err = batch.Errors[0]
+			}
+			check("HandleBatch", err)
+		})
+	}
+}
+
+// request 测试服务器收到的请求
+type request struct {
+	header http.Header
+	body   []byte
+}
+
+// recordServer 记录收到的请求并返回 200
+type recordServer struct {
+	URL string
+
+	mu       sync.Mutex
+	requests []request
+}
+
+func newRecordServer(t *testing.T) *recordServer {
+	t.Helper()
+	s := &recordServer{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		s.mu.Lock()
+		s.requests = append(s.requests, request{header: r.Header.Clone(), body: body})
+		s.mu.Unlock()
+	}))
+	t.Cleanup(ts.Close)
+	s.URL = ts.URL
+	return s
+}
+
+func (s *recordServer) received() []request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]request(nil), s.requests...)
+}
+
+// events 解析每个批量请求中的事件
+func (s *recordServer) events(t *testing.T) [][]stream.Event {
+	t.Helper()
+	var batches [][]stream.Event
+	for _, req := range s.received() {
+		var events []stream.Event
+		if err := json.Unmarshal(req.body, &events); err != nil {
+			t.Fatalf("body %s: %v", req.body, err)
+		}
+		batches = append(batches, events)
+	}
+	return batches
+}
+
+func TestWebhookSignature(t *testing.T) {
+	signed, unsigned := newRecordServer(t), newRecordServer(t)
+	w, err := NewWebhook(WebhookConfig{Endpoints: []WebhookEndpoint{
+		{URL: signed.URL, Secret: "s3cret", Headers: map[string]string{"Authorization": "Bearer token"}},
+		{URL: unsigned.URL},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Handle(auditObject("web")); err != nil {
+		t.Fatal(err)
+	}
+
+	req := signed.received()[0]
+	timestamp := req.header.Get(HeaderTimestamp)
+	if timestamp == "" {
+		t.Fatalf("%s is missing", HeaderTimestamp)
+	}
+	if got, want := req.header.Get(HeaderSignature), Sign("s3cret", timestamp, req.body); got != want {
+		t.Fatalf("%s = %s, want %s", HeaderSignature, got, want)
+	}
+	if got := req.header.Get("Authorization"); got != "Bearer token" {
+		t.Fatalf("Authorization = %q", got)
+	}
+
+	req = unsigned.received()[0]
+	if req.header.Get(HeaderTimestamp) != "" || req.header.Get(HeaderSignature) != "" {
+		t.Fatalf("endpoint without secret got signature headers %v", req.header)
+	}
+}
+
+func TestWebhookBatchSize(t *testing.T) {
+	server := newRecordServer(t)
+	w, err := NewWebhook(WebhookConfig{BatchSize: 2, Endpoints: []WebhookEndpoint{{URL: server.URL}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	objs := []queue.QueueObject{auditObject("a"), auditObject("b"), auditObject("c"), auditObject("d"), auditObject("e")}
+	if err := w.HandleBatch(objs); err != nil {
+		t.Fatal(err)
+	}
+
+	var keys []string
+	batches := server.events(t)
+	for _, events := range batches {
+		if len(events) > 2 {
+			t.Fatalf("batch of %d events, want at most 2", len(events))
+		}
+		for _, event := range events {
+			keys = append(keys, event.Key)
+		}
+	}
+	if len(batches) != 3 || len(keys) != 5 || keys[0] != "default/a" || keys[4] != "default/e" {
+		t.Fatalf("got %d requests with keys %v, want 3 requests in order", len(batches), keys)
+	}
+}
+
+// 每个地址只收到匹配的集群和资源
+func TestWebhookEndpointFilter(t *testing.T) {
+	c1, events, all := newRecordServer(t), newRecordServer(t), newRecordServer(t)
+	w, err := NewWebhook(WebhookConfig{Endpoints: []WebhookEndpoint{
+		{URL: c1.URL, Clusters: []string{"c1"}},
+		{URL: events.URL, Resources: []string{resource.Events}},
+		{URL: all.URL},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pod := auditObject("web")
+	event := queue.QueueObject{ClusterName: "c2", ResourceType: resource.Events, Event: resource.EventAdd, Key: "default/web.1"}
+	if err := w.HandleBatch([]queue.QueueObject{pod, event}); err != nil {
+		t.Fatal(err)
+	}
+
+	received := func(s *recordServer) (keys []string) {
+		for _, batch := range s.events(t) {
+			for _, e := range batch {
+				keys = append(keys, e.Cluster+"/"+e.Key)
+			}
+		}
+		return keys
+	}
+	if got := received(c1); len(got) != 1 || got[0] != "c1/default/web" {
+		t.Errorf("c1 endpoint got %v", got)
+	}
+	if got := received(events); len(got) != 1 || got[0] != "c2/default/web.1" {
+		t.Errorf("events endpoint got %v", got)
+	}
+	if got := received(all); len(got) != 2 {
+		t.Errorf("endpoint without filter got %v", got)
+	}
+
+	// Handle 也按地址过滤
+	if err := w.Handle(event); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(c1.received()); n != 1 {
+		t.Errorf("c1 endpoint got %d requests, want 1", n)
+	}
+	if n := len(events.received()); n != 2 {
+		t.Errorf("events endpoint got %d requests, want 2", n)
+	}
+}
+
+// 请求超时返回可重试的错误
+func TestWebhookTimeout(t *testing.T) {
+	block := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-block
+	}))
+	t.Cleanup(ts.Close)
+	t.Cleanup(func() { close(block) })
+
+	w, err := NewWebhook(WebhookConfig{Timeout: time.Second, Endpoints: []WebhookEndpoint{{URL: ts.URL, Timeout: 20 * time.Millisecond}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	err = w.Handle(auditObject("web"))
+	if err == nil || errors.Is(err, queue.ErrPermanent) {
+		t.Fatalf("Handle() = %v, want a retryable error", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("Handle() took %v, want the endpoint timeout", elapsed)
+	}
+}
@@ -0,0 +1,90 @@
+package store
+
+import (
+	"sort"
+
+	"k8s.io/client-go/tools/cache"
+)
+
+// ClusterStore 按集群区分的本地缓存接口
+type ClusterStore interface {
+	Store
+	// Clusters 所有集群名称
+	Clusters() []string
+	// Resources 集群中监听的资源类型
+	Resources(cluster string) []string
+	// ListByCluster 列出集群中的资源对象
+	ListByCluster(cluster, resourceName string) []interface{}
+	// GetByClusterKey 输入集群与key，返回资源对象
+	GetByClusterKey(cluster, resourceName, key string) (item interface{}, exists bool)
+}
+
+// ClusterIndexers 集群名称 -> 资源类型 -> indexers
+type ClusterIndexers map[string]MapIndexers
+
+var _ ClusterStore = ClusterIndexers{}
+
+// Add 加入集群的 indexer
+func (c ClusterIndexers) Add(cluster, resourceName string, indexer cache.Indexer) {
+	if indexer == nil {
+		return
+	}
+	if c[cluster] == nil {
+		c[cluster] = make(MapIndexers)
+	}
+	c[cluster][resourceName] = append(c[cluster][resourceName], indexer)
+}
+
+func (c ClusterIndexers) Clusters() []string {
+	clusters := make([]string, 0, len(c))
+	for cluster := range c {
+		clusters = append(clusters, cluster)
+	}
+	sort.Strings(clusters)
+	return clusters
+}
+
+func (c ClusterIndexers) Resources(cluster string) []string {
+	resources := make([]string, 0, len(c[cluster]))
+	for resourceName := range c[cluster] {
+		resources = append(resources, resourceName)
+	}
+	sort.Strings(resources)
+	return resources
+}
+
+func (c ClusterIndexers) ListByCluster(cluster, resourceName string) []interface{} {
+	return c[cluster].List(resourceName)
+}
+
+func (c ClusterIndexers) GetByClusterKey(cluster, resourceName, key string) (interface{}, bool) {
+	items, ok := c[cluster].GetByKey(resourceName, key)
+	if !ok {
+		return nil, false
+	}
+	return items[0], true
+}
+
+func (c ClusterIndexers) List(resourceName string) (items []interface{}) {
+	for _, mapIndexers := range c {
+		items = append(items, mapIndexers.List(resourceName)...)
+	}
+	return
+}
+
+func (c ClusterIndexers) ListKeys(resourceName string) (items []string) {
+	for _, mapIndexers := range c {
+		items = append(items, mapIndexers.ListKeys(resourceName)...)
+	}
+	return
+}
+
+func (c ClusterIndexers) GetByKey(resourceName, key string) (items []interface{}, ok bool) {
+	for _, mapIndexers := range c {
+		if found, exists := mapIndexers.GetByKey(resourceName, key); exists {
+			ok = true
+			items = append(items, found...)
+		}
+	}
+	return
+}
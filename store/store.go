@@ -28,231 +28,42 @@ type MapIndexers map[string][]cache.Indexer
 
 var _ Store = MapIndexers{}
 
+// indexers 资源类型对应的 indexer，resource.All 返回所有资源类型的 indexer
+func (mapIndexers MapIndexers) indexers(resourceName string) []cache.Indexer {
+	if resourceName != resource.All {
+		return mapIndexers[resourceName]
+	}
+
+	var indexers []cache.Indexer
+	for _, mapIndexer := range mapIndexers {
+		indexers = append(indexers, mapIndexer...)
+	}
+	return indexers
+}
+
 func (mapIndexers MapIndexers) List(resourceName string) (items []interface{}) {
-	switch resourceName {
-	case resource.All:
-		for _, mapIndexer := range mapIndexers {
-			for _, indexer := range mapIndexer {
-				items = append(items, indexer.List()...)
-			}
-		}
-	case resource.Services:
-		for _, mapIndexer := range mapIndexers {
-			for _, indexer := range mapIndexer {
-				items = append(items, indexer.List()...)
-			}
-		}
-	case resource.Pods:
-		for _, mapIndexer := range mapIndexers {
-			for _, indexer := range mapIndexer {
-				items = append(items, indexer.List()...)
-			}
-		}
-	case resource.ConfigMaps:
-		for _, mapIndexer := range mapIndexers {
-			for _, indexer := range mapIndexer {
-				items = append(items, indexer.List()...)
-			}
-		}
-	case resource.Events:
-		for _, mapIndexer := range mapIndexers {
-			for _, indexer := range mapIndexer {
-				items = append(items, indexer.List()...)
-			}
-		}
-	case resource.Deployments:
-		for _, mapIndexer := range mapIndexers {
-			for _, indexer := range mapIndexer {
-				items = append(items, indexer.List()...)
-			}
-		}
-	case resource.Statefulsets:
-		for _, mapIndexer := range mapIndexers {
-			for _, indexer := range mapIndexer {
-				items = append(items, indexer.List()...)
-			}
-		}
-	case resource.Daemonsets:
-		for _, mapIndexer := range mapIndexers {
-			for _, indexer := range mapIndexer {
-				items = append(items, indexer.List()...)
-			}
-		}
-	case resource.Secrets:
-		for _, mapIndexer := range mapIndexers {
-			for _, indexer := range mapIndexer {
-				items = append(items, indexer.List()...)
-			}
-		}
+	for _, indexer := range mapIndexers.indexers(resourceName) {
+		items = append(items, indexer.List()...)
 	}
 	return
 }
 
 func (mapIndexers MapIndexers) ListKeys(resourceName string) (items []string) {
-	switch resourceName {
-	case resource.All:
-		for _, mapIndexer := range mapIndexers {
-			for _, indexer := range mapIndexer {
-				items = append(items, indexer.ListKeys()...)
-			}
-		}
-	case resource.Services:
-		for _, mapIndexer := range mapIndexers {
-			for _, indexer := range mapIndexer {
-				items = append(items, indexer.ListKeys()...)
-			}
-		}
-	case resource.Pods:
-		for _, mapIndexer := range mapIndexers {
-			for _, indexer := range mapIndexer {
-				items = append(items, indexer.ListKeys()...)
-			}
-		}
-	case resource.ConfigMaps:
-		for _, mapIndexer := range mapIndexers {
-			for _, indexer := range mapIndexer {
-				items = append(items, indexer.ListKeys()...)
-			}
-		}
-	case resource.Events:
-		for _, mapIndexer := range mapIndexers {
-			for _, indexer := range mapIndexer {
-				items = append(items, indexer.ListKeys()...)
-			}
-		}
-	case resource.Deployments:
-		for _, mapIndexer := range mapIndexers {
-			for _, indexer := range mapIndexer {
-				items = append(items, indexer.ListKeys()...)
-			}
-		}
-	case resource.Statefulsets:
-		for _, mapIndexer := range mapIndexers {
-			for _, indexer := range mapIndexer {
-				items = append(items, indexer.ListKeys()...)
-			}
-		}
-	case resource.Daemonsets:
-		for _, mapIndexer := range mapIndexers {
-			for _, indexer := range mapIndexer {
-				items = append(items, indexer.ListKeys()...)
-			}
-		}
-	case resource.Secrets:
-		for _, mapIndexer := range mapIndexers {
-			for _, indexer := range mapIndexer {
-				items = append(items, indexer.ListKeys()...)
-			}
-		}
+	for _, indexer := range mapIndexers.indexers(resourceName) {
+		items = append(items, indexer.ListKeys()...)
 	}
 	return
 }
 
 func (mapIndexers MapIndexers) GetByKey(resourceName, key string) (items []interface{}, ok bool) {
-	switch resourceName {
-	case resource.All:
-		for _, mapIndexer := range mapIndexers {
-			for _, indexer := range mapIndexer {
-				item, exists, err := indexer.GetByKey(key)
-				if err != nil {
-					continue
-				}
-				if exists {
-					ok = true
-					items = append(items, item)
-				}
-			}
-		}
-	case resource.Services:
-		for _, mapIndexer := range mapIndexers {
-			for _, indexer := range mapIndexer {
-				item, exists, err := indexer.GetByKey(key)
-				if err != nil {
-					continue
-				}
-				if exists {
-					ok = true
-					items = append(items, item)
-				}
-			}
-		}
-	case resource.Pods:
-		for _, mapIndexer := range mapIndexers {
-			for _, indexer := range mapIndexer {
-				item, exists, err := indexer.GetByKey(key)
-				if err != nil {
-					continue
-				}
-				if exists {
-					ok = true
-					items = append(items, item)
-				}
-			}
-		}
-	case resource.Deployments:
-		for _, mapIndexer := range mapIndexers {
-			for _, indexer := range mapIndexer {
-				item, exists, err := indexer.GetByKey(key)
-				if err != nil {
-					continue
-				}
-				if exists {
-					ok = true
-					items = append(items, item)
-				}
-			}
-		}
-	case resource.Statefulsets:
-		for _, mapIndexer := range mapIndexers {
-			for _, indexer := range mapIndexer {
-				item, exists, err := indexer.GetByKey(key)
-				if err != nil {
-					continue
-				}
-				if exists {
-					ok = true
-					items = append(items, item)
-				}
-			}
-		}
-	case resource.ConfigMaps:
-		for _, mapIndexer := range mapIndexers {
-			for _, indexer := range mapIndexer {
-				item, exists, err := indexer.GetByKey(key)
-				if err != nil {
-					continue
-				}
-				if exists {
-					ok = true
-					items = append(items, item)
-				}
-			}
-		}
-	case resource.Daemonsets:
-		for _, mapIndexer := range mapIndexers {
-			for _, indexer := range mapIndexer {
-				item, exists, err := indexer.GetByKey(key)
-				if err != nil {
-					continue
-				}
-				if exists {
-					ok = true
-					items = append(items, item)
-				}
-			}
-		}
-	case resource.Events:
-		for _, mapIndexer := range mapIndexers {
-			for _, indexer := range mapIndexer {
-				item, exists, err := indexer.GetByKey(key)
-				if err != nil {
-					continue
-				}
-				if exists {
-					ok = true
-					items = append(items, item)
-				}
-			}
+	for _, indexer := range mapIndexers.indexers(resourceName) {
+		item, exists, err := indexer.GetByKey(key)
+		if err != nil {
+			continue
+		}
+		if exists {
+			ok = true
+			items = append(items, item)
 		}
 	}
 
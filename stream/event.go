@@ -0,0 +1,47 @@
+package stream
+
+import (
+	"strings"
+	"time"
+
+	"multiple-k8s-informer/queue"
+	"multiple-k8s-informer/resource"
+)
+
+// Event 对外输出的事件格式
+type Event struct {
+	Cluster         string      `json:"cluster"`
+	Resource        string      `json:"resource"`
+	Event           string      `json:"event"`
+	Key             string      `json:"key"`
+	Namespace       string      `json:"namespace,omitempty"`
+	Name            string      `json:"name"`
+	ResourceVersion string      `json:"resourceVersion,omitempty"`
+	CreateAt        time.Time   `json:"createAt"`
+	Object          interface{} `json:"object,omitempty"`
+	Diff            string      `json:"diff,omitempty"` // update 事件的 JSON merge patch
+}
+
+// NewEvent 将 QueueObject 转换为 Event，withObject 为 false 时不带完整对象
+func NewEvent(obj queue.QueueObject, withObject bool) Event {
+	e := Event{
+		Cluster:  obj.ClusterName,
+		Resource: obj.ResourceType,
+		Event:    obj.Event,
+		Key:      obj.Key,
+		CreateAt: obj.CreateAt,
+		Diff:     obj.Diff,
+	}
+	e.Namespace, e.Name, _ = strings.Cut(obj.Key, "/")
+	if e.Name == "" {
+		// 没有 namespace 的资源，key 就是 name
+		e.Namespace, e.Name = "", e.Namespace
+	}
+	if accessor, err := resource.Accessor(obj.Obj); err == nil {
+		e.ResourceVersion = accessor.GetResourceVersion()
+	}
+	if withObject {
+		e.Object = resource.Unwrap(obj.Obj)
+	}
+	return e
+}
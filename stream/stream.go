@@ -0,0 +1,127 @@
+package stream
+
+import (
+	"slices"
+	"strings"
+	"sync"
+
+	"multiple-k8s-informer/queue"
+	"multiple-k8s-informer/resource"
+)
+
+// DefaultBuffer 每个订阅者默认的缓冲区大小
+const DefaultBuffer = 256
+
+// Filter 订阅过滤条件，为空表示不过滤
+type Filter struct {
+	Clusters   []string
+	Resources  []string
+	Events     []string
+	Namespaces []string
+	Exclude    []string // 不订阅的资源类型，如未开启 exposeSecrets 时的 secrets
+}
+
+// Match 对象是否满足过滤条件
+func (f Filter) Match(obj queue.QueueObject) bool {
+	namespace, _, found := strings.Cut(obj.Key, "/")
+	if !found {
+		namespace = ""
+	}
+	return resource.Match(f.Clusters, obj.ClusterName) &&
+		resource.Match(f.Resources, obj.ResourceType) &&
+		resource.Match(f.Events, obj.Event) &&
+		resource.Match(f.Namespaces, namespace) &&
+		!slices.Contains(f.Exclude, obj.ResourceType)
+}
+
+// Subscriber 订阅者，缓冲区满时被断开，C 被关闭
+type Subscriber struct {
+	C <-chan queue.QueueObject
+
+	ch      chan queue.QueueObject
+	filter  Filter
+	closed  bool
+	dropped bool
+}
+
+// Dropped 是否因为消费过慢被断开
+func (s *Subscriber) Dropped() bool {
+	return s.dropped
+}
+
+// Broadcaster 将入队的对象分发给所有订阅者
+// 发送不阻塞，订阅者缓冲区满时直接断开，不会拖慢主队列
+type Broadcaster struct {
+	mu   sync.Mutex
+	subs map[*Subscriber]struct{}
+}
+
+func NewBroadcaster() *Broadcaster {
+	return &Broadcaster{subs: make(map[*Subscriber]struct{})}
+}
+
+// Subscribe 订阅，buffer <= 0 时使用 DefaultBuffer
+func (b *Broadcaster) Subscribe(filter Filter, buffer int) *Subscriber {
+	if buffer <= 0 {
+		buffer = DefaultBuffer
+	}
+	ch := make(chan queue.QueueObject, buffer)
+	s := &Subscriber{C: ch, ch: ch, filter: filter}
+
+	b.mu.Lock()
+	b.subs[s] = struct{}{}
+	b.mu.Unlock()
+	return s
+}
+
+// Unsubscribe 取消订阅，关闭 C
+func (b *Broadcaster) Unsubscribe(s *Subscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.remove(s)
+}
+
+// Publish 分发对象
+func (b *Broadcaster) Publish(obj queue.QueueObject) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for s := range b.subs {
+		if !s.filter.Match(obj) {
+			continue
+		}
+		select {
+		case s.ch <- obj:
+		default:
+			// 消费过慢，断开
+			s.dropped = true
+			b.remove(s)
+		}
+	}
+}
+
+// remove 调用时需持有锁
+func (b *Broadcaster) remove(s *Subscriber) {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	delete(b.subs, s)
+	close(s.ch)
+}
+
+// publishingQueue Push 时同时分发给订阅者
+type publishingQueue struct {
+	queue.Decorator
+	broadcaster *Broadcaster
+}
+
+// NewPublishingQueue 包装队列，informer 放入队列的对象同时分发给 broadcaster 的订阅者
+func NewPublishingQueue(q queue.Queue, broadcaster *Broadcaster) queue.Queue {
+	return &publishingQueue{Decorator: queue.Decorator{Queue: q}, broadcaster: broadcaster}
+}
+
+func (q *publishingQueue) Push(obj queue.QueueObject) {
+	q.Queue.Push(obj)
+	q.broadcaster.Publish(obj)
+}